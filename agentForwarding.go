@@ -0,0 +1,60 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"sync"
+)
+
+// forwardingClients holds the *agentForwarding of every client asked to
+// forward agent channels to the local agent, a client only accepts one
+// handler for them.
+var forwardingClients sync.Map
+
+// agentForwarding sets up the handler of a client once, concurrent callers
+// wait for it. conn is the connection to the local agent once set up.
+type agentForwarding struct {
+	once sync.Once
+	conn io.Closer
+	err  error
+}
+
+// requestAgentForwarding forwards the local SSH agent over session, so the
+// command run by it can authenticate onwards with the local keys.
+func requestAgentForwarding(client *ssh.Client, session *ssh.Session) error {
+	entry, _ := forwardingClients.LoadOrStore(client, &agentForwarding{})
+	forwarding := entry.(*agentForwarding)
+	forwarding.once.Do(func() {
+		localAgent, agentConn, err := getAgent()
+		if err == nil {
+			if err = agent.ForwardToAgent(client, localAgent); err != nil {
+				agentConn.Close()
+			}
+		}
+		if err != nil {
+			// Later sessions try again
+			forwarding.err = err
+			forwardingClients.CompareAndDelete(client, forwarding)
+			return
+		}
+		forwarding.conn = agentConn
+		forgetOnClose(client)
+	})
+	if forwarding.err != nil {
+		return forwarding.err
+	}
+	return agent.RequestAgentForwarding(session)
+}
+
+// stopAgentForwarding closes the agent connection forwarded over client, once
+// a setup still running is done.
+func stopAgentForwarding(client *ssh.Client) {
+	if entry, ok := forwardingClients.LoadAndDelete(client); ok {
+		forwarding := entry.(*agentForwarding)
+		forwarding.once.Do(func() {})
+		if forwarding.conn != nil {
+			forwarding.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package goScp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// serveLocalAgent serves an empty agent at SSH_AUTH_SOCK.
+func serveLocalAgent(t *testing.T) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+// agentClient returns a client of a server that opens an agent channel back
+// as soon as a session asks for agent forwarding, and reports whether the
+// client accepted it.
+func agentClient(t *testing.T) (*ssh.Client, <-chan error) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	opened := make(chan error, 100)
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn, channels, requests, err := ssh.NewServerConn(serverConn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			_, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				for request := range requests {
+					request.Reply(request.Type == "auth-agent-req@openssh.com", nil)
+					if request.Type == "auth-agent-req@openssh.com" {
+						channel, agentRequests, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+						if err == nil {
+							go ssh.DiscardRequests(agentRequests)
+							channel.Close()
+						}
+						opened <- err
+					}
+				}
+			}()
+		}
+	}()
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeClient(client) })
+	return client, opened
+}
+
+func TestConcurrentAgentForwarding(t *testing.T) {
+	serveLocalAgent(t)
+	client, opened := agentClient(t)
+
+	const sessions = 20
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := client.NewSession()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer session.Close()
+			if err := requestAgentForwarding(client, session); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < sessions; i++ {
+		if err := <-opened; err != nil {
+			t.Fatalf("the agent channel of a session was refused: %v", err)
+		}
+	}
+}
+
+func TestAgentForwardingRetriedAfterFailure(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	client, opened := agentClient(t)
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := requestAgentForwarding(client, session); err != ErrNoAgent {
+		t.Fatalf("forwarding without an agent: got %v, want ErrNoAgent", err)
+	}
+
+	serveLocalAgent(t)
+	if err := requestAgentForwarding(client, session); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-opened; err != nil {
+		t.Fatalf("the agent channel was refused: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"sync"
+)
+
+// AlgorithmPolicy restricts the algorithms negotiated with the remote host.
+// Every list is in order of preference; an empty list keeps the defaults of
+// golang.org/x/crypto/ssh.
+type AlgorithmPolicy struct {
+	KeyExchanges      []string
+	Ciphers           []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+// FIPSAlgorithms returns a policy limited to FIPS 140 approved algorithms:
+// NIST curve and group14 SHA-256 key exchanges, AES ciphers, SHA-2 MACs and
+// ECDSA or RSA SHA-2 host keys. It only restricts the negotiation, the
+// implementations are still those of the Go standard library.
+func FIPSAlgorithms() AlgorithmPolicy {
+	return AlgorithmPolicy{
+		KeyExchanges: []string{
+			"ecdh-sha2-nistp256",
+			"ecdh-sha2-nistp384",
+			"ecdh-sha2-nistp521",
+			"diffie-hellman-group14-sha256",
+		},
+		Ciphers: []string{
+			"aes128-gcm@openssh.com",
+			"aes256-gcm@openssh.com",
+			"aes128-ctr",
+			"aes192-ctr",
+			"aes256-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com",
+			"hmac-sha2-512-etm@openssh.com",
+			"hmac-sha2-256",
+			"hmac-sha2-512",
+		},
+		HostKeyAlgorithms: []string{
+			ssh.KeyAlgoECDSA256,
+			ssh.KeyAlgoECDSA384,
+			ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA256,
+			ssh.KeyAlgoRSASHA512,
+		},
+	}
+}
+
+// apply sets the algorithms of the policy on config.
+func (p AlgorithmPolicy) apply(config *ssh.ClientConfig) {
+	if len(p.KeyExchanges) > 0 {
+		config.KeyExchanges = p.KeyExchanges
+	}
+	if len(p.Ciphers) > 0 {
+		config.Ciphers = p.Ciphers
+	}
+	if len(p.MACs) > 0 {
+		config.MACs = p.MACs
+	}
+	if len(p.HostKeyAlgorithms) > 0 {
+		config.HostKeyAlgorithms = p.HostKeyAlgorithms
+	}
+}
+
+// WithAlgorithms only negotiates the algorithms allowed by policy, connecting
+// fails when the remote host supports none of them.
+func WithAlgorithms(policy AlgorithmPolicy) ConnectOption {
+	return func(o *connectOptions) {
+		o.algorithms = &policy
+	}
+}
+
+// WithFIPSOnly only negotiates the algorithms of FIPSAlgorithms.
+func WithFIPSOnly() ConnectOption {
+	return WithAlgorithms(FIPSAlgorithms())
+}
+
+// legacyAlgorithms are the algorithms WithLegacyAlgorithms adds to the
+// defaults. They are broken or weak and only offered by old servers.
+var legacyAlgorithms = AlgorithmPolicy{
+	KeyExchanges:      []string{"diffie-hellman-group14-sha1", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1"},
+	Ciphers:           []string{"aes128-cbc", "3des-cbc"},
+	MACs:              []string{"hmac-sha1", "hmac-sha1-96"},
+	HostKeyAlgorithms: []string{ssh.KeyAlgoRSA, "ssh-dss"},
+}
+
+// legacyClients holds every client connected with WithLegacyAlgorithms.
+var legacyClients sync.Map
+
+// WithLegacyAlgorithms additionally negotiates the SHA-1 key exchanges, CBC
+// ciphers, SHA-1 MACs and ssh-rsa and ssh-dss host keys that old network
+// appliances are stuck with, after every modern algorithm. These are weak, so
+// only use it for hosts that need it: the client is flagged as such in the
+// Warnings of its ClientInfo. Lists set by WithAlgorithms take precedence.
+func WithLegacyAlgorithms() ConnectOption {
+	return func(o *connectOptions) {
+		o.legacyAlgorithms = true
+	}
+}
+
+// applyLegacy adds legacyAlgorithms to the defaults in config.
+func applyLegacy(config *ssh.ClientConfig) {
+	supported := ssh.SupportedAlgorithms()
+	config.KeyExchanges = append(append([]string{}, supported.KeyExchanges...), legacyAlgorithms.KeyExchanges...)
+	config.Ciphers = append(append([]string{}, supported.Ciphers...), legacyAlgorithms.Ciphers...)
+	config.MACs = append(append([]string{}, supported.MACs...), legacyAlgorithms.MACs...)
+	config.HostKeyAlgorithms = append(append([]string{}, supported.HostKeys...), legacyAlgorithms.HostKeyAlgorithms...)
+}
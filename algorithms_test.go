@@ -0,0 +1,30 @@
+package goScp_test
+
+import (
+	"bytes"
+	"github.com/kalfke/go-scp"
+	"golang.org/x/crypto/ssh"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestLegacyConnectWarnsInClientInfo(t *testing.T) {
+	server, _, _ := startServer(t)
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	client, err := goScp.Connect(writeKeyfile(t), goScp.SSHCredentials{Username: "test"}, server.RemoteHost(), false, goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey())), goScp.WithLegacyAlgorithms())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if logged.Len() > 0 {
+		t.Errorf("Connect logged %q", logged.String())
+	}
+	if warnings := goScp.GetClientInfo(client).Warnings; len(warnings) != 1 {
+		t.Errorf("Warnings = %q, want the legacy algorithms", warnings)
+	}
+}
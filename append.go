@@ -0,0 +1,42 @@
+package goScp
+
+import (
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+)
+
+// AppendToRemoteFile appends everything read from r to remotePath, creating
+// it when it does not exist, e.g. to ship log lines or push data in
+// increments. It writes over SFTP when the remote host offers it, and with
+// cat >> otherwise. Either way every write goes to the end of the file as it
+// is at that moment, so data appended by others is never overwritten, but
+// may end up between the writes of a large append. Progress, bandwidth
+// limits, events and contexts of opts apply.
+func AppendToRemoteFile(client *ssh.Client, remotePath string, r io.Reader, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Upload, "", remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return pipeToRemote(client, r, "cat >> "+shellQuote(remotePath), options)
+	}
+	defer sftpClient.Close()
+
+	file, err := sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+	if err != nil {
+		return err
+	}
+	// Servers ignoring the append flag write at the offset given instead
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return err
+	}
+	_, err = options.buffers.copy(options.instrument(file, -1), contextReader{ctx: options.transferContext(), r: r})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package goScp
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+)
+
+// ArchiveFormat selects how DownloadDirAsArchive packs a remote directory.
+type ArchiveFormat int
+
+const (
+	// ArchiveTarGzip is a gzip compressed tar archive, a .tar.gz file.
+	ArchiveTarGzip ArchiveFormat = iota
+	// ArchiveTar is an uncompressed tar archive.
+	ArchiveTar
+)
+
+// DownloadDirAsArchive packs remoteDir with tar on the remote host and streams
+// the archive to w, e.g. for backups or collecting support bundles. Entries
+// are relative to remoteDir. Progress is reported with a total of -1, as the
+// size of the archive is not known up front.
+func DownloadDirAsArchive(client *ssh.Client, remoteDir string, w io.Writer, format ArchiveFormat, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Download, "", remoteDir, -1)
+	defer func() { options.finish(err) }()
+
+	var flags string
+	switch format {
+	case ArchiveTarGzip:
+		flags = "-c -z -f -"
+	case ArchiveTar:
+		flags = "-c -f -"
+	default:
+		return fmt.Errorf("goScp: unknown archive format %d", format)
+	}
+
+	session, err := openSession(client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	session.Stdout = options.instrument(w, -1)
+	err = session.Run("tar " + flags + " -C " + shellQuote(remoteDir) + " .")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package goScp
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteFileInfo describes a file on the remote host.
+type RemoteFileInfo struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// IsDir reports whether the file is a directory.
+func (i RemoteFileInfo) IsDir() bool {
+	return i.Mode.IsDir()
+}
+
+// Transferrer moves files between the local and a remote host over a single
+// SSH connection. Remote paths are always full file paths.
+type Transferrer interface {
+	// Name returns the name of the backend, e.g. "scp".
+	Name() string
+	// Upload copies localFile to remotePath.
+	Upload(localFile string, remotePath string, opts ...TransferOption) error
+	// Download copies remotePath to localFile.
+	Download(remotePath string, localFile string, opts ...TransferOption) error
+	// List describes the entries of remoteDir.
+	List(remoteDir string) ([]RemoteFileInfo, error)
+	// Stat describes remotePath.
+	Stat(remotePath string) (RemoteFileInfo, error)
+	// Close releases the resources of the backend, but not the SSH connection.
+	Close() error
+}
+
+// Linker is implemented by the Transferrers that can create hard links on the
+// remote host, see UploadFiles.
+type Linker interface {
+	// Link makes remotePath a hard link to target, an existing remote file,
+	// replacing whatever remotePath was before.
+	Link(target string, remotePath string) error
+}
+
+// NewSCPTransferrer returns a Transferrer using the scp protocol, which only
+// needs an scp binary on the remote host.
+func NewSCPTransferrer(client *ssh.Client) Transferrer {
+	return &scpTransferrer{shellStat{client: client}}
+}
+
+type scpTransferrer struct {
+	shellStat
+}
+
+func (t *scpTransferrer) Name() string {
+	return "scp"
+}
+
+func (t *scpTransferrer) Upload(localFile string, remotePath string, opts ...TransferOption) error {
+	return copyLocalFileToRemote(t.client, localFile, remotePath, opts...)
+}
+
+func (t *scpTransferrer) Download(remotePath string, localFile string, opts ...TransferOption) error {
+	return CopyRemoteFileToLocal(t.client, path.Dir(remotePath), path.Base(remotePath), filepath.Dir(localFile), filepath.Base(localFile), opts...)
+}
+
+func (t *scpTransferrer) Link(target string, remotePath string) error {
+	_, err := ExecuteCommand(t.client, "ln -f -- "+shellQuote(target)+" "+shellQuote(remotePath))
+	return err
+}
+
+func (t *scpTransferrer) Close() error {
+	return nil
+}
+
+// shellStat implements List and Stat with stat(1) on the remote host, for the
+// backends without a file listing protocol of their own.
+type shellStat struct {
+	client *ssh.Client
+}
+
+const remoteStatFormat = "'%s %Y %f %n'"
+
+func (s shellStat) List(remoteDir string) ([]RemoteFileInfo, error) {
+	output, err := ExecuteCommand(s.client, "find "+shellQuote(remoteDir)+" -mindepth 1 -maxdepth 1 -exec stat -c "+remoteStatFormat+" {} +")
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []RemoteFileInfo
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		info, err := parseRemoteStat(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, scanner.Err()
+}
+
+func (s shellStat) Stat(remotePath string) (RemoteFileInfo, error) {
+	output, err := ExecuteCommand(s.client, "stat -c "+remoteStatFormat+" -- "+shellQuote(remotePath))
+	if err != nil {
+		return RemoteFileInfo{}, err
+	}
+	return parseRemoteStat(strings.TrimRight(output, "\n"))
+}
+
+// parseRemoteStat parses a line printed by stat -c '%s %Y %f %n'.
+func parseRemoteStat(line string) (RemoteFileInfo, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return RemoteFileInfo{}, fmt.Errorf("goScp: unexpected remote stat output %q", line)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return RemoteFileInfo{}, fmt.Errorf("goScp: unexpected remote stat output %q", line)
+	}
+	mtime, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return RemoteFileInfo{}, fmt.Errorf("goScp: unexpected remote stat output %q", line)
+	}
+	rawMode, err := strconv.ParseUint(fields[2], 16, 32)
+	if err != nil {
+		return RemoteFileInfo{}, fmt.Errorf("goScp: unexpected remote stat output %q", line)
+	}
+	return RemoteFileInfo{
+		Name:    path.Base(fields[3]),
+		Size:    size,
+		Mode:    unixModeToFileMode(uint32(rawMode)),
+		ModTime: time.Unix(mtime, 0),
+	}, nil
+}
+
+// unixModeToFileMode converts a st_mode value to an os.FileMode.
+func unixModeToFileMode(mode uint32) os.FileMode {
+	fileMode := os.FileMode(mode & 0777)
+	switch mode & 0170000 {
+	case 0040000:
+		fileMode |= os.ModeDir
+	case 0120000:
+		fileMode |= os.ModeSymlink
+	case 0010000:
+		fileMode |= os.ModeNamedPipe
+	case 0140000:
+		fileMode |= os.ModeSocket
+	case 0020000:
+		fileMode |= os.ModeDevice | os.ModeCharDevice
+	case 0060000:
+		fileMode |= os.ModeDevice
+	}
+	if mode&04000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+	return fileMode
+}
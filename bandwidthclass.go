@@ -0,0 +1,43 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// BandwidthClass tags a host by the kind of link it is reached over, so a
+// TransferManager can apply different limits to it. Any name can be used,
+// the constants are the common ones.
+type BandwidthClass string
+
+const (
+	ClassLAN     BandwidthClass = "lan"
+	ClassWAN     BandwidthClass = "wan"
+	ClassMetered BandwidthClass = "metered"
+)
+
+// BandwidthClassLimits are the settings a TransferManager applies to the
+// transfers to and from hosts of a BandwidthClass.
+type BandwidthClassLimits struct {
+	// BandwidthLimit caps the combined throughput of the transfers of the
+	// class in bytes per second, on top of the limit of the manager. Zero or
+	// less means only that limit applies.
+	BandwidthLimit int64
+	// BufferSize replaces the buffer size of the manager for the class, e.g.
+	// larger buffers for a fast LAN. Zero or less keeps it.
+	BufferSize int
+}
+
+// bandwidthClassOf returns the BandwidthClass of the RemoteHost client was
+// connected to, empty for clients not connected by Connect.
+func bandwidthClassOf(client *ssh.Client) BandwidthClass {
+	if info, ok := connectInfos.Load(client); ok {
+		return info.(ClientInfo).BandwidthClass
+	}
+	return ""
+}
+
+// classLimits is what a TransferManager applies to a BandwidthClass.
+type classLimits struct {
+	throttle *throttle
+	buffers  *bufferPool
+}
@@ -0,0 +1,213 @@
+package goScp
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"path"
+	"time"
+)
+
+// FileOrder places a file within an UploadBatch.
+type FileOrder int
+
+const (
+	// SendNormal files are sent after the SendFirst files.
+	SendNormal FileOrder = iota
+	// SendFirst files are sent before anything else, e.g. a lock or marker
+	// announcing that a delivery is in progress.
+	SendFirst
+	// SendLast files are only sent once every other file of the batch has been
+	// uploaded and verified, e.g. a MANIFEST or .done marker.
+	SendLast
+)
+
+// BatchFile is a single file of an UploadBatch. RemotePath is the full remote
+// path of the file, not its directory.
+type BatchFile struct {
+	LocalPath  string
+	RemotePath string
+	Order      FileOrder
+}
+
+// Sentinel is a marker file written to the remote host once a batch has been
+// uploaded completely, which downstream consumers can poll for.
+type Sentinel struct {
+	RemotePath string
+	// Content is the content of the sentinel file. When nil, a sha256sum
+	// compatible manifest of the remote copies of every file in the batch is
+	// written instead, which sha256sum -c checks on the remote host.
+	Content []byte
+}
+
+// BatchOption configures an UploadBatch.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	sentinel        *Sentinel
+	transferOptions []TransferOption
+	failurePolicy   FailurePolicy
+}
+
+// WithSentinel writes sentinel after every file of the batch has been uploaded.
+func WithSentinel(sentinel Sentinel) BatchOption {
+	return func(o *batchOptions) {
+		o.sentinel = &sentinel
+	}
+}
+
+// WithFailurePolicy decides whether the batch goes on with the other files
+// once a file failed. The default is FailFast. The SendLast files and the
+// sentinel are only sent when every other file succeeded, whatever the
+// policy.
+func WithFailurePolicy(policy FailurePolicy) BatchOption {
+	return func(o *batchOptions) {
+		o.failurePolicy = policy
+	}
+}
+
+// WithTransferOptions applies opts to the upload of every file in the batch.
+func WithTransferOptions(opts ...TransferOption) BatchOption {
+	return func(o *batchOptions) {
+		o.transferOptions = append(o.transferOptions, opts...)
+	}
+}
+
+// UploadBatch uploads files in the order SendFirst, SendNormal, SendLast,
+// keeping the given order within each group. Before the SendLast files are
+// sent, the SHA-256 of every other remote file is checked against the one of
+// what was sent, which transformers make differ from the local file. The
+// first failure stops the batch, unless WithFailurePolicy says otherwise.
+func UploadBatch(client *ssh.Client, files []BatchFile, opts ...BatchOption) error {
+	return UploadBatchResult(client, files, opts...).Err()
+}
+
+// UploadBatchResult works like UploadBatch and reports the outcome of every
+// file, in the order of files, followed by the sentinel when there is one.
+func UploadBatchResult(client *ssh.Client, files []BatchFile, opts ...BatchOption) *BatchResult {
+	options := &batchOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	result := &BatchResult{Items: make([]BatchItem, len(files))}
+	for i, file := range files {
+		result.Items[i] = BatchItem{Name: file.RemotePath, Status: ItemSkipped, Err: ErrBatchStopped}
+	}
+	if options.sentinel != nil {
+		result.Items = append(result.Items, BatchItem{Name: options.sentinel.RemotePath, Status: ItemSkipped, Err: ErrBatchStopped})
+	}
+	// What was sent, which transformers make differ from the local files
+	sent := make([]sentFile, len(files))
+	upload := func(i int) bool {
+		item := &result.Items[i]
+		skipped := false
+		transferOptions := append(options.transferOptions[:len(options.transferOptions):len(options.transferOptions)], withSkipNotify(func() {
+			skipped = true
+		}), withSentNotify(func(size int64, sum []byte) {
+			sent[i] = sentFile{size: size, sum: sum}
+		}))
+		start := time.Now()
+		item.Err = copyLocalFileToRemote(client, files[i].LocalPath, files[i].RemotePath, transferOptions...)
+		item.Duration = time.Since(start)
+		switch {
+		case item.Err != nil:
+			item.Status = ItemFailed
+		case skipped:
+			item.Status = ItemSkipped
+		default:
+			item.Status = ItemSucceeded
+			item.Bytes = sent[i].size
+		}
+		return item.Err == nil
+	}
+
+	policy := options.failurePolicy.or(FailFast)
+	failures := 0
+	for _, order := range []FileOrder{SendFirst, SendNormal} {
+		for i, file := range files {
+			if file.Order != order || upload(i) {
+				continue
+			}
+			if failures++; policy.exceeded(failures) {
+				return result
+			}
+		}
+	}
+
+	for i, file := range files {
+		if file.Order == SendLast || result.Items[i].Err != nil {
+			continue
+		}
+		if err := verifyRemoteSum(client, file, sent[i]); err != nil {
+			result.Items[i].Status, result.Items[i].Err = ItemFailed, err
+			if failures++; policy.exceeded(failures) {
+				return result
+			}
+		}
+	}
+	if failures > 0 {
+		return result
+	}
+
+	for i, file := range files {
+		if file.Order == SendLast && !upload(i) {
+			return result
+		}
+	}
+
+	if options.sentinel != nil {
+		item := &result.Items[len(files)]
+		start := time.Now()
+		item.Bytes, item.Err = writeSentinel(client, files, sent, *options.sentinel)
+		item.Duration = time.Since(start)
+		item.Status = ItemSucceeded
+		if item.Err != nil {
+			item.Status, item.Bytes = ItemFailed, 0
+		}
+	}
+	return result
+}
+
+// sentFile is the size and SHA-256 of what an upload of a batch sent. It is
+// empty for uploads skipped because the remote file was identical.
+type sentFile struct {
+	size int64
+	sum  []byte
+}
+
+// writeSentinel uploads sentinel, generating a checksum manifest of the remote
+// copies of files when it has no content of its own. It returns the size of
+// the sentinel.
+func writeSentinel(client *ssh.Client, files []BatchFile, sent []sentFile, sentinel Sentinel) (int64, error) {
+	content := sentinel.Content
+	if content == nil {
+		var manifest bytes.Buffer
+		for i, file := range files {
+			sum := sent[i].sum
+			if sum == nil {
+				var err error
+				if sum, err = sha256File(file.LocalPath); err != nil {
+					return 0, err
+				}
+			}
+			fmt.Fprintf(&manifest, "%x  %s\n", sum, file.RemotePath)
+		}
+		content = manifest.Bytes()
+	}
+	size := int64(len(content))
+	return size, copyContentToRemote(client, bytes.NewReader(content), size, path.Base(sentinel.RemotePath), 0644, sentinel.RemotePath, newTransferOptions(nil))
+}
+
+// verifyRemoteSum checks that the remote copy of file has the SHA-256 of what
+// was sent, or of the local file when the upload was skipped.
+func verifyRemoteSum(client *ssh.Client, file BatchFile, sent sentFile) error {
+	sum := sent.sum
+	if sum == nil {
+		var err error
+		if sum, err = sha256File(file.LocalPath); err != nil {
+			return err
+		}
+	}
+	return verifyUpload(client, sum, file.RemotePath, file.RemotePath, path.Base(file.RemotePath), 1)
+}
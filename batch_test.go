@@ -0,0 +1,103 @@
+package goScp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadBatchWithTransformers(t *testing.T) {
+	transformers := map[string]goScp.TransferOption{
+		"none":       goScp.WithTransformers(),
+		"encryption": goScp.WithEncryption(make([]byte, 32)),
+		"gzip":       goScp.WithTransformers(goScp.NewGzipTransformer(gzip.BestCompression)),
+	}
+	for name, transform := range transformers {
+		t.Run(name, func(t *testing.T) {
+			_, client, root := startServer(t)
+			localDir := t.TempDir()
+			for _, file := range []string{"data.csv", "DONE"} {
+				if err := ioutil.WriteFile(filepath.Join(localDir, file), []byte("contents of "+file+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			files := []goScp.BatchFile{
+				{LocalPath: filepath.Join(localDir, "data.csv"), RemotePath: "data.csv"},
+				{LocalPath: filepath.Join(localDir, "DONE"), RemotePath: "DONE", Order: goScp.SendLast},
+			}
+			err := goScp.UploadBatch(client, files, goScp.WithTransferOptions(transform), goScp.WithSentinel(goScp.Sentinel{RemotePath: "SHA256SUMS"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want string
+			for _, file := range files {
+				contents, err := ioutil.ReadFile(filepath.Join(root, file.RemotePath))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want += fmt.Sprintf("%x  %s\n", sha256.Sum256(contents), file.RemotePath)
+			}
+			if manifest, err := ioutil.ReadFile(filepath.Join(root, "SHA256SUMS")); err != nil || string(manifest) != want {
+				t.Errorf("manifest %q, %v, want the sums of the remote files %q", manifest, err, want)
+			}
+		})
+	}
+}
+
+func TestUploadBatchVerifiesChecksums(t *testing.T) {
+	_, client, root := startServer(t)
+	localDir := t.TempDir()
+	for _, file := range []string{"data.csv", "DONE"} {
+		if err := ioutil.WriteFile(filepath.Join(localDir, file), []byte("contents of "+file+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Corrupt the remote copy once it is uploaded, keeping its size
+	corrupt := goScp.WithEvents(func(event goScp.Event) {
+		if event.Type == goScp.EventCompleted && event.RemotePath == "data.csv" {
+			ioutil.WriteFile(filepath.Join(root, "data.csv"), []byte("CONTENTS OF data.csv\n"), 0644)
+		}
+	})
+
+	files := []goScp.BatchFile{
+		{LocalPath: filepath.Join(localDir, "data.csv"), RemotePath: "data.csv"},
+		{LocalPath: filepath.Join(localDir, "DONE"), RemotePath: "DONE", Order: goScp.SendLast},
+	}
+	result := goScp.UploadBatchResult(client, files, goScp.WithTransferOptions(corrupt))
+	if !errors.Is(result.Err(), goScp.ErrUploadVerification) {
+		t.Fatalf("UploadBatch = %v, want a verification error", result.Err())
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(root, "DONE")); err == nil {
+		t.Error("DONE was sent after the verification failed")
+	}
+}
+
+func TestUploadBatchReportsSentBytes(t *testing.T) {
+	_, client, root := startServer(t)
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "data.csv"), bytes.Repeat([]byte("a,b,c\n"), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []goScp.BatchFile{{LocalPath: filepath.Join(localDir, "data.csv"), RemotePath: "data.csv"}}
+	result := goScp.UploadBatchResult(client, files, goScp.WithTransferOptions(goScp.WithTransformers(goScp.NewGzipTransformer(gzip.BestCompression))))
+	if err := result.Err(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(root, "data.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Items[0].Bytes != info.Size() {
+		t.Errorf("Bytes = %d, want the %d bytes sent", result.Items[0].Bytes, info.Size())
+	}
+}
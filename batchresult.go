@@ -0,0 +1,90 @@
+package goScp
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBatchStopped is the error of the items of a batch and the hosts of a
+// fan-out operation that were not run because of earlier failures, see
+// FailurePolicy.
+var ErrBatchStopped = errors.New("goScp: batch stopped by an earlier failure")
+
+// ItemStatus tells how a single item of a batch went.
+type ItemStatus string
+
+const (
+	ItemSucceeded ItemStatus = "success"
+	// ItemSkipped items were not transferred, because WithSkipIfIdentical
+	// found them on the remote host already or, with ErrBatchStopped as
+	// their error, because the batch stopped before them.
+	ItemSkipped ItemStatus = "skipped"
+	ItemFailed  ItemStatus = "failed"
+)
+
+// BatchItem is the outcome of a single item of a batch. Name identifies the
+// item, e.g. its remote path. Bytes is the number of bytes transferred.
+type BatchItem struct {
+	Name     string
+	Status   ItemStatus
+	Err      error
+	Bytes    int64
+	Duration time.Duration
+}
+
+// BatchResult holds the outcome of every item of a batch operation, so
+// automation can tell whether it succeeded as a whole and what to retry.
+type BatchResult struct {
+	Items []BatchItem
+}
+
+// Succeeded returns the items that were transferred.
+func (r *BatchResult) Succeeded() []BatchItem {
+	return r.withStatus(ItemSucceeded)
+}
+
+// Skipped returns the items that were not transferred without failing.
+func (r *BatchResult) Skipped() []BatchItem {
+	return r.withStatus(ItemSkipped)
+}
+
+// Failed returns the items that failed.
+func (r *BatchResult) Failed() []BatchItem {
+	return r.withStatus(ItemFailed)
+}
+
+func (r *BatchResult) withStatus(status ItemStatus) []BatchItem {
+	var items []BatchItem
+	for _, item := range r.Items {
+		if item.Status == status {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// OK reports whether every item was transferred or skipped because it was
+// identical already.
+func (r *BatchResult) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns the error of the first item that failed or was not run, nil
+// when there is none.
+func (r *BatchResult) Err() error {
+	for _, item := range r.Items {
+		if item.Err != nil {
+			return item.Err
+		}
+	}
+	return nil
+}
+
+// Bytes returns the number of bytes transferred by all items.
+func (r *BatchResult) Bytes() int64 {
+	var total int64
+	for _, item := range r.Items {
+		total += item.Bytes
+	}
+	return total
+}
@@ -0,0 +1,124 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// benchmarkPings is the number of round trips the command latency is the
+// average of.
+const benchmarkPings = 5
+
+// BenchmarkReport is what Benchmark measured on a host.
+type BenchmarkReport struct {
+	// Size is the size of the payload in bytes.
+	Size int64
+	// CommandLatency is the average time it takes to run a no-op command,
+	// which every transfer pays at least once to open its session.
+	CommandLatency time.Duration
+	// Backends holds one result per backend available on the host.
+	Backends []BackendBenchmark
+}
+
+// BackendBenchmark is the result of a single backend.
+type BackendBenchmark struct {
+	Backend  string
+	Upload   time.Duration
+	Download time.Duration
+	// UploadThroughput and DownloadThroughput are in bytes per second.
+	UploadThroughput   float64
+	DownloadThroughput float64
+	// Err is set when the backend failed, the durations are not meaningful
+	// then.
+	Err error
+}
+
+// Benchmark uploads and downloads a random payload of sizeBytes with every
+// backend available on the remote host, scp, sftp and tar, and reports how
+// long that took, so backends can be compared per host. The payload is kept
+// in a temporary directory on both hosts, which is removed afterwards.
+func Benchmark(client *ssh.Client, sizeBytes int64) (*BenchmarkReport, error) {
+	report := &BenchmarkReport{Size: sizeBytes}
+
+	var total time.Duration
+	for i := 0; i < benchmarkPings; i++ {
+		start := time.Now()
+		if _, err := ExecuteCommand(client, "true"); err != nil {
+			return nil, err
+		}
+		total += time.Since(start)
+	}
+	report.CommandLatency = total / benchmarkPings
+
+	localDir, err := ioutil.TempDir("", "goscp-benchmark-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(localDir)
+	payload := filepath.Join(localDir, "payload")
+	if err := writeRandomFile(payload, sizeBytes); err != nil {
+		return nil, err
+	}
+
+	remoteDir, err := ExecuteCommand(client, "mktemp -d /tmp/goscp-benchmark-XXXXXX")
+	if err != nil {
+		return nil, err
+	}
+	remoteDir = strings.TrimSpace(remoteDir)
+	defer ExecuteCommand(client, "rm -rf "+shellQuote(remoteDir))
+
+	transferrers := []Transferrer{NewSCPTransferrer(client), NewTarTransferrer(client)}
+	if sftpTransferrer, err := NewSFTPTransferrer(client); err == nil {
+		transferrers = append(transferrers, sftpTransferrer)
+	}
+	for _, transferrer := range transferrers {
+		result := benchmarkBackend(transferrer, payload, path.Join(remoteDir, transferrer.Name()), sizeBytes)
+		transferrer.Close()
+		report.Backends = append(report.Backends, result)
+	}
+	return report, nil
+}
+
+func benchmarkBackend(transferrer Transferrer, payload string, remotePath string, size int64) BackendBenchmark {
+	result := BackendBenchmark{Backend: transferrer.Name()}
+
+	start := time.Now()
+	if result.Err = transferrer.Upload(payload, remotePath); result.Err != nil {
+		return result
+	}
+	result.Upload = time.Since(start)
+
+	downloaded := payload + "." + transferrer.Name()
+	defer os.Remove(downloaded)
+	start = time.Now()
+	if result.Err = transferrer.Download(remotePath, downloaded); result.Err != nil {
+		return result
+	}
+	result.Download = time.Since(start)
+
+	result.UploadThroughput = float64(size) / result.Upload.Seconds()
+	result.DownloadThroughput = float64(size) / result.Download.Seconds()
+	return result
+}
+
+// writeRandomFile writes size random bytes to filename. They do not compress,
+// so compressing transports do not skew the results.
+func writeRandomFile(filename string, size int64) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if _, err := io.CopyN(file, random, size); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,88 @@
+package goScp
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultBufferSize is the size of the transfer buffers, the same io.Copy uses.
+const defaultBufferSize = 32 * 1024
+
+// fileWriteSize is the size of the writes to local files. SSH delivers data
+// in packets of at most 32KB, gathering them into larger writes saves most of
+// the write system calls of large downloads.
+const fileWriteSize = 1024 * 1024
+
+var fileWriters = sync.Pool{New: func() interface{} {
+	return bufio.NewWriterSize(nil, fileWriteSize)
+}}
+
+// fileWriter gathers the writes to w into writes of fileWriteSize when w is a
+// local file, and returns w as it is otherwise. The returned function writes
+// out what is left and must be called once everything is written, also when
+// the copy failed, to return the buffer to its pool.
+func fileWriter(w io.Writer) (io.Writer, func() error) {
+	file, ok := w.(*os.File)
+	if !ok {
+		return w, func() error { return nil }
+	}
+	buffered := fileWriters.Get().(*bufio.Writer)
+	// Hide ReadFrom of the file, it only avoids copies between files and
+	// sockets, and would bypass the buffer for anything else
+	buffered.Reset(struct{ io.Writer }{file})
+	return buffered, func() error {
+		err := buffered.Flush()
+		buffered.Reset(nil)
+		fileWriters.Put(buffered)
+		return err
+	}
+}
+
+// bufferPool hands out transfer buffers of one size, so concurrent transfers
+// reuse them instead of allocating their own.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// defaultBuffers is used by every transfer not run by a TransferManager with a
+// buffer size of its own.
+var defaultBuffers = newBufferPool(defaultBufferSize)
+
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() interface{} {
+		buffer := make([]byte, p.size)
+		return &buffer
+	}
+	return p
+}
+
+// copy works like io.Copy with a pooled buffer.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buffer := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buffer)
+	return io.CopyBuffer(dst, src, *buffer)
+}
+
+// copyN works like io.CopyN with a pooled buffer.
+func (p *bufferPool) copyN(dst io.Writer, src io.Reader, n int64) (int64, error) {
+	written, err := p.copy(dst, io.LimitReader(src, n))
+	if written == n {
+		return n, nil
+	}
+	if written < n && err == nil {
+		// src stopped early
+		err = io.EOF
+	}
+	return written, err
+}
+
+// withBufferPool takes the buffers of the transfer from pool.
+func withBufferPool(pool *bufferPool) TransferOption {
+	return func(o *transferOptions) {
+		o.buffers = pool
+	}
+}
@@ -0,0 +1,200 @@
+package goScp
+
+import "sort"
+
+// Feature names an optional capability of the library, so callers can feature
+// detect instead of parsing VERSION.
+type Feature string
+
+const (
+	FeatureAgentForwarding    Feature = "agent-forwarding"
+	FeatureAlgorithmPolicy    Feature = "algorithm-policy"
+	FeatureAppend             Feature = "remote-append"
+	FeatureArchive            Feature = "archive-download"
+	FeatureAsyncTransfers     Feature = "async-transfers"
+	FeatureBandwidthLimit     Feature = "bandwidth-limit"
+	FeatureBandwidthClasses   Feature = "bandwidth-classes"
+	FeatureBatchOrdering      Feature = "batch-ordering"
+	FeatureBatchResult        Feature = "batch-result"
+	FeatureBenchmark          Feature = "benchmark"
+	FeatureBufferPool         Feature = "buffer-pool"
+	FeatureCollect            Feature = "collect"
+	FeatureClientInfo         Feature = "client-info"
+	FeatureCommandBuilder     Feature = "command-builder"
+	FeatureCommandTimeout     Feature = "command-timeout"
+	FeatureCombinedOutput     Feature = "combined-output"
+	FeatureCommandSignals     Feature = "command-signals"
+	FeatureDelta              Feature = "delta"
+	FeatureDeploy             Feature = "deploy"
+	FeatureDialer             Feature = "dialer"
+	FeatureDialLimit          Feature = "dial-limit"
+	FeatureDNSControl         Feature = "dns-control"
+	FeatureEncryption         Feature = "encryption"
+	FeatureEvents             Feature = "events"
+	FeatureExpect             Feature = "expect"
+	FeatureFailurePolicy      Feature = "failure-policy"
+	FeatureFanOut             Feature = "fan-out"
+	FeatureFSUpload           Feature = "fs-upload"
+	FeatureGrowthPolicy       Feature = "growth-policy"
+	FeatureGSSAPI             Feature = "gssapi"
+	FeatureHappyEyeballs      Feature = "happy-eyeballs"
+	FeatureHardLinks          Feature = "hard-links"
+	FeatureHostNames          Feature = "host-names"
+	FeatureHostKeyInspection  Feature = "host-key-inspection"
+	FeatureIgnoreFiles        Feature = "ignore-files"
+	FeatureInventory          Feature = "inventory"
+	FeatureJobGraph           Feature = "job-graph"
+	FeatureLineCallbacks      Feature = "line-callbacks"
+	FeatureLocalSpaceCheck    Feature = "local-space-check"
+	FeatureLegacyAlgorithms   Feature = "legacy-algorithms"
+	FeatureKeyboardAuth       Feature = "keyboard-interactive"
+	FeatureManifest           Feature = "manifest"
+	FeatureRemoteLock         Feature = "remote-lock"
+	FeatureSecurityContext    Feature = "security-context"
+	FeatureSyncMoves          Feature = "sync-moves"
+	FeatureSyncHooks          Feature = "sync-hooks"
+	FeatureExternalClients    Feature = "external-clients"
+	FeaturePathTemplates      Feature = "path-templates"
+	FeaturePermissionMask     Feature = "permission-mask"
+	FeatureConnectionPool     Feature = "connection-pool"
+	FeatureControlMaster      Feature = "control-master"
+	FeaturePortForwarding     Feature = "port-forwarding"
+	FeatureProtocolTrace      Feature = "protocol-trace"
+	FeatureRemotePoll         Feature = "remote-poll"
+	FeatureRelay              Feature = "relay"
+	FeatureRemoteSnapshot     Feature = "remote-snapshot"
+	FeatureRandomAccess       Feature = "random-access"
+	FeatureRemoteTTL          Feature = "remote-ttl"
+	FeatureRollback           Feature = "rollback"
+	FeatureResume             Feature = "resume"
+	FeatureSCPCompat          Feature = "scp-compat"
+	FeatureRemoteSCPErrors    Feature = "remote-scp-errors"
+	FeatureScheduler          Feature = "scheduler"
+	FeatureSentinel           Feature = "sentinel"
+	FeatureSessionEnv         Feature = "session-env"
+	FeatureSessionStats       Feature = "session-stats"
+	FeatureSinks              Feature = "download-sinks"
+	FeatureSFTPBackend        Feature = "sftp-backend"
+	FeatureShutdown           Feature = "graceful-shutdown"
+	FeatureSkipIdentical      Feature = "skip-identical"
+	FeatureSpaceCheck         Feature = "space-check"
+	FeatureSparse             Feature = "sparse-files"
+	FeatureSync               Feature = "sync"
+	FeatureSyncState          Feature = "sync-state"
+	FeatureTarBackend         Feature = "tar-backend"
+	FeatureTimeouts           Feature = "timeouts"
+	FeatureTransferQueue      Feature = "transfer-queue"
+	FeatureTransformers       Feature = "transformers"
+	FeatureURLUpload          Feature = "url-upload"
+	FeatureTwoWaySync         Feature = "two-way-sync"
+	FeatureVerify             Feature = "verify"
+	FeatureUploadVerification Feature = "upload-verification"
+	FeatureWatch              Feature = "watch"
+
+	// Features that are known but not implemented yet.
+	FeatureServerMode Feature = "server-mode"
+)
+
+// supportedFeatures lists every Feature implemented by this version.
+var supportedFeatures = map[Feature]bool{
+	FeatureAgentForwarding:    true,
+	FeatureAlgorithmPolicy:    true,
+	FeatureAppend:             true,
+	FeatureArchive:            true,
+	FeatureAsyncTransfers:     true,
+	FeatureBandwidthLimit:     true,
+	FeatureBandwidthClasses:   true,
+	FeatureBatchOrdering:      true,
+	FeatureBatchResult:        true,
+	FeatureBenchmark:          true,
+	FeatureBufferPool:         true,
+	FeatureCollect:            true,
+	FeatureClientInfo:         true,
+	FeatureCommandBuilder:     true,
+	FeatureCommandTimeout:     true,
+	FeatureCombinedOutput:     true,
+	FeatureCommandSignals:     true,
+	FeatureDelta:              true,
+	FeatureDeploy:             true,
+	FeatureDialer:             true,
+	FeatureDialLimit:          true,
+	FeatureDNSControl:         true,
+	FeatureEncryption:         true,
+	FeatureEvents:             true,
+	FeatureExpect:             true,
+	FeatureFailurePolicy:      true,
+	FeatureFanOut:             true,
+	FeatureFSUpload:           true,
+	FeatureGrowthPolicy:       true,
+	FeatureGSSAPI:             true,
+	FeatureHappyEyeballs:      true,
+	FeatureHardLinks:          true,
+	FeatureHostNames:          true,
+	FeatureHostKeyInspection:  true,
+	FeatureIgnoreFiles:        true,
+	FeatureInventory:          true,
+	FeatureJobGraph:           true,
+	FeatureLineCallbacks:      true,
+	FeatureLocalSpaceCheck:    true,
+	FeatureLegacyAlgorithms:   true,
+	FeatureKeyboardAuth:       true,
+	FeatureManifest:           true,
+	FeatureRemoteLock:         true,
+	FeatureSecurityContext:    true,
+	FeatureSyncMoves:          true,
+	FeatureSyncHooks:          true,
+	FeatureExternalClients:    true,
+	FeaturePathTemplates:      true,
+	FeaturePermissionMask:     true,
+	FeatureConnectionPool:     true,
+	FeatureControlMaster:      true,
+	FeaturePortForwarding:     true,
+	FeatureProtocolTrace:      true,
+	FeatureRemotePoll:         true,
+	FeatureRelay:              true,
+	FeatureRemoteSnapshot:     true,
+	FeatureRandomAccess:       true,
+	FeatureRemoteTTL:          true,
+	FeatureRollback:           true,
+	FeatureResume:             true,
+	FeatureSCPCompat:          true,
+	FeatureRemoteSCPErrors:    true,
+	FeatureScheduler:          true,
+	FeatureSentinel:           true,
+	FeatureSessionEnv:         true,
+	FeatureSessionStats:       true,
+	FeatureSinks:              true,
+	FeatureSFTPBackend:        true,
+	FeatureShutdown:           true,
+	FeatureSkipIdentical:      true,
+	FeatureSpaceCheck:         true,
+	FeatureSparse:             true,
+	FeatureSync:               true,
+	FeatureSyncState:          true,
+	FeatureTarBackend:         true,
+	FeatureTimeouts:           true,
+	FeatureTransferQueue:      true,
+	FeatureTransformers:       true,
+	FeatureURLUpload:          true,
+	FeatureTwoWaySync:         true,
+	FeatureVerify:             true,
+	FeatureUploadVerification: true,
+	FeatureWatch:              true,
+}
+
+// Capabilities returns the features supported by this version, sorted by name.
+func Capabilities() []Feature {
+	features := make([]Feature, 0, len(supportedFeatures))
+	for feature, supported := range supportedFeatures {
+		if supported {
+			features = append(features, feature)
+		}
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+	return features
+}
+
+// HasCapability reports whether feature is supported by this version.
+func HasCapability(feature Feature) bool {
+	return supportedFeatures[feature]
+}
@@ -0,0 +1,50 @@
+package goScp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChallengeResponder answers keyboard-interactive authentication prompts, such
+// as the one-time codes asked for by MFA protected bastions. It must return
+// one answer per question.
+type ChallengeResponder interface {
+	RespondToChallenge(name string, instruction string, questions []string, echos []bool) ([]string, error)
+}
+
+// ChallengeResponderFunc lets an ordinary function be used as a
+// ChallengeResponder.
+type ChallengeResponderFunc func(name string, instruction string, questions []string, echos []bool) ([]string, error)
+
+// RespondToChallenge calls f.
+func (f ChallengeResponderFunc) RespondToChallenge(name string, instruction string, questions []string, echos []bool) ([]string, error) {
+	return f(name, instruction, questions, echos)
+}
+
+// PromptChallengeResponder asks the user every question on out and reads one
+// answer per line from in, e.g. os.Stdin and os.Stderr. Answers are not
+// hidden while they are typed.
+func PromptChallengeResponder(in io.Reader, out io.Writer) ChallengeResponder {
+	reader := bufio.NewReader(in)
+	return ChallengeResponderFunc(func(name string, instruction string, questions []string, echos []bool) ([]string, error) {
+		if name != "" {
+			fmt.Fprintln(out, name)
+		}
+		if instruction != "" {
+			fmt.Fprintln(out, instruction)
+		}
+
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			fmt.Fprint(out, question)
+			answer, err := reader.ReadString('\n')
+			if err != nil && !(err == io.EOF && answer != "") {
+				return nil, err
+			}
+			answers[i] = strings.TrimRight(answer, "\r\n")
+		}
+		return answers, nil
+	})
+}
@@ -0,0 +1,118 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+	"sync"
+)
+
+// Client is an SSH connection together with everything goScp opened for it,
+// so all of it can be torn down with a single Close.
+//
+// The embedded *ssh.Client is what the package level functions take, e.g.
+// CopyLocalFileToRemote(client.Client, ...). Close the Client itself rather
+// than the embedded connection, ideally with a defer right after NewClient.
+// Nothing is cleaned up by finalizers, a Client that is never closed keeps its
+// connection open until the process exits.
+type Client struct {
+	*ssh.Client
+
+	mu      sync.Mutex
+	closers []io.Closer
+	closed  bool
+	// borrowed is set for connections the caller manages, which Close
+	// leaves open.
+	borrowed bool
+}
+
+// NewClient connects to the remote host with the same arguments as Connect.
+func NewClient(sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool, opts ...ConnectOption) (*Client, error) {
+	client, err := Connect(sshKeyFile, sshCredentials, remoteMachine, usingSSHAgent, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// NewClientFromSSH wraps a connection the application established itself,
+// e.g. with its own authentication or through its own proxy, so goScp can use
+// it without dialing again. The connection stays the application's: Close
+// tears down what goScp opened for it, such as forwarded agents and
+// registered closers, but leaves the connection itself open. GetClientInfo
+// reports the fields only Connect knows as empty.
+func NewClientFromSSH(client *ssh.Client) *Client {
+	return &Client{Client: client, borrowed: true}
+}
+
+// CloseWith registers closer to be closed by Close, before the connection
+// itself. Closers are closed in the reverse order of their registration, and
+// straight away when the Client is already closed.
+func (c *Client) CloseWith(closer io.Closer) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		closer.Close()
+		return
+	}
+	c.closers = append(c.closers, closer)
+	c.mu.Unlock()
+}
+
+// Close closes the registered closers, the forwarded agent connection and the
+// SSH connection, which ends every session still open on it, unless the
+// Client was made by NewClientFromSSH. It returns the first error
+// encountered; closing an already closed Client does nothing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	closers := c.closers
+	c.closers = nil
+	c.mu.Unlock()
+
+	var firstErr error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.borrowed {
+		forgetClient(c.Client)
+	} else if err := closeClient(c.Client); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// closeClient closes client along with the agent connection forwarded over it,
+// and drops what the package keeps about it.
+func closeClient(client *ssh.Client) error {
+	stopAgentForwarding(client)
+	legacyClients.Delete(client)
+	connectInfos.Delete(client)
+	backendNegotiations.Delete(client)
+	defer forgetSessions(client)
+	return client.Close()
+}
+
+// forgetClient is closeClient leaving client itself open.
+func forgetClient(client *ssh.Client) {
+	stopAgentForwarding(client)
+	legacyClients.Delete(client)
+	connectInfos.Delete(client)
+	backendNegotiations.Delete(client)
+	forgetSessions(client)
+}
+
+// forgetOnClose calls forgetClient once the connection of client ends, so
+// what the package keeps about it does not outlive clients closed directly
+// with client.Close or dropped by the server.
+func forgetOnClose(client *ssh.Client) {
+	go func() {
+		client.Wait()
+		forgetClient(client)
+	}()
+}
@@ -0,0 +1,115 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"net"
+	"sync"
+	"time"
+)
+
+// ClientInfo describes an established connection, for diagnostics.
+type ClientInfo struct {
+	// Name is the display name of the RemoteHost, empty for clients not
+	// connected by Connect.
+	Name          string
+	ServerVersion string
+	ClientVersion string
+	User          string
+	RemoteAddr    net.Addr
+	LocalAddr     net.Addr
+	// KeyExchange, HostKeyAlgorithm, Cipher and MAC are the negotiated
+	// algorithms, the latter two of the client to server direction. They are
+	// empty with versions of golang.org/x/crypto/ssh that do not report them.
+	KeyExchange      string
+	HostKeyAlgorithm string
+	Cipher           string
+	MAC              string
+	// The fields below are only known for clients connected with Connect.
+	//
+	// Address is the host and port of the RemoteHost, e.g.
+	// "db1.example.com:22". Unlike RemoteAddr it stays the same when the
+	// host name resolves to another address.
+	Address string
+	// AuthMethod is the method that authenticated the user, e.g. "publickey".
+	AuthMethod string
+	// HostKey is the key the remote host presented.
+	HostKey HostKeyInfo
+	// HandshakeDuration is the time taken to dial, negotiate and authenticate.
+	HandshakeDuration time.Duration
+	// BandwidthClass is the one of the RemoteHost.
+	BandwidthClass BandwidthClass
+	// Backend is the transfer backend negotiation, see NegotiateTransferrer.
+	// The remote host is probed by the first GetClientInfo or
+	// NegotiateTransferrer of the client.
+	Backend *BackendNegotiation
+	// Warnings lists weaknesses of the connection, such as legacy algorithms.
+	Warnings []string
+}
+
+// connectInfos holds what Connect learned about every client it connected.
+var connectInfos sync.Map
+
+// GetClientInfo returns what is known about the connection of client.
+func GetClientInfo(client *ssh.Client) ClientInfo {
+	info := ClientInfo{}
+	if recorded, ok := connectInfos.Load(client); ok {
+		info = recorded.(ClientInfo)
+	}
+	info.ServerVersion = string(client.ServerVersion())
+	info.ClientVersion = string(client.ClientVersion())
+	info.User = client.User()
+	info.RemoteAddr = client.RemoteAddr()
+	info.LocalAddr = client.LocalAddr()
+	if conn, ok := client.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		algorithms := conn.Algorithms()
+		info.KeyExchange = algorithms.KeyExchange
+		info.HostKeyAlgorithm = algorithms.HostKey
+		info.Cipher = algorithms.Write.Cipher
+		info.MAC = algorithms.Write.MAC
+	}
+	info.Backend = negotiatedBackend(client)
+	if _, legacy := legacyClients.Load(client); legacy {
+		info.Warnings = append(info.Warnings, "legacy algorithms enabled, see WithLegacyAlgorithms")
+	}
+	return info
+}
+
+// remoteKey identifies the remote host of client in state kept across
+// connections: the host and port of the RemoteHost for clients of Connect,
+// else the remote address.
+func remoteKey(client *ssh.Client) string {
+	if recorded, ok := connectInfos.Load(client); ok {
+		if address := recorded.(ClientInfo).Address; address != "" {
+			return address
+		}
+	}
+	return client.RemoteAddr().String()
+}
+
+// authRecorder records which authentication method was tried last while
+// connecting, which is the one that succeeded once the connection is up.
+// Public keys are always tried first, so they are the default.
+type authRecorder struct {
+	method string
+}
+
+func (r *authRecorder) keyboardInteractive(responder ChallengeResponder) ssh.KeyboardInteractiveChallenge {
+	return func(name string, instruction string, questions []string, echos []bool) ([]string, error) {
+		r.method = "keyboard-interactive"
+		return responder.RespondToChallenge(name, instruction, questions, echos)
+	}
+}
+
+func (r *authRecorder) gssapi(client ssh.GSSAPIClient) ssh.GSSAPIClient {
+	return recordingGSSAPIClient{GSSAPIClient: client, recorder: r}
+}
+
+type recordingGSSAPIClient struct {
+	ssh.GSSAPIClient
+	recorder *authRecorder
+}
+
+func (c recordingGSSAPIClient) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	c.recorder.method = "gssapi-with-mic"
+	return c.GSSAPIClient.InitSecContext(target, token, isGSSDelegCreds)
+}
@@ -0,0 +1,45 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// CollectFile downloads remotePath from every host to localPath, with the
+// concurrency and retries of opts like DistributeFile. Both paths can hold
+// placeholders expanded per host with ExpandPath. localPath should use at
+// least one host variable, e.g. ./collected/{{.Host}}/syslog, otherwise the
+// hosts overwrite each other's file. Missing local directories are created.
+func CollectFile(hosts []RemoteHost, remotePath string, localPath string, opts DistributeOptions) *DistributeReport {
+	return distribute(hostTargets(hosts, opts), remotePath, opts, fetchFile(localPath))
+}
+
+// CollectFileFromInventory works like CollectFile for every host of inv, with
+// the host settings of inv taking precedence like in DistributeFileToInventory.
+func CollectFileFromInventory(inv *Inventory, remotePath string, localPath string, opts DistributeOptions) *DistributeReport {
+	return distribute(inventoryTargets(inv, opts), remotePath, opts, fetchFile(localPath))
+}
+
+// fetchFile returns the action downloading the remote path of the target to
+// localPath.
+func fetchFile(localPath string) hostAction {
+	return func(client *ssh.Client, target distributeTarget, opts DistributeOptions) error {
+		vars := newPathVars(target, target.remotePath)
+		remotePath, err := ExpandPath(target.remotePath, vars)
+		if err != nil {
+			return err
+		}
+		vars.Filename = path.Base(remotePath)
+		localFile, err := ExpandPath(localPath, vars)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+			return err
+		}
+		return CopyRemoteFileToLocal(client, path.Dir(remotePath), path.Base(remotePath), filepath.Dir(localFile), filepath.Base(localFile), opts.TransferOptions...)
+	}
+}
@@ -0,0 +1,145 @@
+package goScp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrCommandTimeout is returned by ExecuteCommandWithTimeout when the remote
+// command did not finish in time.
+var ErrCommandTimeout = errors.New("goScp: remote command timed out")
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// prepareCommand applies options to session and returns the command line that
+// should be run for cmd.
+func prepareCommand(client *ssh.Client, session *ssh.Session, cmd string, options *commandOptions) (string, error) {
+	if options.agentForwarding {
+		if err := requestAgentForwarding(client, session); err != nil {
+			return "", err
+		}
+	}
+	var prefix strings.Builder
+	for _, env := range options.env {
+		if !envNamePattern.MatchString(env.name) {
+			return "", fmt.Errorf("goScp: invalid environment variable name %q", env.name)
+		}
+		// Most servers only accept the variables listed in AcceptEnv
+		if err := session.Setenv(env.name, env.value); err != nil {
+			prefix.WriteString("export " + env.name + "=" + shellQuote(env.value) + "; ")
+		}
+	}
+	if options.dir != "" {
+		prefix.WriteString("cd " + shellQuote(options.dir) + " || exit 1; ")
+	}
+	return prefix.String() + cmd, nil
+}
+
+// ExecuteCommandWithTimeout works like ExecuteCommand, but kills the remote
+// command with SIGKILL and returns ErrCommandTimeout once timeout has passed.
+// Servers older than OpenSSH 7.9 ignore signals, for those closing the session
+// is all that can be done.
+func ExecuteCommandWithTimeout(client *ssh.Client, cmd string, timeout time.Duration, opts ...CommandOption) (string, error) {
+	running, err := StartCommand(client, cmd, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-running.Done():
+		output, err := running.Wait()
+		if err != nil {
+			return "", err
+		}
+		return output, nil
+	case <-timer.C:
+		running.kill()
+		return "", ErrCommandTimeout
+	}
+}
+
+// RunningCommand is a remote command started by StartCommand.
+type RunningCommand struct {
+	session *trackedSession
+	stdout  bytes.Buffer
+	done    chan struct{}
+	err     error
+}
+
+// StartCommand starts cmd on the remote host like ExecuteCommand, but returns
+// once it is running, so it can be signalled, stopped or waited for. Its
+// output is collected until it exits.
+func StartCommand(client *ssh.Client, cmd string, opts ...CommandOption) (*RunningCommand, error) {
+	session, err := openSession(client)
+	if err != nil {
+		return nil, err
+	}
+	options := newCommandOptions(opts)
+	cmd, err = prepareCommand(client, session.Session, cmd, options)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	running := &RunningCommand{session: session, done: make(chan struct{})}
+	flush := options.attachOutput(session.Session, &running.stdout)
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return nil, err
+	}
+	go func() {
+		running.err = session.Wait()
+		flush()
+		session.Close()
+		close(running.done)
+	}()
+	return running, nil
+}
+
+// SendSignal sends sig, such as ssh.SIGINT, ssh.SIGTERM or ssh.SIGKILL, to
+// the command. Servers older than OpenSSH 7.9 ignore signals without
+// reporting an error, use Stop to end the command on those as well.
+func (c *RunningCommand) SendSignal(sig ssh.Signal) error {
+	return c.session.Signal(sig)
+}
+
+// Done is closed once the command exited.
+func (c *RunningCommand) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait waits for the command to exit and returns its output. The error is an
+// *ssh.ExitError when it exited with a non-zero status or by a signal.
+func (c *RunningCommand) Wait() (string, error) {
+	<-c.done
+	return c.stdout.String(), c.err
+}
+
+// Stop asks the command to exit with SIGTERM, and kills it with SIGKILL when
+// it is still running after grace. It returns what Wait returns.
+func (c *RunningCommand) Stop(grace time.Duration) (string, error) {
+	c.SendSignal(ssh.SIGTERM)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+	case <-timer.C:
+		c.kill()
+	}
+	return c.Wait()
+}
+
+// kill sends SIGKILL to the command and closes its session, which ends it
+// on servers ignoring signals too.
+func (c *RunningCommand) kill() {
+	c.SendSignal(ssh.SIGKILL)
+	c.session.Close()
+}
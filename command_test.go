@@ -0,0 +1,28 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"testing"
+)
+
+func TestExecuteCommand(t *testing.T) {
+	_, client, _ := startServer(t)
+
+	output, err := goScp.ExecuteCommand(client, "echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "hello\n" {
+		t.Errorf("output %q, want %q", output, "hello\n")
+	}
+}
+
+func TestExecuteCommandWithoutSession(t *testing.T) {
+	_, client, _ := startServer(t)
+	client.Close()
+
+	// Failing to open a session is an error, not the end of the process
+	if _, err := goScp.ExecuteCommand(client, "true"); err == nil {
+		t.Fatal("ExecuteCommand on a closed connection succeeded")
+	}
+}
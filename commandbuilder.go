@@ -0,0 +1,183 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+// CommandBuilder composes a remote command line for ExecuteCommand from
+// program names, arguments, file names and values, which are quoted for a
+// POSIX shell so spaces, quotes or semicolons in them are passed as they are
+// instead of being interpreted by the remote shell:
+//
+//	cmd, err := NewCommand("grep", "-c", pattern, "access log").
+//		Pipe("sort", "-n").
+//		StdoutTo("/tmp/counts").
+//		Dir(logDir).
+//		Sudo("").
+//		Build()
+//
+// Like with any shell pipeline, the exit status is the one of the last
+// command. Methods are applied to the command added last where it matters, a
+// builder must not be used by several goroutines at once.
+type CommandBuilder struct {
+	dir    string
+	env    []envVar
+	sudo   bool
+	user   string
+	stages []commandStage
+}
+
+// commandStage is a single command of a pipeline, its words and redirections
+// are quoted already.
+type commandStage struct {
+	words     []string
+	redirects []string
+}
+
+// NewCommand starts a command line running name with args.
+func NewCommand(name string, args ...string) *CommandBuilder {
+	return (&CommandBuilder{}).Pipe(name, args...)
+}
+
+// Pipe adds name with args, which reads the output of the command added
+// before.
+func (b *CommandBuilder) Pipe(name string, args ...string) *CommandBuilder {
+	b.stages = append(b.stages, commandStage{})
+	return b.Arg(append([]string{name}, args...)...)
+}
+
+// Arg adds args to the command added last.
+func (b *CommandBuilder) Arg(args ...string) *CommandBuilder {
+	stage := &b.stages[len(b.stages)-1]
+	for _, arg := range args {
+		stage.words = append(stage.words, shellQuote(arg))
+	}
+	return b
+}
+
+// Raw adds s to the command added last without quoting it, for shell syntax
+// such as globs. It must never contain untrusted input.
+func (b *CommandBuilder) Raw(s string) *CommandBuilder {
+	stage := &b.stages[len(b.stages)-1]
+	stage.words = append(stage.words, s)
+	return b
+}
+
+// StdinFrom makes the command added last read the remote file name.
+func (b *CommandBuilder) StdinFrom(name string) *CommandBuilder {
+	return b.redirect("<", name)
+}
+
+// StdoutTo makes the command added last write its output to the remote file
+// name, replacing it.
+func (b *CommandBuilder) StdoutTo(name string) *CommandBuilder {
+	return b.redirect(">", name)
+}
+
+// AppendStdoutTo makes the command added last append its output to the
+// remote file name.
+func (b *CommandBuilder) AppendStdoutTo(name string) *CommandBuilder {
+	return b.redirect(">>", name)
+}
+
+// StderrTo makes the command added last write its error output to the remote
+// file name, e.g. /dev/null.
+func (b *CommandBuilder) StderrTo(name string) *CommandBuilder {
+	return b.redirect("2>", name)
+}
+
+// StderrToStdout sends the error output of the command added last where its
+// output goes, after the redirections added so far.
+func (b *CommandBuilder) StderrToStdout() *CommandBuilder {
+	stage := &b.stages[len(b.stages)-1]
+	stage.redirects = append(stage.redirects, "2>&1")
+	return b
+}
+
+func (b *CommandBuilder) redirect(operator string, name string) *CommandBuilder {
+	stage := &b.stages[len(b.stages)-1]
+	stage.redirects = append(stage.redirects, operator+" "+shellQuote(name))
+	return b
+}
+
+// Dir runs the whole command line in the remote directory dir. It fails
+// without running anything when dir cannot be entered.
+func (b *CommandBuilder) Dir(dir string) *CommandBuilder {
+	b.dir = dir
+	return b
+}
+
+// Env sets the environment variable name to value for every command of the
+// command line. Unlike WithEnv, it does not depend on the AcceptEnv setting of
+// the server, and it applies to commands run with Sudo as well.
+func (b *CommandBuilder) Env(name string, value string) *CommandBuilder {
+	b.env = append(b.env, envVar{name: name, value: value})
+	return b
+}
+
+// Sudo runs the whole command line, including Dir and Env, as user with sudo,
+// or as root when user is empty. sudo is run non-interactively, so it fails
+// instead of waiting for a password the session cannot give.
+func (b *CommandBuilder) Sudo(user string) *CommandBuilder {
+	b.sudo, b.user = true, user
+	return b
+}
+
+// Build returns the command line, or an error when an environment variable
+// name is invalid or a command has an empty name.
+func (b *CommandBuilder) Build() (string, error) {
+	var script strings.Builder
+	if b.dir != "" {
+		script.WriteString("cd " + shellQuote(b.dir) + " || exit 1; ")
+	}
+	for _, env := range b.env {
+		if !envNamePattern.MatchString(env.name) {
+			return "", fmt.Errorf("goScp: invalid environment variable name %q", env.name)
+		}
+		script.WriteString("export " + env.name + "=" + shellQuote(env.value) + "; ")
+	}
+	for i, stage := range b.stages {
+		if stage.words[0] == "''" {
+			return "", errors.New("goScp: command without a name")
+		}
+		if i > 0 {
+			script.WriteString(" | ")
+		}
+		script.WriteString(strings.Join(append(stage.words[:len(stage.words):len(stage.words)], stage.redirects...), " "))
+	}
+
+	if !b.sudo {
+		if b.dir == "" && len(b.env) == 0 {
+			return script.String(), nil
+		}
+		// Keeps cd and export from affecting what the caller appends
+		return "(" + script.String() + ")", nil
+	}
+	cmd := "sudo -n"
+	if b.user != "" {
+		cmd += " -u " + shellQuote(b.user)
+	}
+	return cmd + " -- sh -c " + shellQuote(script.String()), nil
+}
+
+// String returns the command line, or a description of why it cannot be
+// built.
+func (b *CommandBuilder) String() string {
+	cmd, err := b.Build()
+	if err != nil {
+		return "invalid command: " + err.Error()
+	}
+	return cmd
+}
+
+// Run builds the command line and runs it with ExecuteCommand.
+func (b *CommandBuilder) Run(client *ssh.Client, opts ...CommandOption) (string, error) {
+	cmd, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	return ExecuteCommand(client, cmd, opts...)
+}
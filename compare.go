@@ -0,0 +1,276 @@
+package goScp
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comparison selects what is compared between a local and a remote file.
+// Flags can be combined; the zero value compares sizes only.
+type Comparison int
+
+const (
+	// CompareSize reports files whose sizes differ.
+	CompareSize Comparison = 1 << iota
+	// CompareMtime reports files whose modification times differ, at one
+	// second precision.
+	CompareMtime
+	// CompareHash reports files of equal size whose SHA-256 sums differ.
+	CompareHash
+)
+
+// DiffKind tells how a local and a remote file differ.
+type DiffKind string
+
+const (
+	OnlyLocal     DiffKind = "only-local"
+	OnlyRemote    DiffKind = "only-remote"
+	SizeDiffers   DiffKind = "size-differs"
+	MtimeDiffers  DiffKind = "mtime-differs"
+	HashDiffers   DiffKind = "hash-differs"
+	fileUnchanged DiffKind = ""
+)
+
+// FileDiff is a file that differs between the local and the remote tree.
+// Path is relative to both roots and always uses forward slashes.
+type FileDiff struct {
+	Path        string
+	Kind        DiffKind
+	LocalSize   int64
+	RemoteSize  int64
+	LocalMtime  time.Time
+	RemoteMtime time.Time
+}
+
+// CompareResult lists the differing and the identical files of two trees,
+// both sorted by path.
+type CompareResult struct {
+	Diffs     []FileDiff
+	Identical []string
+}
+
+// InSync reports whether no differences were found.
+func (r *CompareResult) InSync() bool {
+	return len(r.Diffs) == 0
+}
+
+// treeFile is a regular file found while listing a tree.
+type treeFile struct {
+	size  int64
+	mtime time.Time
+}
+
+// Verify compares the files below localDir with the ones below remoteDir and
+// reports which differ, without transferring anything. Files excluded by the
+// IgnoreFileName files below localDir are left out on both sides.
+func Verify(client *ssh.Client, localDir string, remoteDir string, comparison Comparison) (*CompareResult, error) {
+	ignore := newIgnoreMatcher(localDir)
+	local, err := listLocalTree(localDir, ignore)
+	if err != nil {
+		return nil, err
+	}
+	return compareWithRemote(client, localDir, remoteDir, local, ignore, comparison)
+}
+
+// compareWithRemote compares local, the listing of localDir, with the files
+// below remoteDir that ignore does not exclude.
+func compareWithRemote(client *ssh.Client, localDir string, remoteDir string, local map[string]treeFile, ignore *ignoreMatcher, comparison Comparison) (*CompareResult, error) {
+	remote, err := listRemoteTree(client, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	for name := range remote {
+		ignored, err := ignore.ignored(name, false)
+		if err != nil {
+			return nil, err
+		}
+		if ignored {
+			delete(remote, name)
+		}
+	}
+	return compareTrees(client, localDir, remoteDir, local, remote, comparison)
+}
+
+// compareTrees compares the listings of a local and a remote tree, hashing
+// files on both sides when comparison asks for it.
+func compareTrees(client *ssh.Client, localDir string, remoteDir string, local map[string]treeFile, remote map[string]treeFile, comparison Comparison) (*CompareResult, error) {
+	if comparison == 0 {
+		comparison = CompareSize
+	}
+
+	result := &CompareResult{}
+	var toHash []string
+	for name, localFile := range local {
+		remoteFile, ok := remote[name]
+		if !ok {
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: OnlyLocal, LocalSize: localFile.size, LocalMtime: localFile.mtime})
+			continue
+		}
+
+		kind := fileUnchanged
+		switch {
+		case comparison&(CompareSize|CompareHash) != 0 && localFile.size != remoteFile.size:
+			kind = SizeDiffers
+		case comparison&CompareMtime != 0 && localFile.mtime.Unix() != remoteFile.mtime.Unix():
+			kind = MtimeDiffers
+		}
+		if kind == fileUnchanged && comparison&CompareHash != 0 {
+			toHash = append(toHash, name)
+			continue
+		}
+		recordComparison(result, name, kind, localFile, remoteFile)
+	}
+	for name, remoteFile := range remote {
+		if _, ok := local[name]; !ok {
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: OnlyRemote, RemoteSize: remoteFile.size, RemoteMtime: remoteFile.mtime})
+		}
+	}
+
+	if len(toHash) > 0 {
+		remoteSums, err := remoteSHA256Sums(client, remoteDir, toHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range toHash {
+			localSum, err := sha256File(filepath.Join(localDir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, err
+			}
+			kind := fileUnchanged
+			if hex.EncodeToString(localSum) != remoteSums[name] {
+				kind = HashDiffers
+			}
+			recordComparison(result, name, kind, local[name], remote[name])
+		}
+	}
+
+	sort.Slice(result.Diffs, func(i, j int) bool { return result.Diffs[i].Path < result.Diffs[j].Path })
+	sort.Strings(result.Identical)
+	return result, nil
+}
+
+func recordComparison(result *CompareResult, name string, kind DiffKind, localFile treeFile, remoteFile treeFile) {
+	if kind == fileUnchanged {
+		result.Identical = append(result.Identical, name)
+		return
+	}
+	result.Diffs = append(result.Diffs, FileDiff{
+		Path:        name,
+		Kind:        kind,
+		LocalSize:   localFile.size,
+		RemoteSize:  remoteFile.size,
+		LocalMtime:  localFile.mtime,
+		RemoteMtime: remoteFile.mtime,
+	})
+}
+
+// listLocalTree returns every regular file below dir that ignore does not
+// exclude by its slash separated path relative to dir.
+func listLocalTree(dir string, ignore *ignoreMatcher) (map[string]treeFile, error) {
+	files := map[string]treeFile{}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			ignored, err := ignore.ignored(filepath.ToSlash(rel), info.IsDir())
+			if err != nil {
+				return err
+			}
+			if ignored && info.IsDir() {
+				return filepath.SkipDir
+			}
+			if ignored {
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = treeFile{size: info.Size(), mtime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// listRemoteTree returns every regular file below dir on the remote host by
+// its path relative to dir. A missing dir is treated as an empty tree.
+func listRemoteTree(client *ssh.Client, dir string) (map[string]treeFile, error) {
+	cmd := "cd " + shellQuote(dir) + " 2>/dev/null || exit 0; find . -type f -exec stat -c '%s %Y %n' {} +"
+	output, err := ExecuteCommand(client, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]treeFile{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("goScp: unexpected remote stat output %q", scanner.Text())
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("goScp: unexpected remote stat output %q", scanner.Text())
+		}
+		files[strings.TrimPrefix(fields[2], "./")] = treeFile{size: size, mtime: time.Unix(mtime, 0)}
+	}
+	return files, scanner.Err()
+}
+
+// remoteSHA256Sums returns the hex encoded SHA-256 sums of the files names,
+// relative to dir on the remote host.
+func remoteSHA256Sums(client *ssh.Client, dir string, names []string) (map[string]string, error) {
+	return remoteSums(client, dir, "sha256sum", names)
+}
+
+// remoteSums is remoteSHA256Sums with command, a coreutils style sum program
+// such as md5sum, instead of sha256sum.
+func remoteSums(client *ssh.Client, dir string, command string, names []string) (map[string]string, error) {
+	sums := make(map[string]string, len(names))
+	const filesPerCommand = 200
+	for start := 0; start < len(names); start += filesPerCommand {
+		end := start + filesPerCommand
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var cmd strings.Builder
+		cmd.WriteString("cd " + shellQuote(dir) + " && " + command + " --")
+		for _, name := range names[start:end] {
+			cmd.WriteString(" " + shellQuote(name))
+		}
+		output, err := ExecuteCommand(client, cmd.String())
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), "  ", 2)
+			if len(fields) == 2 {
+				sums[fields[1]] = fields[0]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return sums, nil
+}
@@ -0,0 +1,83 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"github.com/kalfke/go-scp/goScptest"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startEmbeddedServer starts a goScptest.Server set up by configure before
+// the first connection.
+func startEmbeddedServer(t *testing.T, configure func(*goScptest.Server)) (*ssh.Client, string) {
+	t.Helper()
+	root := t.TempDir()
+	server, err := goScptest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	configure(server)
+	client, err := server.Dial("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, root
+}
+
+// roundTrip uploads and downloads a file with opts and checks it arrived
+// intact both ways.
+func roundTrip(t *testing.T, client *ssh.Client, root string, opts ...goScp.TransferOption) {
+	t.Helper()
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "config backup.tar"), []byte("router config\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := goScp.CopyLocalFileToRemote(client, localDir, "config backup.tar", opts...); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(root, "config backup.tar")); err != nil || string(contents) != "router config\n" {
+		t.Fatalf("upload arrived as %q, %v", contents, err)
+	}
+
+	downloadDir := t.TempDir()
+	if err := goScp.CopyRemoteFileToLocal(client, ".", "config backup.tar", downloadDir, "", opts...); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "config backup.tar")); err != nil || string(contents) != "router config\n" {
+		t.Fatalf("download arrived as %q, %v", contents, err)
+	}
+}
+
+func TestSCPCompatibilityEmbedded(t *testing.T) {
+	client, root := startEmbeddedServer(t, func(server *goScptest.Server) {
+		server.Embedded = true
+	})
+
+	// /usr/bin/scp does not exist there
+	if err := goScp.CopyRemoteFileToLocal(client, ".", "missing", t.TempDir(), ""); err == nil {
+		t.Fatal("download from an embedded server succeeded without WithSCPCompatibility")
+	}
+	roundTrip(t, client, root, goScp.WithSCPCompatibility())
+}
+
+func TestSCPCompatibilityBusyBox(t *testing.T) {
+	busybox, err := exec.LookPath("busybox")
+	if err != nil {
+		t.Skip("busybox is not installed")
+	}
+	applets, err := exec.Command(busybox, "--list").Output()
+	if err != nil || !strings.Contains("\n"+string(applets), "\nscp\n") {
+		t.Skip("busybox has no scp applet")
+	}
+
+	client, root := startEmbeddedServer(t, func(server *goScptest.Server) {
+		server.SCPCommand = busybox + " scp"
+	})
+	roundTrip(t, client, root, goScp.WithSCPCompatibility())
+}
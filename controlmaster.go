@@ -0,0 +1,253 @@
+package goScp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ControlMaster shares the connection of a client with other processes on
+// the same machine through a Unix socket, like the ControlMaster setting of
+// OpenSSH, so a fleet of short lived processes authenticates against a host
+// or bastion once instead of once per process. The other processes connect
+// to it with ConnectControlMaster or ConnectShared.
+type ControlMaster struct {
+	client     *ssh.Client
+	socketPath string
+	listener   net.Listener
+	config     *ssh.ServerConfig
+	wg         sync.WaitGroup
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// ServeControlMaster starts sharing client on the Unix socket socketPath,
+// which only the current user may use. A stale socket left behind by a
+// process that died is replaced, one that is being served makes it fail.
+// Sharing ends when the ControlMaster or client is closed, or the process
+// exits.
+func ServeControlMaster(client *ssh.Client, socketPath string) (*ControlMaster, error) {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil, errors.New("goScp: " + socketPath + " is served by another control master")
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Clients trust the socket, not the key, so it does not need to persist
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+
+	listener, err := listenPrivate(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ControlMaster{client: client, socketPath: socketPath, listener: listener, config: config, done: make(chan struct{})}
+	m.wg.Add(1)
+	go m.serve()
+	closeWithClient(client, m)
+	return m, nil
+}
+
+// Close stops sharing the connection, which closes the connections of the
+// other processes, but not the shared client.
+func (m *ControlMaster) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.listener.Close()
+		if removeErr := os.Remove(m.socketPath); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+			err = removeErr
+		}
+		m.wg.Wait()
+	})
+	return err
+}
+
+// listenPrivate listens on the Unix socket socketPath, which only the current
+// user may use from the start: the socket is created in a directory only the
+// user can enter, made private and only then moved to socketPath.
+func listenPrivate(socketPath string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(socketPath), ".goscp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	privatePath := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is moved away from the path the listener would remove
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(privatePath, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(privatePath, socketPath); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (m *ControlMaster) serve() {
+	defer m.wg.Done()
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			m.handleConn(conn)
+		}()
+	}
+}
+
+// handleConn serves the connection of another process: every channel it
+// opens is opened on the shared client and the two are joined.
+func (m *ControlMaster) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, m.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+
+	go func() {
+		for request := range requests {
+			ok, payload, _ := m.client.SendRequest(request.Type, request.WantReply, request.Payload)
+			if request.WantReply {
+				request.Reply(ok, payload)
+			}
+		}
+	}()
+	// Closing the ControlMaster, which the shared client does as well, ends
+	// the connection
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go func() {
+		select {
+		case <-m.done:
+			serverConn.Close()
+		case <-connDone:
+		}
+	}()
+
+	for newChannel := range channels {
+		go m.joinChannel(newChannel)
+	}
+}
+
+// joinChannel opens a channel like newChannel on the shared client and
+// passes data and requests between the two until both sides closed them.
+func (m *ControlMaster) joinChannel(newChannel ssh.NewChannel) {
+	remote, remoteRequests, err := m.client.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	local, localRequests, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+
+	go func() {
+		forwardChannelRequests(remote, localRequests)
+		remote.Close()
+	}()
+	go func() {
+		io.Copy(remote, local)
+		remote.CloseWrite()
+	}()
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		io.Copy(local, remote)
+	}()
+	go func() {
+		defer output.Done()
+		io.Copy(local.Stderr(), remote.Stderr())
+	}()
+
+	// The exit status arrives as a request before the remote side closes
+	forwardChannelRequests(local, remoteRequests)
+	output.Wait()
+	local.CloseWrite()
+	local.Close()
+}
+
+// forwardChannelRequests sends requests on to channel, and their replies back.
+func forwardChannelRequests(channel ssh.Channel, requests <-chan *ssh.Request) {
+	for request := range requests {
+		ok, err := channel.SendRequest(request.Type, request.WantReply, request.Payload)
+		if request.WantReply {
+			request.Reply(ok && err == nil, nil)
+		}
+	}
+}
+
+// ConnectControlMaster connects to the connection a ControlMaster shares on
+// socketPath. Everything goScp does works over the returned client, which
+// does not authenticate again; RemoteAddr names the socket, not the host.
+func ConnectControlMaster(socketPath string, opts ...ConnectOption) (*ssh.Client, error) {
+	options := newConnectOptions(opts)
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		// The socket is only accessible to the current user, who started the
+		// control master
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	return newClientConn(conn, socketPath, config, options.connectTimeout)
+}
+
+// ConnectShared returns a client sharing the connection served on socketPath
+// when there is one. Otherwise it connects with the arguments of Connect and
+// serves the new connection on socketPath for other processes, until the
+// client is closed.
+func ConnectShared(socketPath string, sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool, opts ...ConnectOption) (*ssh.Client, error) {
+	if client, err := ConnectControlMaster(socketPath, opts...); err == nil {
+		return client, nil
+	}
+	client, err := Connect(sshKeyFile, sshCredentials, remoteMachine, usingSSHAgent, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ServeControlMaster(client, socketPath); err != nil {
+		closeClient(client)
+		return nil, err
+	}
+	return client, nil
+}
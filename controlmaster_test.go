@@ -0,0 +1,48 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlMasterSocket(t *testing.T) {
+	_, client, _ := startServer(t)
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "master.sock")
+
+	master, err := goScp.ServeControlMaster(client, socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("socket has mode %v, want a socket only the user may use", info.Mode())
+	}
+	// Nothing is left next to the socket
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("directory of the socket holds %v, %v", entries, err)
+	}
+
+	shared, err := goScp.ConnectControlMaster(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := goScp.ExecuteCommand(shared, "echo shared")
+	shared.Close()
+	if err != nil || output != "shared\n" {
+		t.Errorf("command over the shared connection: %q, %v", output, err)
+	}
+
+	if err := master.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("the socket was left behind: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package goScp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+)
+
+// identicalOnRemote reports whether the remote file an upload of file to
+// remoteTarget would replace already has the same SHA-256. file is read to
+// hash it and rewound afterwards, files that cannot be rewound are never
+// reported as identical.
+func identicalOnRemote(client *ssh.Client, file io.Reader, remoteTarget string, remoteName string) (bool, error) {
+	seeker, ok := file.(io.Seeker)
+	if !ok {
+		return false, nil
+	}
+
+	remoteSum, err := remoteFileSHA256(client, remoteTarget, remoteName)
+	if err != nil || remoteSum == "" {
+		return false, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return false, err
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == remoteSum, nil
+}
+
+// remoteFileSHA256 returns the hex encoded SHA-256 of the file an upload to
+// remoteTarget named remoteName creates, or "" when it does not exist.
+func remoteFileSHA256(client *ssh.Client, remoteTarget string, remoteName string) (string, error) {
+	// remoteTarget may be the directory the file is uploaded into
+	cmd := "t=" + shellQuote(remoteTarget) + "; [ -d \"$t\" ] && t=\"$t\"/" + shellQuote(remoteName) + "; " +
+		"[ ! -f \"$t\" ] || sha256sum < \"$t\""
+	output, err := ExecuteCommand(client, cmd)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
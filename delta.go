@@ -0,0 +1,394 @@
+package goScp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// errDeltaUnavailable is returned by uploadDelta when the remote host cannot
+// compute block signatures, the caller then uploads the whole file instead.
+var errDeltaUnavailable = errors.New("goScp: delta transfer not available on the remote host")
+
+const (
+	minDeltaBlockSize = 2 * 1024
+	maxDeltaBlockSize = 128 * 1024
+)
+
+// deltaBlockSize picks the block size for a remote file of size bytes, the
+// square root of the size like rsync does.
+func deltaBlockSize(size int64) int {
+	blockSize := int(math.Sqrt(float64(size))) &^ 1023
+	if blockSize < minDeltaBlockSize {
+		return minDeltaBlockSize
+	}
+	if blockSize > maxDeltaBlockSize {
+		return maxDeltaBlockSize
+	}
+	return blockSize
+}
+
+// blockSignature is the checksum pair of a single block of the remote file.
+// The weak checksum is the one printed by cksum(1), as that is available on
+// every POSIX host and can be rolled over the local file.
+type blockSignature struct {
+	weak   uint32
+	strong string
+}
+
+// remoteBlockSignatures returns the signatures of the full blocks of
+// remotePath. The last block is left out when it is shorter.
+func remoteBlockSignatures(client *ssh.Client, remotePath string, blockSize int) ([]blockSignature, error) {
+	split := "split -b " + strconv.Itoa(blockSize) + " --filter="
+	weakOutput, err := ExecuteCommand(client, split+"cksum -- "+shellQuote(remotePath))
+	if err != nil {
+		return nil, errDeltaUnavailable
+	}
+	strongOutput, err := ExecuteCommand(client, split+"sha256sum -- "+shellQuote(remotePath))
+	if err != nil {
+		return nil, errDeltaUnavailable
+	}
+
+	weakLines := strings.Split(strings.TrimSpace(weakOutput), "\n")
+	strongLines := strings.Split(strings.TrimSpace(strongOutput), "\n")
+	if len(weakLines) != len(strongLines) {
+		return nil, fmt.Errorf("goScp: remote block signatures of %s do not line up", remotePath)
+	}
+	var signatures []blockSignature
+	for i := range weakLines {
+		weakFields := strings.Fields(weakLines[i])
+		strongFields := strings.Fields(strongLines[i])
+		if len(weakFields) != 2 || len(strongFields) == 0 {
+			return nil, fmt.Errorf("goScp: unexpected remote block signature %q", weakLines[i])
+		}
+		weak, err := strconv.ParseUint(weakFields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("goScp: unexpected remote block signature %q", weakLines[i])
+		}
+		if weakFields[1] != strconv.Itoa(blockSize) {
+			break
+		}
+		signatures = append(signatures, blockSignature{weak: uint32(weak), strong: strongFields[0]})
+	}
+	return signatures, nil
+}
+
+// cksumTable is the table of the CRC-32 used by cksum(1), which is not the
+// reflected variant of hash/crc32.
+var cksumTable = func() (table [256]uint32) {
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+func cksumUpdate(crc uint32, b byte) uint32 {
+	return crc<<8 ^ cksumTable[byte(crc>>24)^b]
+}
+
+// rollingCksum is the cksum(1) checksum of a window of a fixed size, which
+// can be moved along by one byte at a time.
+type rollingCksum struct {
+	size int
+	crc  uint32
+	// out holds what every leaving byte contributed to crc
+	out [256]uint32
+}
+
+func newRollingCksum(size int) *rollingCksum {
+	r := &rollingCksum{size: size}
+	// The contribution of a byte is linear, so the 8 single bit ones suffice
+	var bits [8]uint32
+	for bit := range bits {
+		crc := cksumUpdate(0, 1<<uint(bit))
+		for i := 0; i < size; i++ {
+			crc = cksumUpdate(crc, 0)
+		}
+		bits[bit] = crc
+	}
+	for b := range r.out {
+		for bit := range bits {
+			if b&(1<<uint(bit)) != 0 {
+				r.out[b] ^= bits[bit]
+			}
+		}
+	}
+	return r
+}
+
+// reset computes the checksum of window from scratch.
+func (r *rollingCksum) reset(window []byte) {
+	r.crc = 0
+	for _, b := range window {
+		r.crc = cksumUpdate(r.crc, b)
+	}
+}
+
+// roll moves the window by one byte, dropping out and appending in.
+func (r *rollingCksum) roll(out byte, in byte) {
+	r.crc = cksumUpdate(r.crc, in) ^ r.out[out]
+}
+
+// sum returns the checksum as printed by cksum(1), which also covers the
+// length of the window.
+func (r *rollingCksum) sum() uint32 {
+	crc := r.crc
+	for length := r.size; length > 0; length >>= 8 {
+		crc = cksumUpdate(crc, byte(length))
+	}
+	return ^crc
+}
+
+// deltaOp either copies count blocks of the old remote file starting at
+// block, or, with a negative block, length bytes of the literal data starting
+// at offset.
+type deltaOp struct {
+	block  int64
+	count  int64
+	offset int64
+	length int64
+}
+
+// delta is the difference of a local file to the remote one, as the list of
+// operations rebuilding the local file from the remote blocks and the
+// literal data.
+type delta struct {
+	ops      []deltaOp
+	literals int64
+	matched  int64
+}
+
+func (d *delta) copyBlock(block int64) {
+	if n := len(d.ops); n > 0 && d.ops[n-1].block >= 0 && d.ops[n-1].block+d.ops[n-1].count == block {
+		d.ops[n-1].count++
+	} else {
+		d.ops = append(d.ops, deltaOp{block: block, count: 1})
+	}
+	d.matched++
+}
+
+func (d *delta) literal(length int64) {
+	if length == 0 {
+		return
+	}
+	if n := len(d.ops); n > 0 && d.ops[n-1].block < 0 {
+		d.ops[n-1].length += length
+	} else {
+		d.ops = append(d.ops, deltaOp{block: -1, offset: d.literals, length: length})
+	}
+	d.literals += length
+}
+
+// computeDelta matches the blocks of the remote file against every offset of
+// local, rsync style, and writes the data no block matched to literals.
+func computeDelta(local io.Reader, signatures []blockSignature, blockSize int, literals io.Writer) (*delta, error) {
+	blocks := make(map[uint32][]int, len(signatures))
+	for i, signature := range signatures {
+		blocks[signature.weak] = append(blocks[signature.weak], i)
+	}
+
+	d := &delta{}
+	reader := bufio.NewReaderSize(local, 4*blockSize)
+	// buf holds the window starting at buf[start], and the literal bytes
+	// before it that have not been written yet
+	buf := make([]byte, 0, 4*blockSize)
+	start := 0
+	rolling := newRollingCksum(blockSize)
+	fresh := true
+	flush := func() error {
+		if _, err := literals.Write(buf[:start]); err != nil {
+			return err
+		}
+		d.literal(int64(start))
+		buf = append(buf[:0], buf[start:]...)
+		start = 0
+		return nil
+	}
+
+	for {
+		// Make sure buf holds a full window and the byte following it
+		for len(buf)-start <= blockSize {
+			if len(buf) == cap(buf) {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			b, err := reader.ReadByte()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, b)
+		}
+		if len(buf)-start < blockSize {
+			break
+		}
+
+		window := buf[start : start+blockSize]
+		if fresh {
+			rolling.reset(window)
+			fresh = false
+		}
+		if block, ok := matchBlock(blocks[rolling.sum()], signatures, window); ok {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			d.copyBlock(int64(block))
+			buf = append(buf[:0], buf[blockSize:]...)
+			fresh = true
+			continue
+		}
+		if len(buf)-start == blockSize {
+			// The end of the file, whatever is left is literal
+			break
+		}
+		rolling.roll(buf[start], buf[start+blockSize])
+		start++
+	}
+
+	start = len(buf)
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// matchBlock returns the first of candidates whose strong checksum matches
+// window.
+func matchBlock(candidates []int, signatures []blockSignature, window []byte) (int, bool) {
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	sum := sha256.Sum256(window)
+	strong := hex.EncodeToString(sum[:])
+	for _, block := range candidates {
+		if signatures[block].strong == strong {
+			return block, true
+		}
+	}
+	return 0, false
+}
+
+// uploadDelta updates remotePath to the contents of localFile by sending only
+// the data not already present in one of its blocks. The new file is
+// assembled next to the old one, checked against the SHA-256 of the local
+// file and then moved over it.
+func uploadDelta(client *ssh.Client, localFile string, remotePath string, remoteSize int64, opts ...TransferOption) error {
+	options := newTransferOptions(opts)
+
+	blockSize := deltaBlockSize(remoteSize)
+	signatures, err := remoteBlockSignatures(client, remotePath, blockSize)
+	if err != nil {
+		return err
+	}
+
+	source, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	literals, err := ioutil.TempFile("", "goscp-delta-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(literals.Name())
+	defer literals.Close()
+
+	hash := sha256.New()
+	d, err := computeDelta(io.TeeReader(source, hash), signatures, blockSize, literals)
+	if err != nil {
+		return err
+	}
+	if err := literals.Close(); err != nil {
+		return err
+	}
+
+	template := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".goscp.XXXXXX")
+	literalsPath, err := ExecuteCommand(client, "mktemp "+shellQuote(template))
+	if err != nil {
+		return err
+	}
+	literalsPath = strings.TrimSuffix(literalsPath, "\n")
+	defer removeRemoteFile(client, literalsPath)
+	literalOpts := append(append([]TransferOption(nil), opts...), WithManifest(nil))
+	if err := copyLocalFileToRemote(client, literals.Name(), literalsPath, literalOpts...); err != nil {
+		return err
+	}
+
+	script := deltaScript(d, blockSize, remotePath, literalsPath, template, options.fileMode(info.Mode()), hash)
+	if err := runRemoteScript(client, script); err != nil {
+		return fmt.Errorf("goScp: applying delta to %s: %w", remotePath, err)
+	}
+
+	if options.manifest != nil {
+		options.manifest.record(Upload, localFile, remotePath, info.Size(), hash.Sum(nil))
+	}
+	return nil
+}
+
+// runRemoteScript feeds script to a remote shell on its standard input, as it
+// can be longer than a command line may be.
+func runRemoteScript(client *ssh.Client, script string) error {
+	session, err := openSession(client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = strings.NewReader(script)
+	session.Stderr = &stderr
+	if err := session.Run("sh -s"); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+// deltaScript returns the remote shell script rebuilding remotePath from its
+// own blocks and the literal data uploaded to literalsPath.
+func deltaScript(d *delta, blockSize int, remotePath string, literalsPath string, template string, mode os.FileMode, hash hash.Hash) string {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "set -e; old=%s; literals=%s; new=$(mktemp %s); ", shellQuote(remotePath), shellQuote(literalsPath), shellQuote(template))
+	script.WriteString("trap 'rm -f \"$new\"' EXIT; { ")
+	for _, op := range d.ops {
+		if op.block >= 0 {
+			fmt.Fprintf(&script, "dd if=\"$old\" bs=%d skip=%d count=%d 2>/dev/null; ", blockSize, op.block, op.count)
+		} else {
+			fmt.Fprintf(&script, "dd if=\"$literals\" bs=65536 iflag=skip_bytes,count_bytes skip=%d count=%d 2>/dev/null; ", op.offset, op.length)
+		}
+	}
+	script.WriteString("true; } > \"$new\"; ")
+	fmt.Fprintf(&script, "[ \"$(sha256sum < \"$new\" | cut -c1-64)\" = %x ] || { echo 'checksum mismatch after applying delta' >&2; exit 1; }; ", hash.Sum(nil))
+	fmt.Fprintf(&script, "chmod %04o \"$new\"; mv -f \"$new\" \"$old\"", mode.Perm())
+	return script.String()
+}
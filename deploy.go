@@ -0,0 +1,220 @@
+package goScp
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// releaseNameLayout names releases by the time of their deployment in UTC,
+// so they sort by age.
+const releaseNameLayout = "20060102150405"
+
+// DeployOptions configures Deploy.
+type DeployOptions struct {
+	// Keep is how many releases are kept, including the new one. Older ones
+	// are removed, except the one current points to. Zero or less means 5.
+	Keep int
+	// Comparison decides which files of the previous release count as
+	// changed, see Verify. The default compares sizes and SHA-256 sums.
+	Comparison Comparison
+	// TransferOptions are applied to every upload.
+	TransferOptions []TransferOption
+}
+
+// DeployResult describes what Deploy did. Release and Previous are release
+// names, Previous is empty for the first deployment.
+type DeployResult struct {
+	Release  string
+	Previous string
+	// Unchanged is set when the files matched the current release, which is
+	// kept then instead of deploying an identical new one.
+	Unchanged bool
+	// Sync lists the files that differ from the previous release.
+	Sync   *SyncResult
+	Pruned []string
+}
+
+// Deploy uploads localDir as a new release below remoteBase, capistrano
+// style:
+//
+//	remoteBase/releases/20261015120000/
+//	remoteBase/current -> releases/20261015120000
+//
+// The new release starts as a copy of the current one, so only what changed
+// is uploaded, and current is switched to it in a single atomic rename once
+// it is complete. Running Deploy again with the same files changes nothing.
+// A release that fails halfway is removed. The atomic switch uses mv -T of
+// GNU coreutils.
+func Deploy(client *ssh.Client, localDir string, remoteBase string, opts DeployOptions) (*DeployResult, error) {
+	keep := opts.Keep
+	if keep <= 0 {
+		keep = 5
+	}
+	comparison := opts.Comparison
+	if comparison == 0 {
+		comparison = CompareSize | CompareHash
+	}
+
+	previous, err := currentRelease(client, remoteBase)
+	if err != nil {
+		return nil, err
+	}
+	result := &DeployResult{Release: time.Now().UTC().Format(releaseNameLayout), Previous: previous}
+	releaseDir := path.Join(remoteBase, "releases", result.Release)
+
+	cmd := "mkdir -p -- " + shellQuote(path.Dir(releaseDir)) + " && mkdir -- " + shellQuote(releaseDir)
+	if previous != "" {
+		cmd += " && cp -a -- " + shellQuote(path.Join(remoteBase, "releases", previous)+"/.") + " " + shellQuote(releaseDir)
+	}
+	if _, err := ExecuteCommand(client, cmd); err != nil {
+		return nil, err
+	}
+
+	result.Sync, err = Sync(client, localDir, releaseDir, SyncOptions{Comparison: comparison, Delete: true, TransferOptions: opts.TransferOptions})
+	if err == nil && previous != "" && len(result.Sync.Uploaded) == 0 && len(result.Sync.Deleted) == 0 {
+		result.Release, result.Unchanged = previous, true
+		_, err = ExecuteCommand(client, "rm -rf -- "+shellQuote(releaseDir))
+		return result, err
+	}
+	if err == nil {
+		err = switchRelease(client, remoteBase, result.Release)
+	}
+	if err != nil {
+		ExecuteCommand(client, "rm -rf -- "+shellQuote(releaseDir))
+		return nil, err
+	}
+
+	result.Pruned, err = pruneReleases(client, remoteBase, keep)
+	return result, err
+}
+
+// currentRelease returns the name of the release current points to below
+// remoteBase, empty when there is none.
+func currentRelease(client *ssh.Client, remoteBase string) (string, error) {
+	output, err := ExecuteCommand(client, "readlink -- "+shellQuote(path.Join(remoteBase, "current"))+" || true")
+	if err != nil {
+		return "", err
+	}
+	target := strings.TrimSpace(output)
+	if target == "" {
+		return "", nil
+	}
+	return path.Base(target), nil
+}
+
+// listReleases returns the names of the releases below remoteBase, oldest
+// first.
+func listReleases(client *ssh.Client, remoteBase string) ([]string, error) {
+	output, err := ExecuteCommand(client, "ls -1 -- "+shellQuote(path.Join(remoteBase, "releases"))+" 2>/dev/null || true")
+	if err != nil {
+		return nil, err
+	}
+	releases := strings.Fields(output)
+	sort.Strings(releases)
+	return releases, nil
+}
+
+// switchRelease points current below remoteBase to the release name, by
+// renaming a new link over it so it never is missing.
+func switchRelease(client *ssh.Client, remoteBase string, name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return errors.New("goScp: invalid release name " + name)
+	}
+	tmp := path.Join(remoteBase, ".current.tmp")
+	cmd := "ln -sfn -- " + shellQuote("releases/"+name) + " " + shellQuote(tmp) +
+		" && mv -T -f -- " + shellQuote(tmp) + " " + shellQuote(path.Join(remoteBase, "current"))
+	_, err := ExecuteCommand(client, cmd)
+	return err
+}
+
+// pruneReleases removes all but the newest keep releases below remoteBase,
+// never the current one, and returns the names of the removed ones.
+func pruneReleases(client *ssh.Client, remoteBase string, keep int) ([]string, error) {
+	releases, err := listReleases(client, remoteBase)
+	if err != nil || len(releases) <= keep {
+		return nil, err
+	}
+	current, err := currentRelease(client, remoteBase)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, release := range releases[:len(releases)-keep] {
+		if release != current {
+			pruned = append(pruned, release)
+		}
+	}
+	return pruned, removeRemoteTrees(client, path.Join(remoteBase, "releases"), pruned)
+}
+
+// RollbackResult describes what Rollback did. From and To are release names,
+// the file lists compare To with From by slash separated paths relative to
+// the releases.
+type RollbackResult struct {
+	From    string
+	To      string
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Rollback points current below remoteBase, as set up by Deploy, to the
+// release n releases older than the current one, e.g. the previous one for
+// n 1. No release is removed, so Deploy or Rollback with a negative n can
+// move forward again. Files count as changed when their size or
+// modification time differ.
+func Rollback(client *ssh.Client, remoteBase string, n int) (*RollbackResult, error) {
+	releases, err := listReleases(client, remoteBase)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentRelease(client, remoteBase)
+	if err != nil {
+		return nil, err
+	}
+	index := sort.SearchStrings(releases, current)
+	if current == "" || index == len(releases) || releases[index] != current {
+		return nil, errors.New("goScp: " + remoteBase + " has no current release")
+	}
+	target := index - n
+	if target < 0 || target >= len(releases) {
+		return nil, errors.New("goScp: " + remoteBase + " has no release to roll back to")
+	}
+
+	result := &RollbackResult{From: current, To: releases[target]}
+	from, err := listRemoteTree(client, path.Join(remoteBase, "releases", result.From))
+	if err != nil {
+		return nil, err
+	}
+	to, err := listRemoteTree(client, path.Join(remoteBase, "releases", result.To))
+	if err != nil {
+		return nil, err
+	}
+	for name, file := range to {
+		before, ok := from[name]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, name)
+		case before.size != file.size || !before.mtime.Equal(file.mtime):
+			result.Changed = append(result.Changed, name)
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			result.Removed = append(result.Removed, name)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+
+	if err := switchRelease(client, remoteBase, result.To); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package goScp
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"net"
+)
+
+// DialFunc opens the connection SSH runs over, like net.Dial. network is
+// always "tcp" and addr is the host and port of the RemoteHost.
+type DialFunc func(network string, addr string) (net.Conn, error)
+
+// WithDialer makes Connect open its connection with dial instead of a TCP
+// connection to the remote host, e.g. to go through a proxy or to reach
+// sshd over another address family. The RemoteHost still names the host,
+// for host key checks and logs. WithConnectTimeout covers the handshake over
+// the connection, dial has to limit itself.
+func WithDialer(dial DialFunc) ConnectOption {
+	return func(o *connectOptions) {
+		o.dialer = dial
+	}
+}
+
+// WithUnixSocket makes Connect reach sshd through the unix socket at
+// socketPath, for containers and tests where it does not listen on TCP. The
+// RemoteHost only names the host then.
+func WithUnixSocket(socketPath string) ConnectOption {
+	return WithDialer(func(network string, addr string) (net.Conn, error) {
+		return net.Dial("unix", socketPath)
+	})
+}
+
+// NewClientFromConn runs SSH over conn, a connection that was established
+// already, e.g. to a container exec stream or one end of a net.Pipe, and
+// authenticates with the same arguments as Connect. remoteMachine only names
+// the host. conn is closed when the connection fails or the returned client
+// is closed.
+func NewClientFromConn(conn net.Conn, sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool, opts ...ConnectOption) (*ssh.Client, error) {
+	used := false
+	dial := func(network string, addr string) (net.Conn, error) {
+		if used {
+			return nil, errors.New("goScp: the connection passed to NewClientFromConn was used already")
+		}
+		used = true
+		return conn, nil
+	}
+	client, err := Connect(sshKeyFile, sshCredentials, remoteMachine, usingSSHAgent, append(opts, WithDialer(dial))...)
+	if err != nil && !used {
+		conn.Close()
+	}
+	return client, err
+}
+
+// dial connects to addr with the dialer of the options, a TCP connection to
+// any address of the host by default, and runs the SSH handshake over it.
+func (o *connectOptions) dial(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dial := o.dialer
+	if dial == nil {
+		dial = o.dialAddresses
+	}
+	conn, err := dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newClientConn(conn, addr, config, o.connectTimeout)
+}
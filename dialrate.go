@@ -0,0 +1,53 @@
+package goScp
+
+import (
+	"sync"
+	"time"
+)
+
+// DialLimiter spaces out new connections, so connecting to a large fleet
+// does not open hundreds at once, which trips intrusion detection and the
+// MaxStartups limit of sshd on a shared bastion. It is shared by every
+// Connect it is passed to with WithDialLimiter.
+type DialLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewDialLimiter returns a DialLimiter letting perSecond connections start
+// every second, evenly spread. Zero or less means no limit.
+func NewDialLimiter(perSecond float64) *DialLimiter {
+	limiter := &DialLimiter{}
+	if perSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return limiter
+}
+
+// Wait blocks until the next connection may start. A nil DialLimiter never
+// blocks.
+func (l *DialLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// WithDialLimiter makes Connect wait for limiter before dialing. The wait
+// does not count towards WithConnectTimeout or the handshake duration of
+// ClientInfo.
+func WithDialLimiter(limiter *DialLimiter) ConnectOption {
+	return func(o *connectOptions) {
+		o.dialLimiter = limiter
+	}
+}
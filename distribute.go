@@ -0,0 +1,287 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DistributeOptions configures how DistributeFile connects to every host and
+// how much work it does at once.
+type DistributeOptions struct {
+	// KeyFile, Credentials and UsingSSHAgent are passed to Connect for every host.
+	KeyFile       SSHKeyfile
+	Credentials   SSHCredentials
+	UsingSSHAgent bool
+	// ConnectOptions are passed to Connect for every host.
+	ConnectOptions []ConnectOption
+	// TransferOptions are applied to the upload to every host.
+	TransferOptions []TransferOption
+
+	// Concurrency is the maximum number of hosts pushed to at the same time.
+	// Zero or less means 10.
+	Concurrency int
+	// Retries is how many more times a failed host is attempted.
+	Retries int
+	// RetryDelay is how long to wait between two attempts on the same host.
+	RetryDelay time.Duration
+	// DialsPerSecond limits how many new connections are started per second,
+	// retries included, see DialLimiter. Connections taken from the Pool do
+	// not count. Zero or less means no limit.
+	DialsPerSecond float64
+	// FailurePolicy decides whether hosts are still started once others
+	// failed, after their retries. The default is ContinueOnError. Hosts that
+	// are not started have ErrBatchStopped as their error.
+	FailurePolicy FailurePolicy
+
+	// Pool, when set, provides the connections instead of dialing a new one
+	// per host. Connections found dead after a failed transfer are evicted
+	// from it; a transfer failing on a live connection leaves it pooled for
+	// the others sharing it.
+	Pool *ClientPool
+
+	// Overrides replaces settings for single hosts, keyed by RemoteHost.Name,
+	// which is the host name of an inventory, or by RemoteHost.Host.
+	Overrides map[string]HostOverride
+}
+
+// HostOverride replaces the settings of DistributeOptions for a single host.
+// Empty fields keep the common setting.
+type HostOverride struct {
+	Username string
+	Port     string
+	// KeyFile replaces the common key and disables the SSH agent for the host,
+	// unless UsingSSHAgent is set as well.
+	KeyFile       SSHKeyfile
+	UsingSSHAgent bool
+	// RemotePath replaces the remote path passed to the operation.
+	RemotePath string
+}
+
+// apply returns target with the override applied.
+func (o HostOverride) apply(target distributeTarget) distributeTarget {
+	if o.Username != "" {
+		target.credentials.Username = o.Username
+	}
+	if o.Port != "" {
+		target.host.Port = o.Port
+	}
+	if o.KeyFile.Filename != "" {
+		target.keyFile = o.KeyFile
+		target.usingSSHAgent = false
+	}
+	if o.UsingSSHAgent {
+		target.usingSSHAgent = true
+	}
+	if o.RemotePath != "" {
+		target.remotePath = o.RemotePath
+	}
+	return target
+}
+
+// HostResult is the outcome of distributing a file to a single host.
+type HostResult struct {
+	Host     RemoteHost
+	Attempts int
+	Duration time.Duration
+	// Skipped is set when WithSkipIfIdentical found the file on the host
+	// already, Err is nil then.
+	Skipped bool
+	Err     error
+}
+
+// DistributeReport collects the HostResult of every host, in the order the
+// hosts were passed to DistributeFile.
+type DistributeReport struct {
+	Results []HostResult
+}
+
+// Succeeded returns the results of the hosts that received the file.
+func (r *DistributeReport) Succeeded() []HostResult {
+	var results []HostResult
+	for _, result := range r.Results {
+		if result.Err == nil {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Failed returns the results of the hosts that did not receive the file.
+func (r *DistributeReport) Failed() []HostResult {
+	var results []HostResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// DistributeFile uploads localPath to remotePath on every host, connecting to
+// at most opts.Concurrency hosts at a time and retrying failed hosts
+// opts.Retries times. remotePath can be a remote directory or a full file
+// path, and can hold placeholders expanded per host with ExpandPath, e.g.
+// /srv/{{.Hostname}}/app.conf. Per host errors are reported in the returned
+// report.
+func DistributeFile(localPath string, hosts []RemoteHost, remotePath string, opts DistributeOptions) *DistributeReport {
+	return distribute(hostTargets(hosts, opts), remotePath, opts, pushFile(localPath))
+}
+
+// hostTargets returns the targets for hosts, all using the settings of opts.
+func hostTargets(hosts []RemoteHost, opts DistributeOptions) []distributeTarget {
+	targets := make([]distributeTarget, len(hosts))
+	for i, host := range hosts {
+		targets[i] = distributeTarget{
+			host:          host,
+			keyFile:       opts.KeyFile,
+			credentials:   opts.Credentials,
+			usingSSHAgent: opts.UsingSSHAgent,
+		}
+	}
+	return targets
+}
+
+// distributeTarget is a host together with the settings used to connect to it
+// and the remote path to work on.
+type distributeTarget struct {
+	host          RemoteHost
+	keyFile       SSHKeyfile
+	credentials   SSHCredentials
+	usingSSHAgent bool
+	remotePath    string
+}
+
+// override returns the override of opts for target, if there is one.
+func (opts DistributeOptions) override(target distributeTarget) (HostOverride, bool) {
+	if target.host.Name != "" {
+		if override, ok := opts.Overrides[target.host.Name]; ok {
+			return override, true
+		}
+	}
+	override, ok := opts.Overrides[target.host.Host]
+	return override, ok
+}
+
+// hostAction is the work a fan-out operation does on every host.
+type hostAction func(client *ssh.Client, target distributeTarget, opts DistributeOptions) error
+
+func distribute(targets []distributeTarget, remotePath string, opts DistributeOptions, action hostAction) *DistributeReport {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	if opts.DialsPerSecond > 0 {
+		opts.ConnectOptions = append(opts.ConnectOptions[:len(opts.ConnectOptions):len(opts.ConnectOptions)], WithDialLimiter(NewDialLimiter(opts.DialsPerSecond)))
+	}
+
+	policy := opts.FailurePolicy.or(ContinueOnError)
+	var mu sync.Mutex
+	failures := 0
+
+	report := &DistributeReport{Results: make([]HostResult, len(targets))}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		if target.remotePath == "" {
+			target.remotePath = remotePath
+		}
+		if override, ok := opts.override(target); ok {
+			target = override.apply(target)
+		}
+		wg.Add(1)
+		go func(i int, target distributeTarget) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			mu.Lock()
+			stopped := policy.exceeded(failures)
+			mu.Unlock()
+			if stopped {
+				report.Results[i] = HostResult{Host: target.host, Err: ErrBatchStopped}
+				return
+			}
+			report.Results[i] = distributeToHost(target, opts, action)
+			if report.Results[i].Err != nil {
+				mu.Lock()
+				failures++
+				mu.Unlock()
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func distributeToHost(target distributeTarget, opts DistributeOptions, action hostAction) HostResult {
+	result := HostResult{Host: target.host}
+	opts.TransferOptions = append(append([]TransferOption(nil), opts.TransferOptions...), withSkipNotify(func() {
+		result.Skipped = true
+	}), withHostName(target.host.DisplayName()))
+	start := time.Now()
+	for result.Attempts <= opts.Retries {
+		if result.Attempts > 0 && opts.RetryDelay > 0 {
+			time.Sleep(opts.RetryDelay)
+		}
+		result.Attempts++
+		result.Err = runOnHost(target, opts, action)
+		if result.Err == nil {
+			break
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// runOnHost connects to target, or takes its connection from the pool, and
+// runs action on it.
+func runOnHost(target distributeTarget, opts DistributeOptions, action hostAction) error {
+	if pool := opts.Pool; pool != nil {
+		client, err := pool.Connect(target.keyFile, target.credentials, target.host, target.usingSSHAgent, opts.ConnectOptions...)
+		if err != nil {
+			return err
+		}
+		if err := action(client, target, opts); err != nil {
+			if connectionLost(client) {
+				pool.Evict(client)
+			}
+			return err
+		}
+		return nil
+	}
+
+	client, err := Connect(target.keyFile, target.credentials, target.host, target.usingSSHAgent, opts.ConnectOptions...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return action(client, target, opts)
+}
+
+// pushFile returns the action uploading localPath to the remote path of the
+// target. Templated remote paths usually name directories that do not exist
+// yet, so their parent directory is created first.
+func pushFile(localPath string) hostAction {
+	return func(client *ssh.Client, target distributeTarget, opts DistributeOptions) error {
+		remotePath, err := ExpandPath(target.remotePath, newPathVars(target, localPath))
+		if err != nil {
+			return err
+		}
+		if remotePath != target.remotePath {
+			dir := path.Dir(remotePath)
+			if strings.HasSuffix(remotePath, "/") {
+				dir = remotePath
+			}
+			if _, err := ExecuteCommand(client, "mkdir -p -- "+shellQuote(dir)); err != nil {
+				return err
+			}
+		}
+		return copyLocalFileToRemote(client, localPath, remotePath, opts.TransferOptions...)
+	}
+}
@@ -0,0 +1,157 @@
+package goScp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrDecrypt is returned when a file downloaded with WithEncryption was not
+// encrypted with the same key, or was modified on the remote host.
+var ErrDecrypt = errors.New("goScp: cannot decrypt downloaded file")
+
+// Files are encrypted in chunks, so they can be streamed. Every chunk is
+// sealed with AES-GCM using the random nonce prefix of the file and the chunk
+// number as nonce, and whether it is the last chunk as additional data, so
+// chunks can neither be reordered nor cut off.
+const (
+	encryptionMagic     = "goScpAE1"
+	encryptionChunkSize = 64 * 1024
+	noncePrefixSize     = 8
+	encryptionHeader    = len(encryptionMagic) + noncePrefixSize
+)
+
+// newAEAD returns the AES-GCM cipher for key, which must be 16, 24 or 32
+// bytes long.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns the size of a file of size bytes once encrypted.
+func encryptedSize(size int64, overhead int) int64 {
+	chunks := size / encryptionChunkSize
+	if size%encryptionChunkSize != 0 || size == 0 {
+		chunks++
+	}
+	return int64(encryptionHeader) + size + chunks*int64(overhead)
+}
+
+func chunkNonce(prefix []byte, chunk uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], chunk)
+	return nonce
+}
+
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptingReader encrypts what is read from r.
+type encryptingReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	chunk   uint32
+	pending bytes.Buffer
+	plain   []byte
+	done    bool
+}
+
+func newEncryptingReader(r io.Reader, aead cipher.AEAD) (*encryptingReader, error) {
+	e := &encryptingReader{r: bufio.NewReader(r), aead: aead, prefix: make([]byte, noncePrefixSize), plain: make([]byte, encryptionChunkSize)}
+	if _, err := rand.Read(e.prefix); err != nil {
+		return nil, err
+	}
+	e.pending.WriteString(encryptionMagic)
+	e.pending.Write(e.prefix)
+	return e, nil
+}
+
+func (e *encryptingReader) Read(b []byte) (int, error) {
+	for e.pending.Len() == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.r, e.plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		// The last chunk is the one nothing follows
+		if _, err := e.r.Peek(1); err == io.EOF {
+			e.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		e.pending.Write(e.aead.Seal(nil, chunkNonce(e.prefix, e.chunk), e.plain[:n], chunkAdditionalData(e.done)))
+		e.chunk++
+	}
+	return e.pending.Read(b)
+}
+
+// decryptingWriter decrypts what is written to it into w. Close must be
+// called once everything is written, to decrypt the last chunk.
+type decryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	chunk   uint32
+	pending []byte
+}
+
+func newDecryptingWriter(w io.Writer, aead cipher.AEAD) *decryptingWriter {
+	return &decryptingWriter{w: w, aead: aead}
+}
+
+func (d *decryptingWriter) Write(b []byte) (int, error) {
+	d.pending = append(d.pending, b...)
+	if d.prefix == nil {
+		if len(d.pending) < encryptionHeader {
+			return len(b), nil
+		}
+		if string(d.pending[:len(encryptionMagic)]) != encryptionMagic {
+			return 0, ErrDecrypt
+		}
+		d.prefix = append([]byte(nil), d.pending[len(encryptionMagic):encryptionHeader]...)
+		d.pending = d.pending[encryptionHeader:]
+	}
+	// A full chunk is only known not to be the last one once more follows
+	sealedSize := encryptionChunkSize + d.aead.Overhead()
+	for len(d.pending) > sealedSize {
+		if err := d.open(d.pending[:sealedSize], false); err != nil {
+			return 0, err
+		}
+		d.pending = d.pending[sealedSize:]
+	}
+	return len(b), nil
+}
+
+// Close decrypts the last chunk.
+func (d *decryptingWriter) Close() error {
+	if d.prefix == nil {
+		return ErrDecrypt
+	}
+	return d.open(d.pending, true)
+}
+
+func (d *decryptingWriter) open(sealed []byte, last bool) error {
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.chunk), sealed, chunkAdditionalData(last))
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.chunk++
+	_, err = d.w.Write(plain)
+	return err
+}
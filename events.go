@@ -0,0 +1,132 @@
+package goScp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType tells what happened to a transfer.
+type EventType string
+
+const (
+	EventStarted   EventType = "started"
+	EventProgress  EventType = "progress"
+	EventCompleted EventType = "completed"
+	EventFailed    EventType = "failed"
+	EventSkipped   EventType = "skipped"
+)
+
+// progressEventInterval is the minimum time between two progress events of
+// the same transfer.
+const progressEventInterval = 500 * time.Millisecond
+
+// Event is a machine readable record of transfer activity. Total is 0 while
+// the size of the file is not known yet.
+type Event struct {
+	Type EventType `json:"type"`
+	// Host is the name of the host of a fan-out operation, see
+	// RemoteHost.DisplayName, and empty otherwise.
+	Host        string    `json:"host,omitempty"`
+	Direction   Direction `json:"direction"`
+	LocalPath   string    `json:"local_path"`
+	RemotePath  string    `json:"remote_path"`
+	Transferred int64     `json:"transferred"`
+	Total       int64     `json:"total"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// EventSink receives the events of the transfers it is passed to with
+// WithEvents. It is called from the transferring goroutines, so sinks shared
+// between transfers must be safe for concurrent use.
+type EventSink func(Event)
+
+// NewJSONEventSink returns an EventSink writing every event to w as a single
+// line of JSON, for CI systems and wrappers to parse.
+func NewJSONEventSink(w io.Writer) EventSink {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(event)
+	}
+}
+
+// NewChannelEventSink returns an EventSink sending every event to events. The
+// transfers block while events is full.
+func NewChannelEventSink(events chan<- Event) EventSink {
+	return func(event Event) {
+		events <- event
+	}
+}
+
+// transferEvents emits the events of a single transfer.
+type transferEvents struct {
+	sink         EventSink
+	event        Event
+	transferred  int64
+	total        int64
+	lastProgress time.Time
+}
+
+func (e *transferEvents) emit(eventType EventType, transferred int64, total int64, err error) {
+	event := e.event
+	event.Type = eventType
+	event.Transferred = transferred
+	event.Total = total
+	if err != nil {
+		event.Error = err.Error()
+	}
+	event.Time = time.Now().UTC()
+	e.sink(event)
+}
+
+// progress emits a progress event, unless one was emitted very recently and
+// the transfer is not done yet.
+func (e *transferEvents) progress(transferred int64, total int64) {
+	e.transferred = transferred
+	if transferred != total && time.Since(e.lastProgress) < progressEventInterval {
+		return
+	}
+	e.lastProgress = time.Now()
+	e.emit(EventProgress, transferred, total, nil)
+}
+
+// begin starts the timer of WithTimeout and emits the events of the transfer
+// between localPath and remotePath, when the options ask for them. Every
+// begin is followed by a deferred finish.
+func (o *transferOptions) begin(direction Direction, localPath string, remotePath string, total int64) {
+	if o.timeout > 0 {
+		o.ctx, o.cancelTimeout = context.WithTimeout(o.transferContext(), o.timeout)
+	}
+	if o.eventSink == nil {
+		return
+	}
+	o.events = &transferEvents{
+		sink:  o.eventSink,
+		event: Event{Host: o.hostName, Direction: direction, LocalPath: localPath, RemotePath: remotePath},
+		total: total,
+	}
+	o.events.emit(EventStarted, 0, total, nil)
+}
+
+// finish emits the completed or failed event of the transfer started with
+// begin, and releases the timer of WithTimeout.
+func (o *transferOptions) finish(err error) {
+	if o.cancelTimeout != nil {
+		o.cancelTimeout()
+	}
+	if o.events == nil {
+		return
+	}
+	if err != nil {
+		o.events.emit(EventFailed, o.events.transferred, o.events.total, err)
+	} else {
+		o.events.emit(EventCompleted, o.events.transferred, o.events.total, nil)
+	}
+	o.events = nil
+}
@@ -0,0 +1,177 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ErrExpectFailed is matched by errors.Is for every *ExpectError.
+var ErrExpectFailed = errors.New("goScp: expected output did not arrive")
+
+// ExpectError reports output RunExpect waited for in vain.
+type ExpectError struct {
+	Pattern string
+	// Output is what arrived after the previous match.
+	Output string
+	// Exited is set when the session ended first, else the wait timed out.
+	Exited bool
+}
+
+func (e *ExpectError) Error() string {
+	if e.Exited {
+		return fmt.Sprintf("goScp: session ended before output matched %q", e.Pattern)
+	}
+	return fmt.Sprintf("goScp: no output matched %q in time", e.Pattern)
+}
+
+// Is lets errors.Is match an *ExpectError against ErrExpectFailed.
+func (e *ExpectError) Is(target error) bool {
+	return target == ErrExpectFailed
+}
+
+// ExpectStep is a step of RunExpect: waiting for output matching a pattern,
+// then optionally answering it.
+type ExpectStep struct {
+	pattern  string
+	response string
+	send     bool
+}
+
+// Expect waits for output matching the regular expression pattern, e.g.
+// `[Pp]assword: ?$`. Only output after the previous match is searched.
+func Expect(pattern string) ExpectStep {
+	return ExpectStep{pattern: pattern}
+}
+
+// Send sends response followed by a line break once the output matched.
+func (s ExpectStep) Send(response string) ExpectStep {
+	s.response, s.send = response, true
+	return s
+}
+
+// RunExpect runs cmd, or an interactive shell when it is empty, on a pseudo
+// terminal and goes through steps, like the expect tool:
+//
+//	transcript, err := RunExpect(client, "", 30*time.Second,
+//		Expect(`[Pp]assword: ?$`).Send(enablePassword),
+//		Expect(`#\s*$`).Send("show version"),
+//		Expect(`#\s*$`).Send("exit"),
+//	)
+//
+// It is meant for devices that only offer an interactive CLI, or programs
+// insisting on a terminal. Every step may take timeout, otherwise RunExpect
+// fails with an *ExpectError. Input is not echoed, so responses such as
+// passwords do not show up in the transcript, which is everything the
+// session wrote. Once all steps are done, input is closed and the session
+// gets another timeout to end before it is closed.
+func RunExpect(client *ssh.Client, cmd string, timeout time.Duration, steps ...ExpectStep) (transcript string, err error) {
+	patterns := make([]*regexp.Regexp, len(steps))
+	for i, step := range steps {
+		if patterns[i], err = regexp.Compile(step.pattern); err != nil {
+			return "", err
+		}
+	}
+
+	session, err := openSession(client)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err := session.RequestPty("vt100", 40, 200, modes); err != nil {
+		return "", err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if cmd == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(cmd)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	chunks := readChunks(stdout, done)
+
+	var output []byte
+	matched := 0
+	for i, step := range steps {
+		timer := time.NewTimer(timeout)
+		for {
+			if location := patterns[i].FindIndex(output[matched:]); location != nil {
+				matched += location[1]
+				break
+			}
+			select {
+			case chunk, ok := <-chunks:
+				if ok {
+					output = append(output, chunk...)
+					continue
+				}
+				timer.Stop()
+				return string(output), &ExpectError{Pattern: step.pattern, Output: string(output[matched:]), Exited: true}
+			case <-timer.C:
+				return string(output), &ExpectError{Pattern: step.pattern, Output: string(output[matched:])}
+			}
+		}
+		timer.Stop()
+		if step.send {
+			if _, err := io.WriteString(stdin, step.response+"\n"); err != nil {
+				return string(output), err
+			}
+		}
+	}
+
+	stdin.Close()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if ok {
+				output = append(output, chunk...)
+				continue
+			}
+			return string(output), session.Wait()
+		case <-timer.C:
+			return string(output), nil
+		}
+	}
+}
+
+// readChunks passes what is read from r to the returned channel until r
+// fails, then closes it. It gives up once done is closed.
+func readChunks(r io.Reader, done <-chan struct{}) <-chan []byte {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buffer := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buffer)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buffer[:n]...):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return chunks
+}
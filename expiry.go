@@ -0,0 +1,40 @@
+package goScp
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"math"
+	"path"
+	"strings"
+	"time"
+)
+
+// scheduleRemoteRemoval makes the remote host delete remotePath once ttl has
+// passed. It prefers a transient systemd timer, then at(1), and falls back to a
+// detached sleep only when neither is installed. Failing to schedule with an
+// installed one is an error, as is a directory the file cannot be removed
+// from.
+func scheduleRemoteRemoval(client *ssh.Client, remotePath string, ttl time.Duration) error {
+	if !path.IsAbs(remotePath) {
+		home, err := ExecuteCommand(client, "pwd")
+		if err != nil {
+			return err
+		}
+		remotePath = path.Join(strings.TrimSuffix(home, "\n"), remotePath)
+	}
+
+	seconds := int64(math.Ceil(ttl.Seconds()))
+	minutes := int64(math.Ceil(ttl.Minutes()))
+	dir := path.Dir(remotePath)
+	remove := "rm -f -- " + shellQuote(remotePath)
+	var script strings.Builder
+	fmt.Fprintf(&script, "test -w %s || { echo %s >&2; exit 1; }\n", shellQuote(dir), shellQuote("cannot remove files from "+dir))
+	fmt.Fprintf(&script, "if command -v systemd-run >/dev/null 2>&1 && systemd-run --user --quiet --on-active=%d %s; then exit 0; fi\n", seconds, remove)
+	fmt.Fprintf(&script, "if command -v at >/dev/null 2>&1; then out=$(echo %s | at now + %d minutes 2>&1) && exit 0; echo \"$out\" >&2; exit 1; fi\n", shellQuote(remove), minutes)
+	script.WriteString("if command -v systemd-run >/dev/null 2>&1; then exit 1; fi\n")
+	fmt.Fprintf(&script, "nohup sh -c %s </dev/null >/dev/null 2>&1 &\n", shellQuote(fmt.Sprintf("sleep %d; %s", seconds, remove)))
+	if err := runRemoteScript(client, script.String()); err != nil {
+		return fmt.Errorf("goScp: scheduling the removal of %s: %w", remotePath, err)
+	}
+	return nil
+}
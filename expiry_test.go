@@ -0,0 +1,62 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSchedulers puts systemd-run and at running script first in the PATH of
+// the goScptest server, which runs commands with the environment of the test.
+func fakeSchedulers(t *testing.T, script string) {
+	t.Helper()
+	bin := t.TempDir()
+	for _, name := range []string{"systemd-run", "at"} {
+		if err := ioutil.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRemoteTTLSchedulesRemoval(t *testing.T) {
+	_, client, root := startServer(t)
+	scheduled := filepath.Join(t.TempDir(), "scheduled")
+	fakeSchedulers(t, `echo "$0 $*" >> `+scheduled)
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "secret.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := goScp.CopyLocalFileToRemote(client, localDir, "secret.txt", goScp.WithRemoteTTL(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	calls, err := ioutil.ReadFile(scheduled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(calls), "systemd-run --user --quiet --on-active=90 rm -f -- "+filepath.Join(root, "secret.txt")) {
+		t.Errorf("scheduled %q", calls)
+	}
+}
+
+func TestRemoteTTLReportsSchedulingFailure(t *testing.T) {
+	_, client, _ := startServer(t)
+	fakeSchedulers(t, `echo "$0: no user session" >&2; exit 1`)
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "secret.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := goScp.CopyLocalFileToRemote(client, localDir, "secret.txt", goScp.WithRemoteTTL(time.Minute))
+	if err == nil {
+		t.Fatal("upload succeeded without scheduling the removal")
+	}
+	if !strings.Contains(err.Error(), "no user session") {
+		t.Errorf("error %q does not carry the scheduler output", err)
+	}
+}
@@ -0,0 +1,40 @@
+package goScp
+
+// FailurePolicy decides whether an operation on many files or hosts starts
+// the next ones after some have failed. The zero value is the default of the
+// operation.
+type FailurePolicy struct {
+	set bool
+	// maxFailures is how many failures are tolerated, -1 for any number.
+	maxFailures int
+}
+
+var (
+	// FailFast stops at the first failure.
+	FailFast = FailurePolicy{set: true, maxFailures: 0}
+	// ContinueOnError goes on whatever fails, so one bad host does not keep
+	// the others from getting their files.
+	ContinueOnError = FailurePolicy{set: true, maxFailures: -1}
+)
+
+// MaxFailures goes on until more than n items failed. MaxFailures(0) is
+// FailFast.
+func MaxFailures(n int) FailurePolicy {
+	if n < 0 {
+		n = 0
+	}
+	return FailurePolicy{set: true, maxFailures: n}
+}
+
+// or returns p, or fallback when p is the zero value.
+func (p FailurePolicy) or(fallback FailurePolicy) FailurePolicy {
+	if !p.set {
+		return fallback
+	}
+	return p
+}
+
+// exceeded reports whether failures is more than the policy tolerates.
+func (p FailurePolicy) exceeded(failures int) bool {
+	return p.maxFailures >= 0 && failures > p.maxFailures
+}
@@ -1,23 +1,40 @@
 package goScp
 
 import (
+	"crypto/sha256"
+	"hash"
+	"io"
 	"log"
 	"os"
-	"strings"
 )
 
-func createNewFile(filename string) *os.File {
-	file, err := os.Create(strings.TrimSpace(filename))
+func createNewFile(filename string) (*os.File, error) {
+	return os.Create(filename)
+}
+
+func writeParitalToFile(file *os.File, content []byte) {
+	_, err := file.Write(content)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	return file
+func sha256File(filename string) ([]byte, error) {
+	return hashFile(filename, sha256.New)
 }
 
-func writeParitalToFile(file *os.File, content []byte) {
-	_, err := file.Write(content)
+// hashFile returns the sum of the contents of filename with the hash newHash
+// returns.
+func hashFile(filename string, newHash func() hash.Hash) ([]byte, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := newHash()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
 	}
+	return hash.Sum(nil), nil
 }
@@ -0,0 +1,75 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+)
+
+// ForwardLocalPort listens on localAddr and tunnels every connection made to
+// it through client to remoteAddr, like ssh -L. Forwarding stops when the
+// returned listener is closed.
+func ForwardLocalPort(client *ssh.Client, localAddr string, remoteAddr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go forwardConnections(listener, func() (net.Conn, error) {
+		return client.Dial("tcp", remoteAddr)
+	})
+	return listener, nil
+}
+
+// ForwardRemotePort asks the remote host to listen on remoteAddr and tunnels
+// every connection made to it back to localAddr, like ssh -R. Forwarding stops
+// when the returned listener is closed.
+func ForwardRemotePort(client *ssh.Client, remoteAddr string, localAddr string) (net.Listener, error) {
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go forwardConnections(listener, func() (net.Conn, error) {
+		return net.Dial("tcp", localAddr)
+	})
+	return listener, nil
+}
+
+// forwardConnections accepts connections on listener until it is closed and
+// joins each of them with a connection returned by dial.
+func forwardConnections(listener net.Listener, dial func() (net.Conn, error)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			target, err := dial()
+			if err != nil {
+				conn.Close()
+				return
+			}
+			joinConnections(conn, target)
+		}(conn)
+	}
+}
+
+// joinConnections copies data between a and b in both directions and closes
+// both once either side is done.
+func joinConnections(a net.Conn, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
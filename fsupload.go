@@ -0,0 +1,86 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io/fs"
+	"path"
+)
+
+// CopyFSToRemote uploads every file below root in fsys to remoteDir, keeping
+// the directory layout, so e.g. assets embedded with go:embed can be pushed
+// without extracting them to disk first. Use "." as root for the whole fsys.
+// Files excluded by the IgnoreFileName files below root are left out.
+func CopyFSToRemote(client *ssh.Client, fsys fs.FS, root string, remoteDir string, opts ...TransferOption) error {
+	options := newTransferOptions(opts)
+
+	rootFS, err := fs.Sub(fsys, root)
+	if err != nil {
+		return err
+	}
+	ignore := newFSIgnoreMatcher(rootFS)
+
+	var names []string
+	err = fs.WalkDir(fsys, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != root {
+			ignored, err := ignore.ignored(relativeFSPath(root, name), entry.IsDir())
+			if err != nil {
+				return err
+			}
+			if ignored && entry.IsDir() {
+				return fs.SkipDir
+			}
+			if ignored {
+				return nil
+			}
+		}
+		if entry.Type().IsRegular() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	relative := make([]string, len(names))
+	for i, name := range names {
+		relative[i] = relativeFSPath(root, name)
+	}
+	if err := createRemoteDirs(client, remoteDir, relative); err != nil {
+		return err
+	}
+	for i, name := range names {
+		if err := copyFSFileToRemote(client, fsys, name, path.Join(remoteDir, relative[i]), options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFSFileToRemote uploads the file name of fsys to remotePath.
+func copyFSFileToRemote(client *ssh.Client, fsys fs.FS, name string, remotePath string, options *transferOptions) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return copyOpenFileToRemote(client, file, info, name, remotePath, path.Base(remotePath), options)
+}
+
+// relativeFSPath returns name relative to root, both being fs.FS paths.
+func relativeFSPath(root string, name string) string {
+	if root == "." {
+		return name
+	}
+	if name == root {
+		return path.Base(name)
+	}
+	return name[len(root)+1:]
+}
@@ -0,0 +1,215 @@
+// Package goScptest provides test helpers for code using goScp: an in-memory
+// fake of the client interfaces for unit tests, and an in-process SSH server
+// speaking scp and SFTP for integration tests.
+package goScptest
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call is a single recorded method call of a FakeTransferrer.
+type Call struct {
+	Method string
+	Args   []string
+}
+
+// FakeTransferrer implements goScp.Transferrer on top of an in-memory remote
+// filesystem. It records every call and is safe for concurrent use.
+type FakeTransferrer struct {
+	// Errors makes the method with the given name, e.g. "Upload", fail with
+	// the error instead of doing anything.
+	Errors map[string]error
+
+	mu    sync.Mutex
+	files map[string]fakeFile
+	calls []Call
+}
+
+type fakeFile struct {
+	content []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+var (
+	_ goScp.Transferrer = (*FakeTransferrer)(nil)
+	_ goScp.Linker      = (*FakeTransferrer)(nil)
+)
+
+// NewFakeTransferrer returns a FakeTransferrer with an empty remote filesystem.
+func NewFakeTransferrer() *FakeTransferrer {
+	return &FakeTransferrer{
+		Errors: map[string]error{},
+		files:  map[string]fakeFile{},
+	}
+}
+
+// SetFile puts a remote file with content at remotePath, for Download, List
+// and Stat to serve.
+func (f *FakeTransferrer) SetFile(remotePath string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[path.Clean(remotePath)] = fakeFile{content: content, mode: 0644, modTime: time.Now()}
+}
+
+// File returns the content of the remote file at remotePath.
+func (f *FakeTransferrer) File(remotePath string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[path.Clean(remotePath)]
+	return file.content, ok
+}
+
+// Calls returns every call made so far, in order.
+func (f *FakeTransferrer) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// record logs a call and returns the error configured for method.
+func (f *FakeTransferrer) record(method string, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	return f.Errors[method]
+}
+
+// Name returns "fake".
+func (f *FakeTransferrer) Name() string {
+	return "fake"
+}
+
+// Upload stores the content of localFile at remotePath.
+func (f *FakeTransferrer) Upload(localFile string, remotePath string, opts ...goScp.TransferOption) error {
+	if err := f.record("Upload", localFile, remotePath); err != nil {
+		return err
+	}
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(localFile)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[path.Clean(remotePath)] = fakeFile{content: content, mode: info.Mode().Perm(), modTime: time.Now()}
+	return nil
+}
+
+// Download writes the content stored at remotePath to localFile.
+func (f *FakeTransferrer) Download(remotePath string, localFile string, opts ...goScp.TransferOption) error {
+	if err := f.record("Download", remotePath, localFile); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	file, ok := f.files[path.Clean(remotePath)]
+	f.mu.Unlock()
+	if !ok {
+		return &os.PathError{Op: "open", Path: remotePath, Err: os.ErrNotExist}
+	}
+	return ioutil.WriteFile(localFile, file.content, file.mode)
+}
+
+// Link stores a copy of the file at target at remotePath as well, the fake
+// does not share content between names.
+func (f *FakeTransferrer) Link(target string, remotePath string) error {
+	if err := f.record("Link", target, remotePath); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[path.Clean(target)]
+	if !ok {
+		return &os.PathError{Op: "link", Path: target, Err: os.ErrNotExist}
+	}
+	f.files[path.Clean(remotePath)] = file
+	return nil
+}
+
+// List describes the files and implied directories directly below remoteDir.
+func (f *FakeTransferrer) List(remoteDir string) ([]goScp.RemoteFileInfo, error) {
+	if err := f.record("List", remoteDir); err != nil {
+		return nil, err
+	}
+	dir := path.Clean(remoteDir)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries := map[string]goScp.RemoteFileInfo{}
+	for name, file := range f.files {
+		rel := strings.TrimPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+		if rel == name {
+			continue
+		}
+		if i := strings.Index(rel, "/"); i >= 0 {
+			entries[rel[:i]] = goScp.RemoteFileInfo{Name: rel[:i], Mode: os.ModeDir | 0755}
+			continue
+		}
+		entries[rel] = fakeFileInfo(rel, file)
+	}
+	if len(entries) == 0 && !f.isDir(dir) {
+		return nil, &os.PathError{Op: "readdir", Path: remoteDir, Err: os.ErrNotExist}
+	}
+
+	infos := make([]goScp.RemoteFileInfo, 0, len(entries))
+	for _, info := range entries {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Stat describes the file or implied directory at remotePath.
+func (f *FakeTransferrer) Stat(remotePath string) (goScp.RemoteFileInfo, error) {
+	if err := f.record("Stat", remotePath); err != nil {
+		return goScp.RemoteFileInfo{}, err
+	}
+	name := path.Clean(remotePath)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if file, ok := f.files[name]; ok {
+		return fakeFileInfo(path.Base(name), file), nil
+	}
+	if f.isDir(name) {
+		return goScp.RemoteFileInfo{Name: path.Base(name), Mode: os.ModeDir | 0755}, nil
+	}
+	return goScp.RemoteFileInfo{}, &os.PathError{Op: "stat", Path: remotePath, Err: os.ErrNotExist}
+}
+
+// Close records the call and does nothing else.
+func (f *FakeTransferrer) Close() error {
+	return f.record("Close")
+}
+
+// isDir reports whether any stored file lives below dir. f.mu must be held.
+func (f *FakeTransferrer) isDir(dir string) bool {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for name := range f.files {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeFileInfo(name string, file fakeFile) goScp.RemoteFileInfo {
+	return goScp.RemoteFileInfo{
+		Name:    name,
+		Size:    int64(len(file.content)),
+		Mode:    file.mode,
+		ModTime: file.modTime,
+	}
+}
@@ -0,0 +1,63 @@
+package goScptest_test
+
+import (
+	"errors"
+	"github.com/kalfke/go-scp/goScptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFakeTransferrerFiles(t *testing.T) {
+	fake := goScptest.NewFakeTransferrer()
+	fake.SetFile("/srv/./motd", []byte("welcome\n"))
+
+	if contents, ok := fake.File("/srv/motd"); !ok || string(contents) != "welcome\n" {
+		t.Errorf("File = %q, %v", contents, ok)
+	}
+	if _, ok := fake.File("/srv/other"); ok {
+		t.Error("File found a file that was never set")
+	}
+	if _, err := fake.Stat("/srv/other"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing file: got %v, want os.ErrNotExist", err)
+	}
+
+	local := filepath.Join(t.TempDir(), "motd")
+	if err := fake.Download("/srv/motd", local); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Upload(local, "/backup/motd"); err != nil {
+		t.Fatal(err)
+	}
+	if contents, ok := fake.File("/backup/motd"); !ok || string(contents) != "welcome\n" {
+		t.Errorf("uploaded file = %q, %v", contents, ok)
+	}
+}
+
+func TestFakeTransferrerErrorsAndCalls(t *testing.T) {
+	fake := goScptest.NewFakeTransferrer()
+	refused := errors.New("permission denied")
+	fake.Errors["Upload"] = refused
+
+	local := filepath.Join(t.TempDir(), "report")
+	if err := ioutil.WriteFile(local, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Upload(local, "/srv/report"); err != refused {
+		t.Errorf("Upload: got %v, want the configured error", err)
+	}
+	if _, ok := fake.File("/srv/report"); ok {
+		t.Error("a failed Upload stored the file")
+	}
+	fake.List("/srv")
+
+	want := []goScptest.Call{
+		{Method: "Upload", Args: []string{local, "/srv/report"}},
+		{Method: "List", Args: []string{"/srv"}},
+	}
+	if calls := fake.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("Calls = %+v, want %+v", calls, want)
+	}
+}
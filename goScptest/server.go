@@ -0,0 +1,504 @@
+package goScptest
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/kalfke/go-scp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-process SSH server for integration tests. It speaks the scp
+// protocol and the SFTP subsystem on top of a local directory, and accepts
+// every user without authentication.
+//
+// Remote paths are resolved below Root, absolute ones included. Commands other
+// than scp are run with the local /bin/sh inside Root, so only use it with
+// commands under the test's own control.
+type Server struct {
+	Root string
+	// Embedded makes the scp of the server behave like the Dropbear scp found
+	// on BusyBox based routers: it is only found as "scp" in the PATH, not as
+	// /usr/bin/scp, it sends the times of files unasked and it sends modes of
+	// three digits, e.g. C644. Set it before connecting.
+	Embedded bool
+	// SCPCommand runs scp commands with an external scp program instead of
+	// the built-in one, e.g. "busybox scp", to test against a real
+	// implementation. It runs inside Root like other commands, so absolute
+	// paths are not confined to Root then.
+	SCPCommand string
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.Signer
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a Server on a random local port serving root.
+func NewServer(root string) (*Server, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+	s := &Server{Root: root, listener: listener, config: config, hostKey: hostKey}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// RemoteHost returns the address of the server for goScp.Connect.
+func (s *Server) RemoteHost() goScp.RemoteHost {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	return goScp.RemoteHost{Host: host, Port: port}
+}
+
+// HostKey returns the public host key of the server.
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.hostKey.PublicKey()
+}
+
+// Dial connects to the server as user.
+func (s *Server) Dial(user string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", s.Addr(), &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey()),
+	})
+}
+
+// Close stops accepting connections and waits for the accept loop to end.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, channelRequests)
+	}
+}
+
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	var env []string
+	for request := range requests {
+		switch request.Type {
+		case "env":
+			var payload struct{ Name, Value string }
+			ssh.Unmarshal(request.Payload, &payload)
+			env = append(env, payload.Name+"="+payload.Value)
+			request.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(request.Payload, &payload)
+			request.Reply(true, nil)
+			go func(cmd string, env []string) {
+				status := s.exec(channel, cmd, env)
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				channel.Close()
+			}(payload.Command, env)
+		case "subsystem":
+			var payload struct{ Name string }
+			ssh.Unmarshal(request.Payload, &payload)
+			if payload.Name != "sftp" {
+				request.Reply(false, nil)
+				continue
+			}
+			request.Reply(true, nil)
+			go func() {
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.Root))
+				if err == nil {
+					server.Serve()
+				}
+				channel.Close()
+			}()
+		default:
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// exec runs cmd on channel and returns its exit status.
+func (s *Server) exec(channel ssh.Channel, cmd string, env []string) uint32 {
+	args := splitCommand(cmd)
+	if len(args) > 0 && s.Embedded && args[0] != "scp" && path.Base(args[0]) == "scp" {
+		fmt.Fprintf(channel.Stderr(), "sh: %s: not found\n", args[0])
+		return 127
+	}
+	command := exec.Command("/bin/sh", "-c", cmd)
+	if len(args) > 0 && path.Base(args[0]) == "scp" {
+		if s.SCPCommand == "" {
+			if err := s.scp(channel, args[1:]); err != nil {
+				fmt.Fprintf(channel.Stderr(), "scp: %v\n", err)
+				return 1
+			}
+			return 0
+		}
+		words := append(splitCommand(s.SCPCommand), args[1:]...)
+		command = exec.Command(words[0], words[1:]...)
+	}
+	command.Dir = s.Root
+	command.Env = append(os.Environ(), env...)
+	command.Stdout = channel
+	command.Stderr = channel.Stderr()
+	// Like sshd, do not wait for the client to close stdin once the command
+	// exited
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return 127
+	}
+	go func() {
+		io.Copy(stdin, channel)
+		stdin.Close()
+	}()
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return uint32(exitErr.ExitCode())
+		}
+		return 127
+	}
+	return 0
+}
+
+// resolve maps a remote path below Root.
+func (s *Server) resolve(remotePath string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(path.Clean("/"+remotePath)))
+}
+
+// scp runs the remote side of the scp protocol for the arguments of an scp
+// command line.
+func (s *Server) scp(channel ssh.Channel, args []string) error {
+	var sink, source, recursive, preserve bool
+	var paths []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			paths = append(paths, arg)
+			continue
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 't':
+				sink = true
+			case 'f':
+				source = true
+			case 'r':
+				recursive = true
+			case 'p':
+				preserve = true
+			}
+		}
+	}
+
+	reader := bufio.NewReader(channel)
+	switch {
+	case sink && len(paths) == 1:
+		return s.scpSink(channel, reader, s.resolve(paths[0]))
+	case source:
+		if err := readAck(reader); err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if err := s.scpSend(channel, reader, s.resolve(p), recursive, preserve); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("unsupported arguments")
+}
+
+// scpSink receives files and directories into target.
+func (s *Server) scpSink(channel ssh.Channel, reader *bufio.Reader, target string) error {
+	info, err := os.Stat(target)
+	targetIsDir := err == nil && info.IsDir()
+	var dirs []string
+	var mtime time.Time
+
+	channel.Write([]byte{0})
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return errors.New("protocol error: empty record")
+		}
+
+		destination := func(name string) string {
+			switch {
+			case len(dirs) > 0:
+				return filepath.Join(dirs[len(dirs)-1], name)
+			case targetIsDir:
+				return filepath.Join(target, name)
+			}
+			return target
+		}
+
+		switch line[0] {
+		case 'T':
+			fields := strings.Fields(line[1:])
+			if len(fields) != 4 {
+				return fmt.Errorf("protocol error: bad time record %q", line)
+			}
+			seconds, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("protocol error: bad time record %q", line)
+			}
+			mtime = time.Unix(seconds, 0)
+		case 'C':
+			mode, size, name, err := parseRecord(line)
+			if err != nil {
+				return err
+			}
+			channel.Write([]byte{0})
+			file := destination(name)
+			if err := receiveFile(reader, file, mode, size); err != nil {
+				return err
+			}
+			if !mtime.IsZero() {
+				os.Chtimes(file, mtime, mtime)
+				mtime = time.Time{}
+			}
+		case 'D':
+			mode, _, name, err := parseRecord(line)
+			if err != nil {
+				return err
+			}
+			dir := destination(name)
+			if err := os.MkdirAll(dir, mode); err != nil {
+				return err
+			}
+			dirs = append(dirs, dir)
+		case 'E':
+			if len(dirs) == 0 {
+				return errors.New("protocol error: unexpected end of directory")
+			}
+			dirs = dirs[:len(dirs)-1]
+		default:
+			return fmt.Errorf("protocol error: unexpected record %q", line)
+		}
+		channel.Write([]byte{0})
+	}
+}
+
+// receiveFile writes the size bytes of a C record and consumes the status byte
+// following them.
+func receiveFile(reader *bufio.Reader, name string, mode os.FileMode, size int64) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.CopyN(file, reader, size); err != nil {
+		return err
+	}
+	if err := readAck(reader); err != nil {
+		return err
+	}
+	return file.Chmod(mode)
+}
+
+// scpSend sends name, recursing into directories when recursive is set.
+func (s *Server) scpSend(channel ssh.Channel, reader *bufio.Reader, name string, recursive bool, preserve bool) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if preserve || s.Embedded {
+		fmt.Fprintf(channel, "T%d 0 %d 0\n", info.ModTime().Unix(), info.ModTime().Unix())
+		if err := readAck(reader); err != nil {
+			return err
+		}
+	}
+
+	if info.IsDir() {
+		if !recursive {
+			return fmt.Errorf("%s: not a regular file", filepath.Base(name))
+		}
+		fmt.Fprintf(channel, "D%04o 0 %s\n", info.Mode().Perm(), info.Name())
+		if err := readAck(reader); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := s.scpSend(channel, reader, filepath.Join(name, entry.Name()), recursive, preserve); err != nil {
+				return err
+			}
+		}
+		fmt.Fprint(channel, "E\n")
+		return readAck(reader)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	modeFormat := "C%04o %d %s\n"
+	if s.Embedded {
+		modeFormat = "C%03o %d %s\n"
+	}
+	fmt.Fprintf(channel, modeFormat, info.Mode().Perm(), info.Size(), info.Name())
+	if err := readAck(reader); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(channel, file, info.Size()); err != nil {
+		return err
+	}
+	channel.Write([]byte{0})
+	return readAck(reader)
+}
+
+// parseRecord parses a C or D record, e.g. "C0644 12 name".
+func parseRecord(line string) (os.FileMode, int64, string, error) {
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("protocol error: bad record %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("protocol error: bad mode in %q", line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("protocol error: bad size in %q", line)
+	}
+	name := fields[2]
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, 0, "", fmt.Errorf("protocol error: bad file name in %q", line)
+	}
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+// readAck reads a status byte sent by the client.
+func readAck(reader *bufio.Reader) error {
+	status, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		message, _ := reader.ReadString('\n')
+		return fmt.Errorf("client error: %s", strings.TrimSpace(message))
+	}
+	return nil
+}
+
+// splitCommand splits a shell command line into words, honoring single and
+// double quotes and backslash escapes.
+func splitCommand(cmd string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,103 @@
+package goScptest_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"github.com/kalfke/go-scp/goScptest"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTransferrers runs the same transfers through the fake and through every
+// backend talking to the server, which have to agree.
+func TestTransferrers(t *testing.T) {
+	backends := map[string]func(t *testing.T) goScp.Transferrer{
+		"fake": func(t *testing.T) goScp.Transferrer {
+			return goScptest.NewFakeTransferrer()
+		},
+		"scp": func(t *testing.T) goScp.Transferrer {
+			return goScp.NewSCPTransferrer(dialServer(t))
+		},
+		"sftp": func(t *testing.T) goScp.Transferrer {
+			transferrer, err := goScp.NewSFTPTransferrer(dialServer(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return transferrer
+		},
+		"tar": func(t *testing.T) goScp.Transferrer {
+			return goScp.NewTarTransferrer(dialServer(t))
+		},
+	}
+	for name, newTransferrer := range backends {
+		t.Run(name, func(t *testing.T) {
+			transferrer := newTransferrer(t)
+			defer transferrer.Close()
+
+			localDir := t.TempDir()
+			upload := filepath.Join(localDir, "upload.txt")
+			if err := ioutil.WriteFile(upload, []byte("hello, server\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := transferrer.Upload(upload, "dir/report 1.txt"); err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+
+			info, err := transferrer.Stat("dir/report 1.txt")
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Name != "report 1.txt" || info.Size != 14 || info.IsDir() {
+				t.Errorf("Stat = %+v, want a file report 1.txt of 14 bytes", info)
+			}
+			if info, err := transferrer.Stat("dir"); err != nil || !info.IsDir() {
+				t.Errorf("Stat of the directory = %+v, %v", info, err)
+			}
+			if _, err := transferrer.Stat("dir/missing"); err == nil {
+				t.Error("Stat of a missing file succeeded")
+			}
+
+			infos, err := transferrer.List("dir")
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(infos) != 1 || infos[0].Name != "report 1.txt" {
+				t.Errorf("List = %+v, want only report 1.txt", infos)
+			}
+
+			download := filepath.Join(localDir, "download.txt")
+			if err := transferrer.Download("dir/report 1.txt", download); err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			if contents, err := ioutil.ReadFile(download); err != nil || string(contents) != "hello, server\n" {
+				t.Errorf("Download wrote %q, %v", contents, err)
+			}
+			if err := transferrer.Download("dir/missing", filepath.Join(localDir, "missing")); err == nil {
+				t.Error("Download of a missing file succeeded")
+			}
+		})
+	}
+}
+
+// dialServer starts a Server with an empty directory called dir and connects
+// to it.
+func dialServer(t *testing.T) *ssh.Client {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	server, err := goScptest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err := server.Dial("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
@@ -0,0 +1,112 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GrowthPolicy decides how a download treats a remote file that keeps growing
+// after scp has announced its size, such as an active log file.
+type GrowthPolicy int
+
+const (
+	// SnapshotAtDeclaredSize copies exactly the announced number of bytes and
+	// ignores anything appended afterwards.
+	SnapshotAtDeclaredSize GrowthPolicy = iota
+	// FollowUntilQuiet keeps fetching appended bytes until the remote file has
+	// not grown for the configured quiet period.
+	FollowUntilQuiet
+	// ErrorOnGrowth fails the download with a *FileGrewError when the remote
+	// file is larger than announced once the copy has finished.
+	ErrorOnGrowth
+)
+
+// ErrFileGrew is matched by errors.Is for every *FileGrewError.
+var ErrFileGrew = errors.New("goScp: remote file grew during download")
+
+// FileGrewError reports a remote file that was larger after the download than
+// the size scp announced when it started.
+type FileGrewError struct {
+	Path         string
+	DeclaredSize int64
+	CurrentSize  int64
+}
+
+func (e *FileGrewError) Error() string {
+	return fmt.Sprintf("goScp: remote file %s grew from %d to %d bytes during download", e.Path, e.DeclaredSize, e.CurrentSize)
+}
+
+// Is lets errors.Is match a *FileGrewError against ErrFileGrew.
+func (e *FileGrewError) Is(target error) bool {
+	return target == ErrFileGrew
+}
+
+// applyGrowthPolicy runs after the announced bytes of remotePath have been
+// written to w.
+func applyGrowthPolicy(client *ssh.Client, remotePath string, declaredSize int64, w io.Writer, options *transferOptions) error {
+	switch options.growthPolicy {
+	case FollowUntilQuiet:
+		offset := declaredSize
+		for {
+			time.Sleep(options.quietPeriod)
+			n, err := fetchRemoteTail(client, remotePath, offset, w)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			offset += n
+		}
+	case ErrorOnGrowth:
+		currentSize, err := remoteFileSize(client, remotePath)
+		if err != nil {
+			return err
+		}
+		if currentSize > declaredSize {
+			return &FileGrewError{Path: remotePath, DeclaredSize: declaredSize, CurrentSize: currentSize}
+		}
+	}
+	return nil
+}
+
+// remoteFileSize returns the current size in bytes of remotePath.
+func remoteFileSize(client *ssh.Client, remotePath string) (int64, error) {
+	output, err := ExecuteCommand(client, "wc -c < "+shellQuote(remotePath))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+}
+
+// fetchRemoteTail copies everything in remotePath past offset to w and
+// returns the number of bytes copied.
+func fetchRemoteTail(client *ssh.Client, remotePath string, offset int64, w io.Writer) (int64, error) {
+	session, err := openSession(client)
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	counter := &countingWriter{w: w}
+	session.Stdout = counter
+	err = session.Run(fmt.Sprintf("tail -c +%d %s", offset+1, shellQuote(remotePath)))
+	return counter.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
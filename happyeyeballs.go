@@ -0,0 +1,136 @@
+package goScp
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// defaultAttemptDelay is how long a connection attempt runs on its own before
+// the next address is tried alongside it, as recommended by RFC 8305.
+const defaultAttemptDelay = 250 * time.Millisecond
+
+// WithAttemptDelay sets how long Connect waits for a connection to one
+// address of the remote host before it tries the next one in parallel, when
+// the host name resolves to several. The addresses are tried alternating
+// between IPv6 and IPv4, the first connection established is used and the
+// other attempts are canceled, so an unreachable address only costs delay
+// instead of the whole timeout. Zero or less means 250ms.
+func WithAttemptDelay(delay time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		o.attemptDelay = delay
+	}
+}
+
+// dialAddresses connects to addr, trying the addresses its host resolves to
+// Happy Eyeballs style.
+func (o *connectOptions) dialAddresses(network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if o.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.connectTimeout)
+		defer cancel()
+	}
+
+	ips, err := o.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range interleaveFamilies(ips) {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+
+	delay := o.attemptDelay
+	if delay <= 0 {
+		delay = defaultAttemptDelay
+	}
+	return dialParallel(ctx, network, addrs, delay)
+}
+
+// interleaveFamilies orders ips alternating between IPv6 and IPv4, starting
+// with the family of the first one and otherwise keeping the order of the
+// resolver, which sorts them by preference.
+func interleaveFamilies(ips []net.IPAddr) []net.IPAddr {
+	var first, second []net.IPAddr
+	for _, ip := range ips {
+		if (ip.IP.To4() == nil) == (ips[0].IP.To4() == nil) {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+	ordered := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			ordered = append(ordered, first[i])
+		}
+		if i < len(second) {
+			ordered = append(ordered, second[i])
+		}
+	}
+	return ordered
+}
+
+// dialParallel dials addrs in order, starting the next attempt once the
+// running ones took delay or failed, and returns the first connection
+// established. It fails with the error of the first attempt when all fail.
+func dialParallel(ctx context.Context, network string, addrs []string, delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan attempt)
+	started, running := 0, 0
+	start := func() {
+		var dialer net.Dialer
+		go func(addr string) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			results <- attempt{conn: conn, err: err}
+		}(addrs[started])
+		started++
+		running++
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var firstErr error
+	for running > 0 {
+		select {
+		case result := <-results:
+			running--
+			if result.err == nil {
+				// Close the connections of attempts that succeed too late
+				go func(running int) {
+					for ; running > 0; running-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(running)
+				return result.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if started < len(addrs) {
+				start()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if started < len(addrs) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,107 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileIdentity tells hard links to the same file apart from copies.
+type fileIdentity struct {
+	device uint64
+	inode  uint64
+}
+
+// hardLinks maps every name below localDir that is a hard link to a file
+// appearing under an earlier name to that name. names are slash separated and
+// relative to localDir.
+func hardLinks(localDir string, names []string) (map[string]string, error) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	first := map[fileIdentity]string{}
+	links := map[string]string{}
+	for _, name := range sorted {
+		info, err := os.Lstat(filepath.Join(localDir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		id, linked := linkIdentity(info)
+		if !linked {
+			continue
+		}
+		if target, ok := first[id]; ok {
+			links[name] = target
+		} else {
+			first[id] = name
+		}
+	}
+	return links, nil
+}
+
+// linkRemoteFiles hard links every name of links below remoteDir to its
+// target.
+func linkRemoteFiles(client *ssh.Client, remoteDir string, links map[string]string) error {
+	names := make([]string, 0, len(links))
+	for name := range links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const linksPerCommand = 100
+	for start := 0; start < len(names); start += linksPerCommand {
+		end := start + linksPerCommand
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var cmd strings.Builder
+		cmd.WriteString("cd " + shellQuote(remoteDir) + " || exit 1")
+		for _, name := range names[start:end] {
+			cmd.WriteString(" && ln -f -- " + shellQuote(links[name]) + " " + shellQuote(name))
+		}
+		if _, err := ExecuteCommand(client, cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UploadFiles uploads names, slash separated and relative to localDir, to the
+// same names below remoteDir with transferrer. When transferrer is a Linker,
+// names that are hard links to an earlier name are linked to it on the remote
+// host instead of uploading their content again. The remote directories have
+// to exist.
+func UploadFiles(transferrer Transferrer, localDir string, remoteDir string, names []string, opts ...TransferOption) error {
+	links := map[string]string{}
+	linker, canLink := transferrer.(Linker)
+	if canLink {
+		var err error
+		if links, err = hardLinks(localDir, names); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if _, linked := links[name]; linked {
+			continue
+		}
+		if err := transferrer.Upload(filepath.Join(localDir, filepath.FromSlash(name)), path.Join(remoteDir, name), opts...); err != nil {
+			return err
+		}
+	}
+
+	linked := make([]string, 0, len(links))
+	for name := range links {
+		linked = append(linked, name)
+	}
+	sort.Strings(linked)
+	for _, name := range linked {
+		if err := linker.Link(path.Join(remoteDir, links[name]), path.Join(remoteDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
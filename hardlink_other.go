@@ -0,0 +1,13 @@
+//go:build !unix
+
+package goScp
+
+import (
+	"os"
+)
+
+// linkIdentity reports no hard links, they cannot be told apart from copies
+// on this platform.
+func linkIdentity(info os.FileInfo) (fileIdentity, bool) {
+	return fileIdentity{}, false
+}
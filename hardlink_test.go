@@ -0,0 +1,85 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadFilesHardLinks(t *testing.T) {
+	backends := map[string]func(client *ssh.Client) (goScp.Transferrer, error){
+		"scp": func(client *ssh.Client) (goScp.Transferrer, error) {
+			return goScp.NewSCPTransferrer(client), nil
+		},
+		"sftp": goScp.NewSFTPTransferrer,
+		"tar": func(client *ssh.Client) (goScp.Transferrer, error) {
+			return goScp.NewTarTransferrer(client), nil
+		},
+	}
+	localDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(localDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(localDir, "original"), []byte("shared"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(localDir, "original"), filepath.Join(localDir, "sub", "link")); err != nil {
+		t.Skipf("the local file system has no hard links: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(localDir, "copy"), []byte("shared"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"copy", "original", "sub/link"}
+
+	for name, newTransferrer := range backends {
+		for _, absolute := range []bool{false, true} {
+			if absolute && name == "scp" {
+				// The scp of the server resolves absolute paths below its root
+				continue
+			}
+			_, client, root := startServer(t)
+			transferrer, err := newTransferrer(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer transferrer.Close()
+			if err := os.MkdirAll(filepath.Join(root, "backup", "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			// An existing file is replaced by the link
+			if err := ioutil.WriteFile(filepath.Join(root, "backup", "sub", "link"), []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			remoteDir := "backup"
+			if absolute {
+				remoteDir = filepath.ToSlash(filepath.Join(root, "backup"))
+			}
+			if err := goScp.UploadFiles(transferrer, localDir, remoteDir, names); err != nil {
+				t.Errorf("%s to %s: %v", name, remoteDir, err)
+				continue
+			}
+			original, err := os.Stat(filepath.Join(root, "backup", "original"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			link, err := os.Stat(filepath.Join(root, "backup", "sub", "link"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			copied, err := os.Stat(filepath.Join(root, "backup", "copy"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(original, link) {
+				t.Errorf("%s to %s: the hard link was uploaded as a copy", name, remoteDir)
+			}
+			if os.SameFile(original, copied) {
+				t.Errorf("%s to %s: a copy was uploaded as a hard link", name, remoteDir)
+			}
+		}
+	}
+}
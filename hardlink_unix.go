@@ -0,0 +1,18 @@
+//go:build unix
+
+package goScp
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkIdentity returns what identifies the file of info among hard links to
+// it, and whether there are other links to it at all.
+func linkIdentity(info os.FileInfo) (fileIdentity, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileIdentity{}, false
+	}
+	return fileIdentity{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, stat.Nlink > 1
+}
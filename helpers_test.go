@@ -0,0 +1,80 @@
+package goScp_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/kalfke/go-scp"
+	"github.com/kalfke/go-scp/goScptest"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// startServer starts a goScptest.Server serving a new temporary directory,
+// which it returns along with a connection to the server.
+func startServer(t *testing.T) (*goScptest.Server, *ssh.Client, string) {
+	t.Helper()
+	root := t.TempDir()
+	server, err := goScptest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err := server.Dial("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return server, client, root
+}
+
+// writeKeyfile writes a new unencrypted ed25519 key for Connect.
+func writeKeyfile(t *testing.T) goScp.SSHKeyfile {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "id_ed25519"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return goScp.SSHKeyfile{Path: dir, Filename: "id_ed25519"}
+}
+
+// connectByName connects to server with Connect, naming it host instead of
+// the address it listens on.
+func connectByName(t *testing.T, server *goScptest.Server, host string) *ssh.Client {
+	t.Helper()
+	remote := server.RemoteHost()
+	remote.Host = host
+	client, err := goScp.Connect(writeKeyfile(t), goScp.SSHCredentials{Username: "test"}, remote, false, goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// stateRemote returns the remote host a state or journal file was written for.
+func stateRemote(t *testing.T, filename string) string {
+	t.Helper()
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct {
+		Remote string `json:"remote"`
+	}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		t.Fatal(err)
+	}
+	return state.Remote
+}
@@ -0,0 +1,123 @@
+package goScp
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoHostKeyCheck is returned by Connect when neither WithKnownHosts nor
+// WithHostKeyCallback was given, rather than trusting any host key.
+var ErrNoHostKeyCheck = errors.New("goScp: no host key check configured, see WithKnownHosts and WithHostKeyCallback")
+
+// HostKeyInfo describes the host key a remote host presented.
+type HostKeyInfo struct {
+	// Hostname is the host as it was dialed, with its port.
+	Hostname   string
+	RemoteAddr net.Addr
+	// Type is the key algorithm, e.g. "ssh-ed25519".
+	Type string
+	// Fingerprint is the SHA256 fingerprint as printed by ssh-keygen -l,
+	// e.g. "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s".
+	Fingerprint string
+	Key         ssh.PublicKey
+}
+
+// WithHostKeyCallback checks the host key of the remote host with callback,
+// e.g. ssh.FixedHostKey for a pinned key. Connect refuses to connect without
+// this or WithKnownHosts.
+func WithHostKeyCallback(callback ssh.HostKeyCallback) ConnectOption {
+	return func(o *connectOptions) {
+		o.hostKeyCallback = callback
+	}
+}
+
+// WithKnownHosts checks the host key of the remote host against the OpenSSH
+// known_hosts files, ~/.ssh/known_hosts when none are given. Hosts missing
+// from them are refused like ones presenting another key. The files are read
+// on every connect, so keys added meanwhile are picked up.
+func WithKnownHosts(files ...string) ConnectOption {
+	return WithHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		paths := files
+		if len(paths) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			paths = []string{filepath.Join(home, ".ssh", "known_hosts")}
+		}
+		callback, err := knownhosts.New(paths...)
+		if err != nil {
+			return err
+		}
+		return callback(hostname, remote, key)
+	})
+}
+
+// WithHostKeyInspector calls inspect with the host key of the remote host
+// before authenticating, e.g. to show its fingerprint or record which key the
+// session was established with. Connecting fails with the error inspect
+// returns, so it can also pin keys.
+func WithHostKeyInspector(inspect func(HostKeyInfo) error) ConnectOption {
+	return func(o *connectOptions) {
+		o.hostKeyInspectors = append(o.hostKeyInspectors, inspect)
+	}
+}
+
+// WithBannerCallback calls callback with the banner the remote host sends
+// before authentication, e.g. a legal notice to display.
+func WithBannerCallback(callback func(banner string)) ConnectOption {
+	return func(o *connectOptions) {
+		o.bannerCallbacks = append(o.bannerCallbacks, callback)
+	}
+}
+
+// inspectHostKeys runs the host key inspectors of o after callback. A nil
+// callback refuses every key with ErrNoHostKeyCheck.
+func (o *connectOptions) inspectHostKeys(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	inspectors := o.hostKeyInspectors
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if callback == nil {
+			return ErrNoHostKeyCheck
+		}
+		if err := callback(hostname, remote, key); err != nil {
+			return err
+		}
+		info := HostKeyInfo{
+			Hostname:    hostname,
+			RemoteAddr:  remote,
+			Type:        key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Key:         key,
+		}
+		for _, inspect := range inspectors {
+			if err := inspect(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// showBanners passes the banner to the banner callbacks of o after callback,
+// which may be nil.
+func (o *connectOptions) showBanners(callback ssh.BannerCallback) ssh.BannerCallback {
+	if len(o.bannerCallbacks) == 0 {
+		return callback
+	}
+	callbacks := o.bannerCallbacks
+	return func(message string) error {
+		if callback != nil {
+			if err := callback(message); err != nil {
+				return err
+			}
+		}
+		for _, show := range callbacks {
+			show(message)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package goScp_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kalfke/go-scp"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnectRequiresHostKeyCheck(t *testing.T) {
+	server, _, _ := startServer(t)
+	keyfile := writeKeyfile(t)
+	credentials := goScp.SSHCredentials{Username: "test"}
+
+	_, err := goScp.Connect(keyfile, credentials, server.RemoteHost(), false)
+	if !errors.Is(err, goScp.ErrNoHostKeyCheck) {
+		t.Fatalf("Connect without a host key check: got %v, want ErrNoHostKeyCheck", err)
+	}
+
+	var inspected goScp.HostKeyInfo
+	inspect := goScp.WithHostKeyInspector(func(info goScp.HostKeyInfo) error {
+		inspected = info
+		return nil
+	})
+	_, err = goScp.Connect(keyfile, credentials, server.RemoteHost(), false, inspect)
+	if !errors.Is(err, goScp.ErrNoHostKeyCheck) {
+		t.Fatalf("Connect with only an inspector: got %v, want ErrNoHostKeyCheck", err)
+	}
+
+	client, err := goScp.Connect(keyfile, credentials, server.RemoteHost(), false, inspect, goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if inspected.Fingerprint != ssh.FingerprintSHA256(server.HostKey()) {
+		t.Errorf("inspected fingerprint %q, want the one of the server", inspected.Fingerprint)
+	}
+}
+
+func TestConnectWithKnownHosts(t *testing.T) {
+	server, _, _ := startServer(t)
+	keyfile := writeKeyfile(t)
+	credentials := goScp.SSHCredentials{Username: "test"}
+	remote := server.RemoteHost()
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := fmt.Sprintf("[%s]:%s %s", remote.Host, remote.Port, ssh.MarshalAuthorizedKey(server.HostKey()))
+	if err := ioutil.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := goScp.Connect(keyfile, credentials, remote, false, goScp.WithKnownHosts(knownHosts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	empty := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goScp.Connect(keyfile, credentials, remote, false, goScp.WithKnownHosts(empty)); err == nil {
+		t.Fatal("Connect accepted a host missing from known_hosts")
+	}
+}
@@ -0,0 +1,173 @@
+package goScp
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files listing what recursive uploads
+// leave out, such as build artifacts or node_modules. They use the .gitignore
+// syntax: patterns are relative to the directory of the file, a leading !
+// re-includes what an earlier pattern excluded, a trailing / matches
+// directories only and ** matches any number of directories. Files below an
+// excluded directory cannot be re-included. Remote files matching a pattern
+// are never deleted by a sync either.
+const IgnoreFileName = ".scpignore"
+
+// ignoreRule is a single pattern of an ignore file.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// matches reports whether the rule applies to name, a slash separated path
+// relative to the directory of the ignore file.
+func (r ignoreRule) matches(name string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	return matchSegments(r.segments, strings.Split(name, "/"))
+}
+
+// matchSegments matches the segments of a path against the ones of a pattern,
+// where a ** segment matches any number of path segments.
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], name[0])
+	return matched && matchSegments(pattern[1:], name[1:])
+}
+
+// parseIgnoreRule parses a line of an ignore file, ok is false for blank
+// lines and comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	}
+	// Escapes patterns starting with # or !
+	line = strings.TrimPrefix(line, `\`)
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	// Patterns without a slash match at any depth, the others relative to
+	// the directory of the ignore file
+	anchored := strings.Contains(line, "/")
+	rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// ignoreMatcher decides which paths below a directory are excluded by the
+// ignore files in it. Every ignore file is read once, when a path below its
+// directory is first looked at.
+type ignoreMatcher struct {
+	fsys  fs.FS
+	rules map[string][]ignoreRule
+}
+
+// newIgnoreMatcher returns an ignoreMatcher for the local directory dir.
+func newIgnoreMatcher(dir string) *ignoreMatcher {
+	return newFSIgnoreMatcher(os.DirFS(dir))
+}
+
+// newFSIgnoreMatcher returns an ignoreMatcher for the root of fsys.
+func newFSIgnoreMatcher(fsys fs.FS) *ignoreMatcher {
+	return &ignoreMatcher{fsys: fsys, rules: map[string][]ignoreRule{}}
+}
+
+// ignored reports whether name, a slash separated path relative to the root
+// of the matcher, or one of the directories it is in is excluded. A nil
+// matcher excludes nothing.
+func (m *ignoreMatcher) ignored(name string, dir bool) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+	parts := strings.Split(name, "/")
+	for i := 1; i <= len(parts); i++ {
+		current := strings.Join(parts[:i], "/")
+		currentIsDir := dir || i < len(parts)
+
+		excluded := false
+		for j := 0; j < i; j++ {
+			base := "."
+			if j > 0 {
+				base = strings.Join(parts[:j], "/")
+			}
+			rules, err := m.load(base)
+			if err != nil {
+				return false, err
+			}
+			relative := current
+			if j > 0 {
+				relative = current[len(base)+1:]
+			}
+			// The last matching rule wins
+			for _, rule := range rules {
+				if rule.matches(relative, currentIsDir) {
+					excluded = !rule.negate
+				}
+			}
+		}
+		if excluded {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// load returns the rules of the ignore file in dir, none when there is none.
+func (m *ignoreMatcher) load(dir string) ([]ignoreRule, error) {
+	if rules, ok := m.rules[dir]; ok {
+		return rules, nil
+	}
+
+	var rules []ignoreRule
+	file, err := m.fsys.Open(path.Join(dir, IgnoreFileName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	m.rules[dir] = rules
+	return rules, nil
+}
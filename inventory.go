@@ -0,0 +1,165 @@
+package goScp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InventoryHost is a single host of an Inventory. User, Key, UseAgent and
+// RemotePath are optional and fall back to the options of the operation using
+// the inventory.
+type InventoryHost struct {
+	Name     string            `json:"name" yaml:"name"`
+	Host     string            `json:"host" yaml:"host"`
+	Port     int               `json:"port" yaml:"port"`
+	User     string            `json:"user" yaml:"user"`
+	Key      string            `json:"key" yaml:"key"`
+	UseAgent bool              `json:"use_agent" yaml:"use_agent"`
+	Labels   map[string]string `json:"labels" yaml:"labels"`
+	// BandwidthClass tags the host for the limits of a TransferManager.
+	BandwidthClass BandwidthClass `json:"bandwidth_class" yaml:"bandwidth_class"`
+	// RemotePath replaces the remote path of operations on this host.
+	RemotePath string `json:"remote_path" yaml:"remote_path"`
+}
+
+// RemoteHost returns the address of the host, named by Name. The port
+// defaults to 22.
+func (h InventoryHost) RemoteHost() RemoteHost {
+	port := h.Port
+	if port == 0 {
+		port = 22
+	}
+	return RemoteHost{Host: h.Host, Port: strconv.Itoa(port), Name: h.Name, BandwidthClass: h.BandwidthClass}
+}
+
+// Inventory is a list of hosts, usually loaded from a YAML or JSON file:
+//
+//	hosts:
+//	  - name: web-01
+//	    host: 10.0.0.11
+//	    user: deploy
+//	    key: /home/deploy/.ssh/id_ed25519
+//	    labels:
+//	      role: web
+type Inventory struct {
+	Hosts []InventoryHost `json:"hosts" yaml:"hosts"`
+}
+
+// LoadInventory reads an inventory from filename. Files ending in .json are
+// parsed as JSON, everything else as YAML.
+func LoadInventory(filename string) (*Inventory, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		return ParseInventoryJSON(contents)
+	}
+	return ParseInventoryYAML(contents)
+}
+
+// ParseInventoryJSON parses a JSON encoded inventory.
+func ParseInventoryJSON(data []byte) (*Inventory, error) {
+	inventory := &Inventory{}
+	if err := json.Unmarshal(data, inventory); err != nil {
+		return nil, err
+	}
+	return inventory, inventory.validate()
+}
+
+// ParseInventoryYAML parses a YAML encoded inventory.
+func ParseInventoryYAML(data []byte) (*Inventory, error) {
+	inventory := &Inventory{}
+	if err := yaml.Unmarshal(data, inventory); err != nil {
+		return nil, err
+	}
+	return inventory, inventory.validate()
+}
+
+func (inv *Inventory) validate() error {
+	for i, host := range inv.Hosts {
+		if host.Host == "" {
+			return fmt.Errorf("goScp: inventory host %d (%q) has no host", i, host.Name)
+		}
+	}
+	return nil
+}
+
+// Select returns the hosts matching every key=value pair of selector, e.g.
+// "role=web" or "role=web,env=prod". An empty selector matches every host.
+func (inv *Inventory) Select(selector string) (*Inventory, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(selector, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("goScp: invalid label selector %q", pair)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	selected := &Inventory{}
+	for _, host := range inv.Hosts {
+		if host.matches(labels) {
+			selected.Hosts = append(selected.Hosts, host)
+		}
+	}
+	return selected, nil
+}
+
+func (h InventoryHost) matches(labels map[string]string) bool {
+	for key, value := range labels {
+		if h.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoteHosts returns the addresses of every host in the inventory.
+func (inv *Inventory) RemoteHosts() []RemoteHost {
+	hosts := make([]RemoteHost, len(inv.Hosts))
+	for i, host := range inv.Hosts {
+		hosts[i] = host.RemoteHost()
+	}
+	return hosts
+}
+
+// DistributeFileToInventory works like DistributeFile for every host of inv.
+// Users, keys and remote paths set on a host take precedence over the ones in
+// opts, opts.Overrides over both.
+func DistributeFileToInventory(localPath string, inv *Inventory, remotePath string, opts DistributeOptions) *DistributeReport {
+	return distribute(inventoryTargets(inv, opts), remotePath, opts, pushFile(localPath))
+}
+
+// inventoryTargets returns the targets for the hosts of inv, falling back to
+// the settings of opts.
+func inventoryTargets(inv *Inventory, opts DistributeOptions) []distributeTarget {
+	targets := make([]distributeTarget, len(inv.Hosts))
+	for i, host := range inv.Hosts {
+		target := distributeTarget{
+			remotePath:    host.RemotePath,
+			host:          host.RemoteHost(),
+			keyFile:       opts.KeyFile,
+			credentials:   opts.Credentials,
+			usingSSHAgent: opts.UsingSSHAgent || host.UseAgent,
+		}
+		if host.User != "" {
+			target.credentials.Username = host.User
+		}
+		if host.Key != "" {
+			target.keyFile = SSHKeyfile{Path: filepath.Dir(host.Key), Filename: filepath.Base(host.Key)}
+			target.usingSSHAgent = host.UseAgent
+		}
+		targets[i] = target
+	}
+	return targets
+}
@@ -0,0 +1,179 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"sync"
+)
+
+// ErrDependencyFailed is the error of a job that was skipped because one of
+// the jobs it depends on failed.
+var ErrDependencyFailed = errors.New("goScp: dependency failed")
+
+// Job is a named step of RunJobs that only starts once every job named in
+// DependsOn has succeeded.
+type Job struct {
+	Name      string
+	DependsOn []string
+	Run       func() error
+}
+
+// JobResult is the outcome of a single Job. Skipped jobs have an error
+// wrapping ErrDependencyFailed.
+type JobResult struct {
+	Name    string
+	Skipped bool
+	Err     error
+}
+
+// UploadJob returns a Job that uploads localFile to remotePath and then
+// verifies the SHA-256 of the remote file, so jobs depending on it only start
+// once the upload is known to be complete.
+func UploadJob(client *ssh.Client, name string, localFile string, remotePath string, dependsOn ...string) Job {
+	return Job{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func() error {
+			var sent sentFile
+			err := copyLocalFileToRemote(client, localFile, remotePath, withSentNotify(func(size int64, sum []byte) {
+				sent = sentFile{size: size, sum: sum}
+			}))
+			if err != nil {
+				return err
+			}
+			return verifyRemoteSum(client, BatchFile{LocalPath: localFile, RemotePath: remotePath}, sent)
+		},
+	}
+}
+
+// CommandJob returns a Job that runs cmd on the remote host.
+func CommandJob(client *ssh.Client, name string, cmd string, dependsOn ...string) Job {
+	return Job{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func() error {
+			_, err := ExecuteCommand(client, cmd)
+			return err
+		},
+	}
+}
+
+// SyncJob returns a Job that syncs localDir to remoteDir with Sync.
+func SyncJob(client *ssh.Client, name string, localDir string, remoteDir string, opts SyncOptions, dependsOn ...string) Job {
+	return Job{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func() error {
+			_, err := Sync(client, localDir, remoteDir, opts)
+			return err
+		},
+	}
+}
+
+// RunJobs runs jobs as a dependency graph, running up to concurrency jobs at
+// the same time whenever their dependencies allow it. Jobs whose dependencies
+// failed are skipped. Unknown dependencies and cycles are reported before any
+// job runs. Results are returned in the order of jobs.
+func RunJobs(jobs []Job, concurrency int) ([]JobResult, error) {
+	if err := validateJobs(jobs); err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	done := make(map[string]chan struct{}, len(jobs))
+	for _, job := range jobs {
+		done[job.Name] = make(chan struct{})
+	}
+
+	results := make([]JobResult, len(jobs))
+	failed := make(map[string]bool, len(jobs))
+	var failedMu sync.Mutex
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job Job) {
+			defer wg.Done()
+			defer close(done[job.Name])
+
+			results[i] = JobResult{Name: job.Name}
+			for _, dependency := range job.DependsOn {
+				<-done[dependency]
+				failedMu.Lock()
+				dependencyFailed := failed[dependency]
+				failedMu.Unlock()
+				if dependencyFailed {
+					results[i].Skipped = true
+					results[i].Err = fmt.Errorf("%w: %s", ErrDependencyFailed, dependency)
+				}
+			}
+
+			if !results[i].Skipped {
+				slots <- struct{}{}
+				results[i].Err = job.Run()
+				<-slots
+			}
+
+			if results[i].Err != nil {
+				failedMu.Lock()
+				failed[job.Name] = true
+				failedMu.Unlock()
+			}
+		}(i, job)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// validateJobs checks that job names are unique, every dependency exists and
+// the dependencies do not form a cycle.
+func validateJobs(jobs []Job) error {
+	byName := make(map[string]Job, len(jobs))
+	for _, job := range jobs {
+		if _, exists := byName[job.Name]; exists {
+			return fmt.Errorf("goScp: duplicate job %q", job.Name)
+		}
+		byName[job.Name] = job
+	}
+	for _, job := range jobs {
+		for _, dependency := range job.DependsOn {
+			if _, exists := byName[dependency]; !exists {
+				return fmt.Errorf("goScp: job %q depends on unknown job %q", job.Name, dependency)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(jobs))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("goScp: job %q is part of a dependency cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dependency := range byName[name].DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, job := range jobs {
+		if err := visit(job.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package goScp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// journalInterval is how often the offset of the file being uploaded is
+// written to the journal at most.
+const journalInterval = time.Second
+
+// syncJournal is what SyncOptions.Journal keeps while a sync runs: what the
+// sync is going to do and how far it got.
+type syncJournal struct {
+	Remote      string           `json:"remote"`
+	RemoteDir   string           `json:"remote_dir"`
+	Uploaded    []string         `json:"uploaded"`
+	Deleted     []string         `json:"deleted"`
+	Moved       []SyncMove       `json:"moved"`
+	Unchanged   []string         `json:"unchanged"`
+	RemoteSizes map[string]int64 `json:"remote_sizes"`
+	// Completed is the number of files of Uploaded that are done.
+	Completed int `json:"completed"`
+	// Offset is how much of the next file was sent, Size and Mtime are of
+	// the local file when that started.
+	Offset int64     `json:"offset"`
+	Size   int64     `json:"size"`
+	Mtime  time.Time `json:"mtime"`
+
+	filename string
+	saved    time.Time
+}
+
+// loadSyncJournal reads the journal of an interrupted sync to remoteDir on
+// the host of client from filename. It returns nil when there is none,
+// including when the journal is of another remote directory.
+func loadSyncJournal(filename string, client *ssh.Client, remoteDir string) (*syncJournal, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	journal := &syncJournal{filename: filename}
+	if err := json.Unmarshal(contents, journal); err != nil {
+		return nil, err
+	}
+	if journal.Remote != remoteKey(client) || journal.RemoteDir != remoteDir {
+		return nil, nil
+	}
+	return journal, nil
+}
+
+// newSyncJournal starts the journal of the sync of result to remoteDir on the
+// host of client in filename. It returns nil when filename is empty.
+func newSyncJournal(filename string, client *ssh.Client, remoteDir string, result *SyncResult, remoteSizes map[string]int64) (*syncJournal, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	journal := &syncJournal{
+		Remote:      remoteKey(client),
+		RemoteDir:   remoteDir,
+		Uploaded:    result.Uploaded,
+		Deleted:     result.Deleted,
+		Moved:       result.Moved,
+		Unchanged:   result.Unchanged,
+		RemoteSizes: remoteSizes,
+		filename:    filename,
+	}
+	return journal, journal.save()
+}
+
+// result returns the result of the sync the journal is of.
+func (j *syncJournal) result() *SyncResult {
+	return &SyncResult{Uploaded: j.Uploaded, Deleted: j.Deleted, Moved: j.Moved, Unchanged: j.Unchanged}
+}
+
+func (j *syncJournal) save() error {
+	contents, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	j.saved = time.Now()
+	return writeFileAtomic(j.filename, contents)
+}
+
+// completed returns the number of uploads that are done. A nil journal has
+// none done.
+func (j *syncJournal) completed() int {
+	if j == nil {
+		return 0
+	}
+	return j.Completed
+}
+
+// complete records that the first n uploads are done.
+func (j *syncJournal) complete(n int) error {
+	if j == nil {
+		return nil
+	}
+	j.Completed, j.Offset, j.Size, j.Mtime = n, 0, 0, time.Time{}
+	return j.save()
+}
+
+// upload uploads localFile to remotePath with upload, passing it opts. When an
+// earlier run was interrupted while uploading the same, unchanged localFile,
+// only the rest of it is sent instead.
+func (j *syncJournal) upload(client *ssh.Client, localFile string, remotePath string, opts []TransferOption, upload func([]TransferOption) error) error {
+	if j == nil {
+		return upload(opts)
+	}
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return err
+	}
+	if j.Offset > 0 && j.Size == info.Size() && j.Mtime.Equal(info.ModTime()) {
+		resumed, err := resumeUpload(client, localFile, remotePath, j.Offset, opts)
+		if err != nil {
+			return err
+		}
+		if resumed {
+			return nil
+		}
+	}
+
+	j.Offset, j.Size, j.Mtime = 0, info.Size(), info.ModTime()
+	if err := j.save(); err != nil {
+		return err
+	}
+	return upload(append(opts[:len(opts):len(opts)], withProgressHook(j.progress)))
+}
+
+// progress records the offset of the file being uploaded.
+func (j *syncJournal) progress(transferred int64, total int64) {
+	j.Offset = transferred
+	if time.Since(j.saved) >= journalInterval {
+		// A failed save only loses progress, which is sent again then
+		j.save()
+	}
+}
+
+// remove deletes the journal once the sync is done.
+func (j *syncJournal) remove() error {
+	if j == nil {
+		return nil
+	}
+	if err := os.Remove(j.filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// withProgressHook calls hook with the progress of the transfer, in addition
+// to the ProgressFunc set by WithProgress.
+func withProgressHook(hook ProgressFunc) TransferOption {
+	return func(o *transferOptions) {
+		previous := o.progress
+		if previous == nil {
+			o.progress = hook
+			return
+		}
+		o.progress = func(transferred int64, total int64) {
+			previous(transferred, total)
+			hook(transferred, total)
+		}
+	}
+}
+
+// resumeUpload sends localFile past offset to remotePath, which holds the
+// part of it that was sent before. The remote host may have written less than
+// that, and scp overwrites existing files in place, so the remote file is cut
+// to what it holds of the sent part and compared with localFile once done. It
+// returns false when the upload could not be resumed and has to start over.
+func resumeUpload(client *ssh.Client, localFile string, remotePath string, offset int64, opts []TransferOption) (resumed bool, err error) {
+	options := newTransferOptions(opts)
+	if len(options.transformers) > 0 {
+		// Transformed contents cannot be cut at a plain offset
+		return false, nil
+	}
+	remoteSize, err := remoteFileSize(client, remotePath)
+	if err != nil {
+		return false, nil
+	}
+	if remoteSize < offset {
+		offset = remoteSize
+	}
+
+	options.begin(Upload, localFile, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	file, err := os.Open(localFile)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	session, err := openSession(client)
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return false, err
+	}
+	cmd := fmt.Sprintf("truncate -s %d -- %s && cat >> %s", offset, shellQuote(remotePath), shellQuote(remotePath))
+	if err := session.Start(cmd); err != nil {
+		return false, err
+	}
+	_, err = options.buffers.copy(options.instrument(writer, info.Size()-offset), file)
+	writer.Close()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := session.Wait(); err != nil {
+		return false, nil
+	}
+
+	localSum, err := sha256File(localFile)
+	if err != nil {
+		return false, err
+	}
+	remoteSum, err := remoteFileSHA256(client, path.Dir(remotePath), path.Base(remotePath))
+	if err != nil {
+		return false, err
+	}
+	if remoteSum != hex.EncodeToString(localSum) {
+		return false, nil
+	}
+	if options.manifest != nil {
+		options.manifest.record(Upload, localFile, remotePath, info.Size(), localSum)
+	}
+	return true, nil
+}
@@ -0,0 +1,48 @@
+package goScp_test
+
+import (
+	"fmt"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncJournalKeyedByHost(t *testing.T) {
+	server, _, root := startServer(t)
+	if err := os.Mkdir(filepath.Join(root, "site"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+	for _, name := range []string{"a.html", "b.html"} {
+		if err := ioutil.WriteFile(filepath.Join(localDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The journal of a sync to the host by name, interrupted after a.html
+	journalFile := filepath.Join(t.TempDir(), "journal.json")
+	journal := fmt.Sprintf(`{"remote": "localhost:%s", "remote_dir": "site", "uploaded": ["a.html", "b.html"], "completed": 1}`, server.RemoteHost().Port)
+	if err := ioutil.WriteFile(journalFile, []byte(journal), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := goScp.Sync(connectByName(t, server, "localhost"), localDir, "site", goScp.SyncOptions{Journal: journalFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Uploaded) != 2 {
+		t.Errorf("Uploaded = %v, want the files of the journal", result.Uploaded)
+	}
+	// Resuming skips what the journal lists as done
+	if _, err := os.Stat(filepath.Join(root, "site", "a.html")); !os.IsNotExist(err) {
+		t.Errorf("a.html was uploaded again: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "site", "b.html")); err != nil {
+		t.Errorf("b.html was not uploaded: %v", err)
+	}
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("the journal was kept after the sync: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientLocalSpace is matched by errors.Is for every
+// *InsufficientLocalSpaceError.
+var ErrInsufficientLocalSpace = errors.New("goScp: not enough space on the local filesystem")
+
+// InsufficientLocalSpaceError reports a download that was not started because
+// the local filesystem holding Path has less than Required bytes available.
+type InsufficientLocalSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientLocalSpaceError) Error() string {
+	return fmt.Sprintf("goScp: downloading to %s needs %d bytes, only %d are available", e.Path, e.Required, e.Available)
+}
+
+// Is lets errors.Is match an *InsufficientLocalSpaceError against
+// ErrInsufficientLocalSpace.
+func (e *InsufficientLocalSpaceError) Is(target error) bool {
+	return target == ErrInsufficientLocalSpace
+}
+
+// LocalSpaceFunc is asked whether a download of required bytes to path should
+// go ahead although only available bytes are free on the local filesystem.
+type LocalSpaceFunc func(path string, required int64, available int64) bool
+
+// WithLocalSpaceCheck makes a download check the free space of the local
+// filesystem once the remote announced the size of the file, and fail with an
+// *InsufficientLocalSpaceError when the file does not fit, instead of failing
+// once the disk is full. The space taken by a file that is overwritten counts
+// as free. When confirm is not nil it is asked first, and the download goes
+// ahead when it returns true. Platforms that do not report free space are not
+// checked.
+func WithLocalSpaceCheck(confirm LocalSpaceFunc) TransferOption {
+	return func(o *transferOptions) {
+		o.localSpaceCheck = true
+		o.confirmLocalSpace = confirm
+	}
+}
+
+// checkLocalSpace checks that localFile has room for size bytes when the
+// transfer asks for it.
+func (o *transferOptions) checkLocalSpace(localFile string, size int64) error {
+	if !o.localSpaceCheck {
+		return nil
+	}
+	available, ok, err := localAvailableSpace(filepath.Dir(localFile))
+	if err != nil || !ok {
+		return err
+	}
+	if info, err := os.Stat(localFile); err == nil && info.Mode().IsRegular() {
+		available += info.Size()
+	}
+	if available >= size {
+		return nil
+	}
+	if o.confirmLocalSpace != nil && o.confirmLocalSpace(localFile, size, available) {
+		return nil
+	}
+	return &InsufficientLocalSpaceError{Path: localFile, Required: size, Available: available}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package goScp
+
+// localAvailableSpace reports that the free space is unknown on this
+// platform.
+func localAvailableSpace(dir string) (int64, bool, error) {
+	return 0, false, nil
+}
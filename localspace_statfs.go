@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package goScp
+
+import (
+	"syscall"
+)
+
+// localAvailableSpace returns the bytes available to unprivileged users on
+// the filesystem of dir.
+func localAvailableSpace(dir string) (int64, bool, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, false, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), true, nil
+}
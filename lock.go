@@ -0,0 +1,197 @@
+package goScp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is matched by errors.Is for every *LockedError.
+var ErrLocked = errors.New("goScp: remote lock is held by someone else")
+
+// ErrLockLost is returned by RemoteLock.Refresh and Unlock when the lock was
+// stolen or removed by someone else meanwhile.
+var ErrLockLost = errors.New("goScp: remote lock was lost")
+
+// LockedError reports a remote lock held by someone else.
+type LockedError struct {
+	Path   string
+	Holder LockHolder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("goScp: remote lock %s is held by %s since %s", e.Path, e.Holder.Owner, e.Holder.Acquired.Format(time.RFC3339))
+}
+
+// Is lets errors.Is match a *LockedError against ErrLocked.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// LockHolder is what a lock file tells about who holds it.
+type LockHolder struct {
+	Owner    string    `json:"owner"`
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+	// TTL is how long the lock lasts after it was acquired or refreshed
+	// last, which is told by the modification time of the lock file.
+	TTL   time.Duration `json:"ttl"`
+	Token string        `json:"token"`
+}
+
+// StealPolicy decides when LockRemote takes over a lock held by someone else.
+type StealPolicy int
+
+const (
+	// StealExpired takes over locks that were not refreshed within their
+	// TTL, e.g. because their holder crashed.
+	StealExpired StealPolicy = iota
+	// NeverSteal leaves expired locks to be removed by hand.
+	NeverSteal
+	// AlwaysSteal takes over every lock, for a forced run.
+	AlwaysSteal
+)
+
+// LockOptions configures LockRemote.
+type LockOptions struct {
+	// Owner describes the holder in the lock file, e.g. the name of a job.
+	// The default is the local host name and process ID.
+	Owner string
+	// TTL is how long the lock lasts unless it is refreshed. Zero means 10
+	// minutes.
+	TTL time.Duration
+	// Steal decides when a lock held by someone else is taken over.
+	Steal StealPolicy
+	// Wait is how long to wait for a held lock to be released before failing
+	// with a *LockedError. Zero fails right away.
+	Wait time.Duration
+}
+
+// RemoteLock is an advisory lock held on a remote host, see LockRemote.
+type RemoteLock struct {
+	client *ssh.Client
+	path   string
+	holder LockHolder
+}
+
+// LockRemote acquires the advisory lock lockPath on the remote host, a file
+// created atomically that tells who holds the lock, so automation running on
+// several machines does not e.g. sync into the same remote directory at
+// once. It only keeps out those taking the same lock.
+//
+// Expiry is judged by the clock of the remote host, so the clocks of the
+// machines taking the lock do not need to agree. A lock held longer than its
+// TTL has to be refreshed with Refresh in time.
+func LockRemote(client *ssh.Client, lockPath string, opts LockOptions) (*RemoteLock, error) {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	hostname, _ := os.Hostname()
+	owner := opts.Owner
+	if owner == "" {
+		owner = hostname + ":" + strconv.Itoa(os.Getpid())
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	lock := &RemoteLock{client: client, path: lockPath, holder: LockHolder{
+		Owner:    owner,
+		Host:     hostname,
+		PID:      os.Getpid(),
+		Acquired: time.Now(),
+		TTL:      ttl,
+		Token:    hex.EncodeToString(token),
+	}}
+	contents, err := json.Marshal(lock.holder)
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := shellQuote(lockPath)
+	// set -C makes the redirection fail when the file exists already
+	acquire := "mkdir -p -- " + shellQuote(path.Dir(lockPath)) + " && (set -C; printf '%s' " + shellQuote(string(contents)) + " > " + quoted + ") 2>/dev/null && echo acquired || " +
+		"{ date +%s; stat -c %Y -- " + quoted + "; cat -- " + quoted + "; }"
+	deadline := time.Now().Add(opts.Wait)
+	for vanished := 0; ; {
+		output, err := ExecuteCommand(client, acquire)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(output) == "acquired" {
+			return lock, nil
+		}
+
+		lines := strings.SplitN(output, "\n", 3)
+		if len(lines) < 3 {
+			// Released between the two commands, unless it cannot be
+			// created at all
+			if vanished++; vanished == 3 {
+				return nil, errors.New("goScp: cannot create remote lock " + lockPath)
+			}
+			continue
+		}
+		vanished = 0
+		now, _ := strconv.ParseInt(lines[0], 10, 64)
+		mtime, _ := strconv.ParseInt(lines[1], 10, 64)
+		held := lines[2]
+		var holder LockHolder
+		if err := json.Unmarshal([]byte(held), &holder); err != nil || holder.TTL <= 0 {
+			holder.TTL = ttl
+		}
+		expired := time.Duration(now-mtime)*time.Second > holder.TTL
+		if opts.Steal == AlwaysSteal || opts.Steal == StealExpired && expired {
+			// Only remove the lock that was looked at, not one that
+			// replaced it meanwhile
+			steal := "if [ \"$(cat -- " + quoted + ")\" = " + shellQuote(held) + " ]; then rm -f -- " + quoted + "; fi"
+			if _, err := ExecuteCommand(client, steal); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &LockedError{Path: lockPath, Holder: holder}
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Holder returns what the lock file tells about this lock.
+func (l *RemoteLock) Holder() LockHolder {
+	return l.holder
+}
+
+// Refresh restarts the TTL of the lock. It fails with ErrLockLost when the
+// lock is not held by l anymore.
+func (l *RemoteLock) Refresh() error {
+	return l.ifHeld("touch -c -- " + shellQuote(l.path))
+}
+
+// Unlock releases the lock. It fails with ErrLockLost when the lock is not
+// held by l anymore, which means the work it protected may have overlapped
+// with that of another holder.
+func (l *RemoteLock) Unlock() error {
+	return l.ifHeld("rm -f -- " + shellQuote(l.path))
+}
+
+// ifHeld runs cmd when the lock file is still the one of l.
+func (l *RemoteLock) ifHeld(cmd string) error {
+	output, err := ExecuteCommand(l.client, "if grep -qF -- "+shellQuote(l.holder.Token)+" "+shellQuote(l.path)+" 2>/dev/null; then "+cmd+" && echo held; fi")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(output) != "held" {
+		return ErrLockLost
+	}
+	return nil
+}
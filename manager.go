@@ -0,0 +1,269 @@
+package goScp
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"sync"
+)
+
+// ErrShutdown is returned for work handed to a TransferManager or ClientPool
+// after Shutdown was called.
+var ErrShutdown = errors.New("goScp: shut down")
+
+// TransferManagerOptions configures a TransferManager.
+type TransferManagerOptions struct {
+	// Concurrency is the maximum number of transfers running at once. Zero or
+	// less means 4.
+	Concurrency int
+	// BandwidthLimit caps the combined throughput of every transfer in bytes
+	// per second. Zero or less means unlimited.
+	BandwidthLimit int64
+	// BufferSize is the size of the buffers data is copied through, shared
+	// by all transfers of the manager. Larger buffers mean fewer, larger
+	// writes on fast links. Zero or less means 32KB.
+	BufferSize int
+	// Classes sets limits for the transfers with hosts of a BandwidthClass,
+	// e.g. a low bandwidth limit for metered links. Transfers with hosts
+	// without a class, or one not listed, only have the limits above.
+	Classes map[BandwidthClass]BandwidthClassLimits
+}
+
+// TransferManager runs queued transfers in priority order, never more than
+// its concurrency at once and within its bandwidth limit. Higher priorities
+// run first; equal priorities run in the order they were queued.
+type TransferManager struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	queue       transferQueue
+	sequence    int64
+	concurrency int
+	running     int
+	paused      bool
+	shutdown    bool
+	pending     map[*Transfer]bool
+	throttle    *throttle
+	buffers     *bufferPool
+	classes     map[BandwidthClass]classLimits
+}
+
+// NewTransferManager returns a running TransferManager.
+func NewTransferManager(opts TransferManagerOptions) *TransferManager {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	m := &TransferManager{
+		concurrency: concurrency,
+		pending:     map[*Transfer]bool{},
+		throttle:    newThrottle(opts.BandwidthLimit),
+		buffers:     defaultBuffers,
+		classes:     map[BandwidthClass]classLimits{},
+	}
+	if opts.BufferSize > 0 {
+		m.buffers = newBufferPool(opts.BufferSize)
+	}
+	for class, limits := range opts.Classes {
+		settings := classLimits{throttle: newThrottle(limits.BandwidthLimit), buffers: m.buffers}
+		if limits.BufferSize > 0 {
+			settings.buffers = newBufferPool(limits.BufferSize)
+		}
+		m.classes[class] = settings
+	}
+	m.cond = sync.NewCond(&m.mu)
+	go m.dispatch()
+	return m
+}
+
+// EnqueueUpload queues CopyLocalFileToRemote with priority.
+func (m *TransferManager) EnqueueUpload(client *ssh.Client, localFilePath string, filename string, priority int, opts ...TransferOption) *Transfer {
+	return m.enqueue(client, priority, opts, func(opts []TransferOption) error {
+		return CopyLocalFileToRemote(client, localFilePath, filename, opts...)
+	})
+}
+
+// EnqueueDownload queues CopyRemoteFileToLocal with priority.
+func (m *TransferManager) EnqueueDownload(client *ssh.Client, remoteFilePath string, remoteFilename string, localFilePath string, localFileName string, priority int, opts ...TransferOption) *Transfer {
+	return m.enqueue(client, priority, opts, func(opts []TransferOption) error {
+		return CopyRemoteFileToLocal(client, remoteFilePath, remoteFilename, localFilePath, localFileName, opts...)
+	})
+}
+
+// Pause stops starting queued transfers and holds the data of running ones
+// until Resume is called.
+func (m *TransferManager) Pause() {
+	m.mu.Lock()
+	m.paused = true
+	m.mu.Unlock()
+	m.setPaused(true)
+}
+
+// Resume continues after Pause.
+func (m *TransferManager) Resume() {
+	m.setPaused(false)
+	m.mu.Lock()
+	m.paused = false
+	m.cond.Broadcast()
+	m.mu.Unlock()
+}
+
+// setPaused pauses or resumes the throttles of the manager and its classes.
+func (m *TransferManager) setPaused(paused bool) {
+	m.throttle.setPaused(paused)
+	for _, class := range m.classes {
+		class.throttle.setPaused(paused)
+	}
+}
+
+// Shutdown stops accepting transfers and waits for the queued and running
+// ones to finish. Once ctx is done, the transfers still left are canceled,
+// and Shutdown returns the error of ctx after they have stopped. Transfers
+// enqueued after Shutdown finish with ErrShutdown straight away.
+func (m *TransferManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.shutdown = true
+	m.cond.Broadcast()
+	pending := make([]*Transfer, 0, len(m.pending))
+	for t := range m.pending {
+		pending = append(pending, t)
+	}
+	m.mu.Unlock()
+
+	for i, t := range pending {
+		select {
+		case <-t.Done():
+		case <-ctx.Done():
+			for _, t := range pending[i:] {
+				t.Cancel()
+			}
+			for _, t := range pending[i:] {
+				t.Wait()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Len returns the number of transfers waiting in the queue.
+func (m *TransferManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queue.Len()
+}
+
+func (m *TransferManager) enqueue(client *ssh.Client, priority int, opts []TransferOption, run func(opts []TransferOption) error) *Transfer {
+	// Leave the backing array of the caller to its other transfers
+	opts = append(opts[:len(opts):len(opts)], withThrottle(m.throttle), withBufferPool(m.buffers))
+	if class, ok := m.classes[bandwidthClassOf(client)]; ok {
+		opts = append(opts, withThrottle(class.throttle), withBufferPool(class.buffers))
+	}
+	t, opts := newTransfer(opts)
+	item := &queuedTransfer{transfer: t, opts: opts, run: run, priority: priority}
+
+	m.mu.Lock()
+	if m.shutdown {
+		m.mu.Unlock()
+		t.run(func([]TransferOption) error { return ErrShutdown }, opts)
+		return t
+	}
+	m.pending[t] = true
+	item.sequence = m.sequence
+	m.sequence++
+	heap.Push(&m.queue, item)
+	m.cond.Broadcast()
+	m.mu.Unlock()
+
+	// Transfers canceled while queued finish right away
+	go func() {
+		<-t.ctx.Done()
+		m.mu.Lock()
+		queued := item.index >= 0
+		if queued {
+			heap.Remove(&m.queue, item.index)
+			// dispatch may be waiting for the queue to empty to return
+			m.cond.Broadcast()
+		}
+		m.mu.Unlock()
+		if queued {
+			t.run(run, opts)
+		}
+	}()
+	go func() {
+		<-t.Done()
+		m.mu.Lock()
+		delete(m.pending, t)
+		m.mu.Unlock()
+	}()
+	return t
+}
+
+// dispatch starts queued transfers whenever the manager has room for them,
+// until the manager is shut down and its queue is empty.
+func (m *TransferManager) dispatch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		for m.paused || m.running >= m.concurrency || m.queue.Len() == 0 {
+			if m.shutdown && m.queue.Len() == 0 {
+				return
+			}
+			m.cond.Wait()
+		}
+
+		item := heap.Pop(&m.queue).(*queuedTransfer)
+		m.running++
+		go func() {
+			item.transfer.run(item.run, item.opts)
+			m.mu.Lock()
+			m.running--
+			m.cond.Broadcast()
+			m.mu.Unlock()
+		}()
+	}
+}
+
+// queuedTransfer is a Transfer waiting in a TransferManager.
+type queuedTransfer struct {
+	transfer *Transfer
+	opts     []TransferOption
+	run      func(opts []TransferOption) error
+	priority int
+	sequence int64
+	index    int
+}
+
+// transferQueue implements heap.Interface, ordered by priority and then by the
+// order transfers were queued in.
+type transferQueue []*queuedTransfer
+
+func (q transferQueue) Len() int { return len(q) }
+
+func (q transferQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q transferQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *transferQueue) Push(x interface{}) {
+	item := x.(*queuedTransfer)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *transferQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,81 @@
+package goScp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransferManagerShutdownWhilePaused(t *testing.T) {
+	_, client, _ := startServer(t)
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "big"), make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(localDir, "small"), []byte("small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := goScp.NewTransferManager(goScp.TransferManagerOptions{Concurrency: 1, BandwidthLimit: 64 * 1024})
+	running := manager.EnqueueUpload(client, localDir, "big", 0)
+	queued := manager.EnqueueUpload(client, localDir, "small", 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for transferred, _ := running.Progress(); transferred == 0; transferred, _ = running.Progress() {
+		if time.Now().After(deadline) {
+			t.Fatal("the transfer did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	manager.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- manager.Shutdown(ctx) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown: got %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown of a paused manager hung")
+	}
+	if running.Err() == nil || queued.Err() == nil {
+		t.Errorf("canceled transfers finished with %v and %v", running.Err(), queued.Err())
+	}
+}
+
+func TestTransferManagerSharedOptions(t *testing.T) {
+	_, client, _ := startServer(t)
+	localDir := t.TempDir()
+	sizes := map[string]int{"one": 1000, "two": 2000}
+	for name, size := range sizes {
+		if err := ioutil.WriteFile(filepath.Join(localDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := goScp.NewTransferManager(goScp.TransferManagerOptions{Concurrency: 1})
+	defer manager.Shutdown(context.Background())
+	manager.Pause()
+	// Room left in the backing array for the options the manager adds
+	opts := append(make([]goScp.TransferOption, 0, 16), goScp.WithFileMode(0600))
+	transfers := map[string]*goScp.Transfer{}
+	for _, name := range []string{"one", "two"} {
+		transfers[name] = manager.EnqueueUpload(client, localDir, name, 0, opts...)
+	}
+	manager.Resume()
+
+	for name, transfer := range transfers {
+		if err := transfer.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if transferred, total := transfer.Progress(); transferred != int64(sizes[name]) || total != int64(sizes[name]) {
+			t.Errorf("%s reported %d of %d bytes, want %d", name, transferred, total, sizes[name])
+		}
+	}
+}
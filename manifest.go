@@ -0,0 +1,71 @@
+package goScp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction tells whether a file was uploaded or downloaded.
+type Direction string
+
+const (
+	Upload   Direction = "upload"
+	Download Direction = "download"
+	// Relay is a copy between two remote hosts through the local one. The
+	// local path is the path on the source host then.
+	Relay Direction = "relay"
+)
+
+// ManifestEntry describes a single transferred file.
+type ManifestEntry struct {
+	Direction  Direction `json:"direction"`
+	LocalPath  string    `json:"local_path"`
+	RemotePath string    `json:"remote_path"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Time       time.Time `json:"time"`
+}
+
+// Manifest records every file transferred with WithManifest, for audit trails
+// and reproducible deployments. It is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	entries []ManifestEntry
+}
+
+func (m *Manifest) add(entry ManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+}
+
+func (m *Manifest) record(direction Direction, localPath string, remotePath string, size int64, sum []byte) {
+	m.add(ManifestEntry{
+		Direction:  direction,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Size:       size,
+		SHA256:     hex.EncodeToString(sum),
+		Time:       time.Now().UTC(),
+	})
+}
+
+// Entries returns a copy of the recorded entries in the order the transfers
+// finished.
+func (m *Manifest) Entries() []ManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ManifestEntry(nil), m.entries...)
+}
+
+// WriteJSON writes the manifest to w as an indented JSON document.
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Files []ManifestEntry `json:"files"`
+	}{Files: m.Entries()})
+}
@@ -0,0 +1,130 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"sync"
+)
+
+// ErrNoBackend is returned by NegotiateTransferrer when the remote host offers
+// none of the supported transfer backends.
+var ErrNoBackend = errors.New("goScp: remote host supports no transfer backend")
+
+// BackendNegotiation records what NegotiateTransferrer found on the remote
+// host and which backend it picked, for debugging.
+type BackendNegotiation struct {
+	SFTPAvailable bool
+	SFTPError     error
+	SCPAvailable  bool
+	TarAvailable  bool
+	Chosen        string
+}
+
+// String summarizes the negotiation, e.g. "sftp (sftp=yes scp=yes tar=yes)".
+func (n BackendNegotiation) String() string {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	chosen := n.Chosen
+	if chosen == "" {
+		chosen = "none"
+	}
+	return fmt.Sprintf("%s (sftp=%s scp=%s tar=%s)", chosen, yesNo(n.SFTPAvailable), yesNo(n.SCPAvailable), yesNo(n.TarAvailable))
+}
+
+// backendNegotiations holds a *backendProbe for every client negotiated so
+// far, for GetClientInfo.
+var backendNegotiations sync.Map
+
+// backendProbe negotiates the backend of a client once.
+type backendProbe struct {
+	once        sync.Once
+	negotiation *BackendNegotiation
+}
+
+// NegotiateTransferrer probes the remote host for the SFTP subsystem and for
+// scp and tar binaries, and returns the best available backend in that order
+// of preference. The probe runs once per client, later calls and
+// GetClientInfo reuse its outcome.
+func NegotiateTransferrer(client *ssh.Client) (Transferrer, *BackendNegotiation, error) {
+	negotiation, sftpClient := probeBackend(client)
+
+	switch negotiation.Chosen {
+	case "sftp":
+		if sftpClient == nil {
+			var err error
+			if sftpClient, err = sftp.NewClient(client); err != nil {
+				return nil, negotiation, err
+			}
+		}
+		return &sftpTransferrer{client: client, sftp: sftpClient}, negotiation, nil
+	case "scp":
+		return NewSCPTransferrer(client), negotiation, nil
+	case "tar":
+		return NewTarTransferrer(client), negotiation, nil
+	}
+	return nil, negotiation, ErrNoBackend
+}
+
+// probeBackend returns the negotiation of client, probing the remote host on
+// the first call only. The SFTP client opened by the probe is returned to the
+// call that ran it, which has to close it.
+func probeBackend(client *ssh.Client) (*BackendNegotiation, *sftp.Client) {
+	entry, _ := backendNegotiations.LoadOrStore(client, &backendProbe{})
+	probe := entry.(*backendProbe)
+	var sftpClient *sftp.Client
+	probe.once.Do(func() {
+		probe.negotiation, sftpClient = negotiateBackend(client)
+	})
+	return probe.negotiation, sftpClient
+}
+
+// negotiatedBackend is probeBackend for callers that only report the
+// negotiation.
+func negotiatedBackend(client *ssh.Client) *BackendNegotiation {
+	negotiation, sftpClient := probeBackend(client)
+	if sftpClient != nil {
+		sftpClient.Close()
+	}
+	return negotiation
+}
+
+// negotiateBackend probes for the backends, along with the SFTP client when
+// the SFTP subsystem is available.
+func negotiateBackend(client *ssh.Client) (*BackendNegotiation, *sftp.Client) {
+	negotiation := &BackendNegotiation{}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err == nil {
+		negotiation.SFTPAvailable = true
+	} else {
+		negotiation.SFTPError = err
+	}
+
+	// scp is looked for where the scp backend runs it by default.
+	output, _ := ExecuteCommand(client, "test -x /usr/bin/scp && echo scp; command -v tar >/dev/null 2>&1 && echo tar; true")
+	for _, line := range strings.Split(output, "\n") {
+		switch strings.TrimSpace(line) {
+		case "scp":
+			negotiation.SCPAvailable = true
+		case "tar":
+			negotiation.TarAvailable = true
+		}
+	}
+
+	switch {
+	case negotiation.SFTPAvailable:
+		negotiation.Chosen = "sftp"
+	case negotiation.SCPAvailable:
+		negotiation.Chosen = "scp"
+	case negotiation.TarAvailable:
+		negotiation.Chosen = "tar"
+	}
+	return negotiation, sftpClient
+}
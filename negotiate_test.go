@@ -0,0 +1,55 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"golang.org/x/crypto/ssh"
+	"testing"
+)
+
+func TestGetClientInfoNegotiatesBackend(t *testing.T) {
+	server, _, _ := startServer(t)
+	client, err := goScp.Connect(writeKeyfile(t), goScp.SSHCredentials{Username: "test"}, server.RemoteHost(), false, goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	backend := goScp.GetClientInfo(client).Backend
+	if backend == nil {
+		t.Fatal("GetClientInfo did not negotiate a backend")
+	}
+	if !backend.SFTPAvailable || backend.Chosen != "sftp" {
+		t.Errorf("Backend = %v, want sftp", backend)
+	}
+	if again := goScp.GetClientInfo(client).Backend; again != backend {
+		t.Errorf("second GetClientInfo negotiated again: %v", again)
+	}
+}
+
+func TestNegotiateTransferrerProbesOnce(t *testing.T) {
+	_, client, _ := startServer(t)
+
+	transferrer, negotiation, err := goScp.NegotiateTransferrer(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transferrer.Close()
+	if transferrer.Name() != negotiation.Chosen {
+		t.Errorf("NegotiateTransferrer returned %s, negotiated %s", transferrer.Name(), negotiation.Chosen)
+	}
+	if backend := goScp.GetClientInfo(client).Backend; backend != negotiation {
+		t.Errorf("Backend = %v, want the negotiation %v", backend, negotiation)
+	}
+
+	again, renegotiation, err := goScp.NegotiateTransferrer(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if renegotiation != negotiation {
+		t.Errorf("second NegotiateTransferrer negotiated again: %v", renegotiation)
+	}
+	if again.Name() != negotiation.Chosen {
+		t.Errorf("second NegotiateTransferrer returned %s, negotiated %s", again.Name(), negotiation.Chosen)
+	}
+}
@@ -0,0 +1,399 @@
+package goScp
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TransferOption configures a single file upload or download.
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	growthPolicy      GrowthPolicy
+	quietPeriod       time.Duration
+	remoteSnapshot    bool
+	remoteTTL         time.Duration
+	securityContext   bool
+	permissionMask    os.FileMode
+	forcedFileMode    os.FileMode
+	manifest          *Manifest
+	ctx               context.Context
+	progress          ProgressFunc
+	throttles         []*throttle
+	spaceCheck        bool
+	localSpaceCheck   bool
+	confirmLocalSpace LocalSpaceFunc
+	skipIdentical     bool
+	onSkip            func()
+	onSent            func(size int64, sum []byte)
+	eventSink         EventSink
+	events            *transferEvents
+	transformers      []Transformer
+	buffers           *bufferPool
+	tracer            *protocolTracer
+	scpPath           string
+	scpCompat         bool
+	timeout           time.Duration
+	cancelTimeout     context.CancelFunc
+	verifyRetries     int
+	sparse            bool
+	hostName          string
+	httpClient        *http.Client
+}
+
+func newTransferOptions(opts []TransferOption) *transferOptions {
+	options := &transferOptions{
+		growthPolicy: SnapshotAtDeclaredSize,
+		quietPeriod:  2 * time.Second,
+		buffers:      defaultBuffers,
+		scpPath:      "/usr/bin/scp",
+		// Uploads are not verified
+		verifyRetries: -1,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithGrowthPolicy sets what a download does when the remote file grows past
+// the size announced by scp. The default is SnapshotAtDeclaredSize.
+func WithGrowthPolicy(policy GrowthPolicy) TransferOption {
+	return func(o *transferOptions) {
+		o.growthPolicy = policy
+	}
+}
+
+// WithQuietPeriod sets how long a remote file must stop growing before a
+// FollowUntilQuiet download is considered complete.
+func WithQuietPeriod(period time.Duration) TransferOption {
+	return func(o *transferOptions) {
+		o.quietPeriod = period
+	}
+}
+
+// WithRemoteSnapshot makes a download first copy the remote file to a
+// temporary file on the remote host and serve that copy, so files under active
+// modification are read in a consistent state. The copy is removed afterwards.
+func WithRemoteSnapshot() TransferOption {
+	return func(o *transferOptions) {
+		o.remoteSnapshot = true
+	}
+}
+
+// WithRemoteTTL makes an upload schedule the deletion of the remote file once
+// ttl has passed, for temporary hand-offs of sensitive data. The deletion is
+// scheduled with systemd-run or at, or with a detached sleep on hosts having
+// neither; the upload fails when it cannot be scheduled.
+func WithRemoteTTL(ttl time.Duration) TransferOption {
+	return func(o *transferOptions) {
+		o.remoteTTL = ttl
+	}
+}
+
+// WithSecurityContext makes a transfer carry the extended POSIX ACL and the
+// SELinux context of the source file over to the copy, which scp drops
+// otherwise. They are read with getfacl and stat and set with setfacl and
+// chcon, on the local host for local files. Whatever the source does not have
+// is left as the destination sets it; a destination unable to take what the
+// source has fails the transfer after the contents were copied.
+func WithSecurityContext() TransferOption {
+	return func(o *transferOptions) {
+		o.securityContext = true
+	}
+}
+
+// WithPermissionMask clears the permission bits set in mask on every uploaded
+// file and directory, like a umask. 0022 strips group and other write access.
+func WithPermissionMask(mask os.FileMode) TransferOption {
+	return func(o *transferOptions) {
+		o.permissionMask = mask
+	}
+}
+
+// WithFileMode uploads every file with mode instead of its local permissions.
+// A permission mask is still applied on top of it.
+func WithFileMode(mode os.FileMode) TransferOption {
+	return func(o *transferOptions) {
+		o.forcedFileMode = mode
+	}
+}
+
+// WithManifest records every file the transfer copies in manifest.
+func WithManifest(manifest *Manifest) TransferOption {
+	return func(o *transferOptions) {
+		o.manifest = manifest
+	}
+}
+
+// WithContext aborts the transfer once ctx is done. The transfer then returns
+// the error of ctx.
+func WithContext(ctx context.Context) TransferOption {
+	return func(o *transferOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithProgress calls progress while the file is transferred.
+func WithProgress(progress ProgressFunc) TransferOption {
+	return func(o *transferOptions) {
+		o.progress = progress
+	}
+}
+
+// WithBandwidthLimit limits the transfer to bytesPerSecond.
+func WithBandwidthLimit(bytesPerSecond int64) TransferOption {
+	return func(o *transferOptions) {
+		o.throttles = append(o.throttles, newThrottle(bytesPerSecond))
+	}
+}
+
+// WithSpaceCheck makes an upload first check the free space of the remote
+// filesystem and fail with an *InsufficientSpaceError when the file does not
+// fit, instead of failing once the disk is full.
+func WithSpaceCheck() TransferOption {
+	return func(o *transferOptions) {
+		o.spaceCheck = true
+	}
+}
+
+// WithSkipIfIdentical makes an upload compare the SHA-256 of the local file
+// with the one of the remote file it would replace, and skip the upload when
+// they match, so repeated deployments only send what changed. Skipped uploads
+// succeed and are reported as Skipped by the fan-out APIs.
+func WithSkipIfIdentical() TransferOption {
+	return func(o *transferOptions) {
+		o.skipIdentical = true
+	}
+}
+
+// WithEvents sends the started, progress, completed, failed and skipped events
+// of the transfer to sink, see NewJSONEventSink.
+func WithEvents(sink EventSink) TransferOption {
+	return func(o *transferOptions) {
+		o.eventSink = sink
+	}
+}
+
+// WithEncryption encrypts uploads with AES-GCM under key before they leave the
+// local host, and decrypts downloads of files uploaded that way, so files kept
+// on semi-trusted hosts are protected at rest. key must be 16, 24 or 32 bytes
+// long and is never sent to the remote host. It is a shorthand for
+// WithTransformers(NewEncryptionTransformer(key)).
+func WithEncryption(key []byte) TransferOption {
+	return WithTransformers(NewEncryptionTransformer(key))
+}
+
+// WithTransformers runs the contents of the transfer through transformers,
+// e.g. NewGzipTransformer followed by NewEncryptionTransformer. They apply to
+// the scp backend; growth policies are not applied to transformed downloads.
+func WithTransformers(transformers ...Transformer) TransferOption {
+	return func(o *transferOptions) {
+		o.transformers = append(o.transformers, transformers...)
+	}
+}
+
+// WithSCPPath runs the scp binary at scpPath on the remote host instead of
+// /usr/bin/scp. A name without a slash, such as "scp", is looked up in the
+// PATH of the remote shell.
+func WithSCPPath(scpPath string) TransferOption {
+	return func(o *transferOptions) {
+		o.scpPath = scpPath
+	}
+}
+
+// WithSCPCompatibility talks to the scp of embedded systems, such as the one
+// of Dropbear on BusyBox based routers: scp is looked up in the PATH, since it
+// is rarely installed as /usr/bin/scp there, and file records with short modes
+// such as C644 are accepted.
+func WithSCPCompatibility() TransferOption {
+	return func(o *transferOptions) {
+		o.scpPath = "scp"
+		o.scpCompat = true
+	}
+}
+
+// withHostName names the host of the transfer in its events.
+func withHostName(name string) TransferOption {
+	return func(o *transferOptions) {
+		o.hostName = name
+	}
+}
+
+// withSkipNotify calls onSkip when WithSkipIfIdentical skips the upload.
+func withSkipNotify(onSkip func()) TransferOption {
+	return func(o *transferOptions) {
+		o.onSkip = onSkip
+	}
+}
+
+// withSentNotify calls onSent with the size and SHA-256 of what an scp upload
+// sent, which differ from the local file with transformers.
+func withSentNotify(onSent func(size int64, sum []byte)) TransferOption {
+	return func(o *transferOptions) {
+		o.onSent = onSent
+	}
+}
+
+// withThrottle shares throttle with other transfers, e.g. every transfer of a
+// TransferManager.
+func withThrottle(throttle *throttle) TransferOption {
+	return func(o *transferOptions) {
+		o.throttles = append(o.throttles, throttle)
+	}
+}
+
+// scpCommand returns the command line running scp with flag on remotePath.
+func (o *transferOptions) scpCommand(flag string, remotePath string) string {
+	return o.scpPath + " " + flag + " " + shellQuote(remotePath)
+}
+
+// transferContext returns the context the transfer runs under.
+func (o *transferOptions) transferContext() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// skipped reports an upload skipped by WithSkipIfIdentical.
+func (o *transferOptions) skipped() {
+	if o.onSkip != nil {
+		o.onSkip()
+	}
+	if o.events != nil {
+		o.events.emit(EventSkipped, 0, o.events.total, nil)
+		o.events = nil
+	}
+}
+
+// fileMode returns the permissions an uploaded file with the local mode should
+// get on the remote host.
+func (o *transferOptions) fileMode(mode os.FileMode) os.FileMode {
+	if o.forcedFileMode != 0 {
+		mode = o.forcedFileMode
+	}
+	return mode.Perm() &^ o.permissionMask
+}
+
+// CommandOption configures a remote command run by ExecuteCommand.
+type CommandOption func(*commandOptions)
+
+type commandOptions struct {
+	env             []envVar
+	dir             string
+	agentForwarding bool
+	timeout         time.Duration
+	lineCallbacks   []LineFunc
+}
+
+type envVar struct {
+	name  string
+	value string
+}
+
+func newCommandOptions(opts []CommandOption) *commandOptions {
+	options := &commandOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithEnv sets the environment variable name to value for the command. The
+// variable is passed with session.Setenv, or exported by the command itself
+// when the server does not accept it.
+func WithEnv(name string, value string) CommandOption {
+	return func(o *commandOptions) {
+		o.env = append(o.env, envVar{name: name, value: value})
+	}
+}
+
+// WithWorkingDir runs the command in dir instead of the login directory.
+func WithWorkingDir(dir string) CommandOption {
+	return func(o *commandOptions) {
+		o.dir = dir
+	}
+}
+
+// WithAgentForwarding forwards the local SSH agent to the command, so it can
+// authenticate to other hosts with the local keys, e.g. for a git pull.
+func WithAgentForwarding() CommandOption {
+	return func(o *commandOptions) {
+		o.agentForwarding = true
+	}
+}
+
+// ConnectOption configures how Connect authenticates and talks to the remote
+// host.
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	challengeResponder ChallengeResponder
+	gssapiClient       ssh.GSSAPIClient
+	gssapiTarget       string
+	algorithms         *AlgorithmPolicy
+	legacyAlgorithms   bool
+	hostKeyCallback    ssh.HostKeyCallback
+	hostKeyInspectors  []func(HostKeyInfo) error
+	bannerCallbacks    []func(banner string)
+	auth               authRecorder
+	connectTimeout     time.Duration
+	dialer             DialFunc
+	attemptDelay       time.Duration
+	resolver           Resolver
+	dnsCache           *dnsCache
+	dialLimiter        *DialLimiter
+}
+
+func newConnectOptions(opts []ConnectOption) *connectOptions {
+	options := &connectOptions{auth: authRecorder{method: "publickey"}}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// configure applies the options to config for connecting to remoteMachine.
+func (o *connectOptions) configure(config *ssh.ClientConfig, remoteMachine RemoteHost) {
+	if o.gssapiClient != nil {
+		target := o.gssapiTarget
+		if target == "" {
+			target = remoteMachine.Host
+		}
+		config.Auth = append(config.Auth, ssh.GSSAPIWithMICAuthMethod(o.auth.gssapi(o.gssapiClient), target))
+	}
+	if o.challengeResponder != nil {
+		config.Auth = append(config.Auth, ssh.KeyboardInteractive(o.auth.keyboardInteractive(o.challengeResponder)))
+	}
+	config.HostKeyCallback = o.inspectHostKeys(o.hostKeyCallback)
+	config.BannerCallback = o.showBanners(config.BannerCallback)
+	if o.legacyAlgorithms {
+		applyLegacy(config)
+	}
+	if o.algorithms != nil {
+		o.algorithms.apply(config)
+	}
+}
+
+// WithChallengeResponder adds keyboard-interactive authentication, answering
+// the server's prompts with responder.
+func WithChallengeResponder(responder ChallengeResponder) ConnectOption {
+	return func(o *connectOptions) {
+		o.challengeResponder = responder
+	}
+}
+
+// WithGSSAPI adds GSSAPI authentication, e.g. with a Kerberos ticket, for
+// servers where key authentication is disabled. gssapiClient is provided by a
+// Kerberos implementation of the caller's choice. target is the host name the
+// service ticket is requested for and defaults to the host being connected to.
+func WithGSSAPI(gssapiClient ssh.GSSAPIClient, target string) ConnectOption {
+	return func(o *connectOptions) {
+		o.gssapiClient = gssapiClient
+		o.gssapiTarget = target
+	}
+}
@@ -0,0 +1,140 @@
+package goScp
+
+import (
+	"bytes"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputStream tells which output of a remote command a line was written to.
+type OutputStream string
+
+const (
+	StreamStdout OutputStream = "stdout"
+	StreamStderr OutputStream = "stderr"
+)
+
+// OutputLine is a line a remote command wrote, without the line break, with
+// the time it arrived.
+type OutputLine struct {
+	Stream OutputStream
+	Text   string
+	Time   time.Time
+}
+
+// CombinedOutput collects the lines a remote command writes to stdout and
+// stderr in the order they arrive, see WithCombinedOutput. It is safe to read
+// while the command runs.
+type CombinedOutput struct {
+	mu    sync.Mutex
+	lines []OutputLine
+}
+
+// Lines returns the lines collected so far.
+func (o *CombinedOutput) Lines() []OutputLine {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutputLine(nil), o.lines...)
+}
+
+// String returns the lines collected so far, one per line with the time they
+// arrived and the stream they were written to, e.g.
+//
+//	12:00:01.250 stderr: cp: cannot stat 'x': No such file or directory
+func (o *CombinedOutput) String() string {
+	var b strings.Builder
+	for _, line := range o.Lines() {
+		b.WriteString(line.Time.Format("15:04:05.000") + " " + string(line.Stream) + ": " + line.Text + "\n")
+	}
+	return b.String()
+}
+
+func (o *CombinedOutput) add(stream OutputStream, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = append(o.lines, OutputLine{Stream: stream, Text: text, Time: time.Now()})
+}
+
+// WithCombinedOutput collects what the command writes to stdout and stderr in
+// output, interleaved in arrival order and timestamped, which tells what a
+// failing remote script did right before the error. The output ExecuteCommand
+// returns is still stdout only. Both streams travel separately over the
+// connection, so lines written at nearly the same time may swap places.
+func WithCombinedOutput(output *CombinedOutput) CommandOption {
+	return func(o *commandOptions) {
+		o.lineCallbacks = append(o.lineCallbacks, output.add)
+	}
+}
+
+// LineFunc is called with every line a remote command writes, without the
+// line break.
+type LineFunc func(stream OutputStream, line string)
+
+// OnLine calls fn with every line the command writes to stdout or stderr as
+// soon as it arrives, e.g. to react to a prompt or a progress marker while
+// the command runs. A last line without a line break, such as a "Password:"
+// prompt, is only passed once the command exited, RunExpect answers those.
+// fn is never called concurrently.
+func OnLine(fn LineFunc) CommandOption {
+	return func(o *commandOptions) {
+		o.lineCallbacks = append(o.lineCallbacks, fn)
+	}
+}
+
+// attachOutput connects stdout and stderr of session to stdout and the line
+// callbacks of o. The returned function passes unterminated last lines to the
+// callbacks, it is called once the command exited.
+func (o *commandOptions) attachOutput(session *ssh.Session, stdout io.Writer) (flush func()) {
+	session.Stdout = stdout
+	if len(o.lineCallbacks) == 0 {
+		return func() {}
+	}
+
+	// The streams are copied by separate goroutines
+	var mu sync.Mutex
+	emit := func(stream OutputStream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, callback := range o.lineCallbacks {
+			callback(stream, line)
+		}
+	}
+	stdoutLines := &lineWriter{stream: StreamStdout, emit: emit}
+	stderrLines := &lineWriter{stream: StreamStderr, emit: emit}
+	session.Stdout = io.MultiWriter(stdout, stdoutLines)
+	session.Stderr = stderrLines
+	return func() {
+		stdoutLines.flush()
+		stderrLines.flush()
+	}
+}
+
+// lineWriter splits what is written to it into lines and passes them to emit.
+type lineWriter struct {
+	stream  OutputStream
+	emit    LineFunc
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.stream, strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.emit(w.stream, strings.TrimSuffix(string(w.partial), "\r"))
+		w.partial = nil
+	}
+}
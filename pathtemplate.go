@@ -0,0 +1,64 @@
+package goScp
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PathVars are the values available to path templates, e.g.
+// /var/backups/{{.Hostname}}/{{.Date}}/db.sql.
+type PathVars struct {
+	// Host and Port are the address of the remote host.
+	Host string
+	Port string
+	// Hostname is the Name of the host, or Host without one.
+	Hostname string
+	// User is the user logging in to the host.
+	User string
+	// Filename is the base name of the file transferred, the local one for
+	// uploads and the remote one for downloads.
+	Filename string
+	// Date is the day of the transfer as 2006-01-02 and Time its time of day
+	// as 150405, both in UTC. Now is the full time for custom layouts, e.g.
+	// {{.Now.Format "2006/01"}}.
+	Date string
+	Time string
+	Now  time.Time
+}
+
+// newPathVars returns the variables for a transfer of file to or from target,
+// happening now.
+func newPathVars(target distributeTarget, file string) PathVars {
+	now := time.Now().UTC()
+	vars := PathVars{
+		Host:     target.host.Host,
+		Port:     target.host.Port,
+		Hostname: target.host.DisplayName(),
+		User:     target.credentials.Username,
+		Filename: filepath.Base(file),
+		Date:     now.Format("2006-01-02"),
+		Time:     now.Format("150405"),
+		Now:      now,
+	}
+	return vars
+}
+
+// ExpandPath expands the Go template placeholders of pattern with vars.
+// Patterns without placeholders are returned as they are.
+func ExpandPath(pattern string, vars PathVars) (string, error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return "", err
+	}
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, vars); err != nil {
+		return "", err
+	}
+	return expanded.String(), nil
+}
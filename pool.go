@@ -0,0 +1,174 @@
+package goScp
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"sync"
+	"time"
+)
+
+// poolKeepaliveTimeout is how long a pooled connection may take to answer a
+// keepalive before it counts as dead.
+const poolKeepaliveTimeout = 10 * time.Second
+
+// ClientPool shares one SSH connection per user, host and port between every
+// operation that asks for it.
+//
+// Clients returned by a pool are owned by the pool. Callers may open their own
+// sessions, port forwards and subsystems on them next to the transfers the
+// library runs, but must not Close them; use Evict to drop a single broken
+// connection, Close to tear down the whole pool or Shutdown to do so once the
+// transfers running on it have finished.
+type ClientPool struct {
+	mu       sync.Mutex
+	clients  map[string]*ssh.Client
+	shutdown bool
+	dnsCache *dnsCache
+}
+
+// NewClientPool returns an empty pool.
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: map[string]*ssh.Client{}}
+}
+
+// CacheDNS makes the pool keep the addresses host names resolve to for ttl,
+// so connecting to the same host as several users or again after Evict does
+// not look it up every time. It applies to the connections dialed afterwards,
+// on top of the Resolver of WithResolver.
+func (p *ClientPool) CacheDNS(ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dnsCache = newDNSCache(ttl)
+}
+
+// Connect returns the pooled connection for the user and remote machine,
+// dialing it with the same arguments as the package level Connect the first
+// time it is asked for.
+func (p *ClientPool) Connect(sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool, opts ...ConnectOption) (*ssh.Client, error) {
+	key := poolKey(sshCredentials, remoteMachine)
+
+	p.mu.Lock()
+	client, ok := p.clients[key]
+	shutdown := p.shutdown
+	cache := p.dnsCache
+	p.mu.Unlock()
+	if shutdown {
+		return nil, ErrShutdown
+	}
+	if ok {
+		return client, nil
+	}
+
+	if cache != nil {
+		opts = append(opts[:len(opts):len(opts)], withDNSCache(cache))
+	}
+	// Dial without holding the lock so other hosts are not held up
+	client, err := Connect(sshKeyFile, sshCredentials, remoteMachine, usingSSHAgent, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shutdown {
+		closeClient(client)
+		return nil, ErrShutdown
+	}
+	if pooled, ok := p.clients[key]; ok {
+		closeClient(client)
+		return pooled, nil
+	}
+	p.clients[key] = client
+	return client, nil
+}
+
+// Evict closes client and removes it from the pool, so the next Connect for
+// its host dials a fresh connection.
+func (p *ClientPool) Evict(client *ssh.Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pooled := range p.clients {
+		if pooled == client {
+			delete(p.clients, key)
+		}
+	}
+	return closeClient(client)
+}
+
+// Close closes every pooled connection and empties the pool. It returns the
+// first error encountered.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for key, client := range p.clients {
+		if err := closeClient(client); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.clients, key)
+	}
+	return firstErr
+}
+
+// Shutdown stops handing out connections, Connect returns ErrShutdown from
+// then on, and waits until no session goScp opened on the pooled connections
+// is open anymore, see GetSessionStats. Then, or once ctx is done, it closes
+// the pool, which ends the sessions still open. It returns the error of ctx
+// when that cut sessions short, the error of Close otherwise.
+func (p *ClientPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.shutdown = true
+	p.mu.Unlock()
+
+	// Sessions report their end to the counts, polling them keeps this simple
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for p.openSessions() > 0 {
+		select {
+		case <-ctx.Done():
+			p.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return p.Close()
+}
+
+// openSessions returns the number of sessions open on the pooled connections.
+func (p *ClientPool) openSessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	open := 0
+	for _, client := range p.clients {
+		open += GetSessionStats(client).Open
+	}
+	return open
+}
+
+// connectionLost reports whether the connection of client is gone, rather
+// than a single operation on it having failed. The server has to answer a
+// keepalive request within poolKeepaliveTimeout.
+func connectionLost(client *ssh.Client) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+	select {
+	case err := <-reply:
+		return err != nil
+	case <-time.After(poolKeepaliveTimeout):
+		return true
+	}
+}
+
+// poolKey identifies the connection for the user and remote machine, with the
+// defaults Connect fills in applied, so an empty Port shares the connection of
+// port 22.
+func poolKey(sshCredentials SSHCredentials, remoteMachine RemoteHost) string {
+	sshCredentials.SetDefaults()
+	remoteMachine.SetDefaults()
+	return sshCredentials.Username + "@" + remoteMachine.Host + ":" + remoteMachine.Port
+}
@@ -0,0 +1,112 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestDistributeFileKeepsLivePooledClient(t *testing.T) {
+	server, _, root := startServer(t)
+	pool := goScp.NewClientPool()
+	defer pool.Close()
+	opts := goScp.DistributeOptions{
+		KeyFile:        writeKeyfile(t),
+		Credentials:    goScp.SSHCredentials{Username: "test"},
+		ConnectOptions: []goScp.ConnectOption{goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey()))},
+		Pool:           pool,
+	}
+	pooled, err := pool.Connect(opts.KeyFile, opts.Credentials, server.RemoteHost(), false, opts.ConnectOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localFile := filepath.Join(t.TempDir(), "motd")
+	if err := ioutil.WriteFile(localFile, []byte("welcome"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory does not exist, which fails the upload but not the
+	// connection
+	report := goScp.DistributeFile(localFile, []goScp.RemoteHost{server.RemoteHost()}, "missing/motd", opts)
+	if len(report.Failed()) != 1 {
+		t.Fatalf("upload into a missing directory did not fail: %+v", report.Results)
+	}
+	if _, err := goScp.ExecuteCommand(pooled, "true"); err != nil {
+		t.Fatalf("the pooled client was closed after a failed upload: %v", err)
+	}
+	client, err := pool.Connect(opts.KeyFile, opts.Credentials, server.RemoteHost(), false, opts.ConnectOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client != pooled {
+		t.Error("the pooled client was evicted after a failed upload")
+	}
+
+	report = goScp.DistributeFile(localFile, []goScp.RemoteHost{server.RemoteHost()}, "motd", opts)
+	if len(report.Failed()) != 0 {
+		t.Fatalf("upload failed: %+v", report.Results)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(root, "motd")); err != nil || string(contents) != "welcome" {
+		t.Errorf("upload arrived as %q, %v", contents, err)
+	}
+}
+
+func TestDistributeFileEvictsDeadPooledClient(t *testing.T) {
+	server, _, _ := startServer(t)
+	pool := goScp.NewClientPool()
+	defer pool.Close()
+	opts := goScp.DistributeOptions{
+		KeyFile:        writeKeyfile(t),
+		Credentials:    goScp.SSHCredentials{Username: "test"},
+		ConnectOptions: []goScp.ConnectOption{goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey()))},
+		Pool:           pool,
+	}
+	dead, err := pool.Connect(opts.KeyFile, opts.Credentials, server.RemoteHost(), false, opts.ConnectOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+	localFile := filepath.Join(t.TempDir(), "motd")
+	if err := ioutil.WriteFile(localFile, []byte("welcome"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	goScp.DistributeFile(localFile, []goScp.RemoteHost{server.RemoteHost()}, "motd", opts)
+	client, err := pool.Connect(opts.KeyFile, opts.Credentials, server.RemoteHost(), false, opts.ConnectOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == dead {
+		t.Error("the dead pooled client was not evicted")
+	}
+}
+
+func TestPoolSharesDefaultPort(t *testing.T) {
+	server, _, _ := startServer(t)
+	pool := goScp.NewClientPool()
+	defer pool.Close()
+	keyFile := writeKeyfile(t)
+	credentials := goScp.SSHCredentials{Username: "test"}
+	// Port 22 of the host is the test server
+	opts := []goScp.ConnectOption{
+		goScp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey())),
+		goScp.WithDialer(func(network string, addr string) (net.Conn, error) {
+			return net.Dial(network, server.Addr())
+		}),
+	}
+
+	implicit, err := pool.Connect(keyFile, credentials, goScp.RemoteHost{Host: "web1.example.com"}, false, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := pool.Connect(keyFile, credentials, goScp.RemoteHost{Host: "web1.example.com", Port: "22"}, false, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit != explicit {
+		t.Error("an empty Port and port 22 got separate connections")
+	}
+}
@@ -0,0 +1,74 @@
+package goScp
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"io"
+)
+
+// ProgressFunc is called while a file is transferred with the number of bytes
+// copied so far and the size of the file.
+type ProgressFunc func(transferred int64, total int64)
+
+// progressWriter reports every write to w to a ProgressFunc.
+type progressWriter struct {
+	w           io.Writer
+	transferred int64
+	total       int64
+	progress    ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.transferred += int64(n)
+	p.progress(p.transferred, p.total)
+	return n, err
+}
+
+// instrument wraps w, the destination of a transfer of total bytes, to report
+// progress and apply bandwidth limits when the options ask for it.
+func (o *transferOptions) instrument(w io.Writer, total int64) io.Writer {
+	if o.progress != nil {
+		o.progress(0, total)
+		w = &progressWriter{w: w, total: total, progress: o.progress}
+	}
+	if o.events != nil {
+		o.events.total = total
+		w = &progressWriter{w: w, total: total, progress: o.events.progress}
+	}
+	if len(o.throttles) > 0 {
+		w = &throttledWriter{ctx: o.transferContext(), w: w, throttles: o.throttles}
+	}
+	return w
+}
+
+// closeOnCancel closes session once ctx is done, aborting the transfer running
+// on it. The returned function stops watching ctx.
+func closeOnCancel(ctx context.Context, session *ssh.Session) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// contextReader fails reads once ctx is done, for transfers without a session
+// that could be closed to abort them.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
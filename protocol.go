@@ -0,0 +1,256 @@
+package goScp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrProtocol is matched by errors.Is for every malformed scp control record.
+var ErrProtocol = errors.New("goScp: scp protocol error")
+
+// ErrRemoteSCP is matched by errors.Is for every *RemoteSCPError.
+var ErrRemoteSCP = errors.New("goScp: remote scp failed")
+
+// RemoteSCPError is a warning or error message sent by the remote scp. Only
+// the status byte in front of the message tells which, the message itself is
+// in the language of the remote locale and is never interpreted.
+type RemoteSCPError struct {
+	// Fatal is set for errors, which end the transfer, and unset for
+	// warnings about a single file.
+	Fatal bool
+	// Message is the message for display, without the name of the scp
+	// program, surrounding white space and bytes that are not valid UTF-8.
+	Message string
+	// Raw is the message exactly as it was sent.
+	Raw []byte
+}
+
+func (e *RemoteSCPError) Error() string {
+	return "goScp: remote scp: " + e.Message
+}
+
+// Is lets errors.Is match a *RemoteSCPError against ErrRemoteSCP.
+func (e *RemoteSCPError) Is(target error) bool {
+	return target == ErrRemoteSCP
+}
+
+// newRemoteSCPError cleans up the message following status.
+func newRemoteSCPError(status byte, raw []byte) *RemoteSCPError {
+	message := strings.ToValidUTF8(string(raw), "")
+	message = strings.TrimFunc(message, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	message = strings.TrimPrefix(message, "scp: ")
+	if message == "" {
+		message = "no message"
+	}
+	return &RemoteSCPError{Fatal: status == statusFatal, Message: message, Raw: raw}
+}
+
+// maxRecordLength bounds a control record line, so a misbehaving remote cannot
+// make the reader buffer without limit.
+const maxRecordLength = 64 * 1024
+
+// Kinds of scp control records.
+const (
+	recordFile    = 'C'
+	recordDir     = 'D'
+	recordEndDir  = 'E'
+	recordTimes   = 'T'
+	statusOK      = 0
+	statusWarning = 1
+	statusFatal   = 2
+)
+
+// scpRecord is a parsed scp control record. Mode, Size and Name are set for C
+// and D records, Mtime and Atime for T records.
+type scpRecord struct {
+	kind  byte
+	mode  os.FileMode
+	size  int64
+	name  string
+	mtime time.Time
+	atime time.Time
+}
+
+// protocolError wraps ErrProtocol with a description of what was wrong.
+func protocolError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrProtocol, fmt.Sprintf(format, args...))
+}
+
+// parseRecord strictly parses a single control record line without its
+// trailing newline.
+func parseRecord(line string) (scpRecord, error) {
+	return parseRecordMode(line, false)
+}
+
+// parseRecordMode parses a single control record line. lenient accepts the
+// modes of one to four octal digits some embedded scp implementations send,
+// e.g. C644.
+func parseRecordMode(line string, lenient bool) (scpRecord, error) {
+	if line == "" {
+		return scpRecord{}, protocolError("empty record")
+	}
+
+	record := scpRecord{kind: line[0]}
+	switch record.kind {
+	case recordFile, recordDir:
+		// C0644 1234 name, where the name is everything after the second space
+		fields := strings.SplitN(line[1:], " ", 3)
+		if len(fields) != 3 {
+			return scpRecord{}, protocolError("malformed record %q", line)
+		}
+		if (len(fields[0]) != 4 && !(lenient && len(fields[0]) >= 1 && len(fields[0]) < 4)) || !isDigits(fields[0]) {
+			return scpRecord{}, protocolError("malformed mode in %q", line)
+		}
+		mode, err := strconv.ParseUint(fields[0], 8, 32)
+		if err != nil {
+			return scpRecord{}, protocolError("malformed mode in %q", line)
+		}
+		if !isDigits(fields[1]) {
+			return scpRecord{}, protocolError("malformed size in %q", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return scpRecord{}, protocolError("malformed size in %q", line)
+		}
+		name := fields[2]
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+			return scpRecord{}, protocolError("invalid file name in %q", line)
+		}
+		record.mode = os.FileMode(mode)
+		record.size = size
+		record.name = name
+	case recordEndDir:
+		if line != "E" {
+			return scpRecord{}, protocolError("malformed record %q", line)
+		}
+	case recordTimes:
+		// T<mtime> <mtime usec> <atime> <atime usec>
+		fields := strings.Split(line[1:], " ")
+		if len(fields) != 4 {
+			return scpRecord{}, protocolError("malformed record %q", line)
+		}
+		var values [4]int64
+		for i, field := range fields {
+			if !isDigits(field) {
+				return scpRecord{}, protocolError("malformed time in %q", line)
+			}
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return scpRecord{}, protocolError("malformed time in %q", line)
+			}
+			values[i] = value
+		}
+		if values[1] > 999999 || values[3] > 999999 {
+			return scpRecord{}, protocolError("malformed time in %q", line)
+		}
+		record.mtime = time.Unix(values[0], values[1]*1000)
+		record.atime = time.Unix(values[2], values[3]*1000)
+	default:
+		return scpRecord{}, protocolError("unknown record %q", line)
+	}
+	return record, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// protocolReader reads the stream sent by a remote scp process. It buffers
+// the stream, so file contents must be read through it as well.
+type protocolReader struct {
+	r       *bufio.Reader
+	tracer  *protocolTracer
+	lenient bool
+}
+
+func newProtocolReader(r io.Reader) *protocolReader {
+	return &protocolReader{r: bufio.NewReader(r)}
+}
+
+// Read reads raw file contents.
+func (p *protocolReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.tracer.trace(true, b[:n], true)
+	return n, err
+}
+
+// readLine reads up to and without the next newline.
+func (p *protocolReader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := p.r.ReadLine()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxRecordLength {
+			return "", protocolError("record longer than %d bytes", maxRecordLength)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// readRecord reads the next control record. Warnings and errors sent by the
+// remote in place of a record are returned as errors.
+func (p *protocolReader) readRecord() (scpRecord, error) {
+	first, err := p.r.Peek(1)
+	if err != nil {
+		return scpRecord{}, err
+	}
+	if first[0] == statusWarning || first[0] == statusFatal {
+		return scpRecord{}, p.readAck()
+	}
+	line, err := p.readLine()
+	if err != nil {
+		return scpRecord{}, err
+	}
+	p.tracer.trace(true, []byte(line+"\n"), false)
+	return parseRecordMode(line, p.lenient)
+}
+
+// readAck reads a status byte, returning the message that follows a warning
+// or error status as an error.
+func (p *protocolReader) readAck() error {
+	status, err := p.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch status {
+	case statusOK:
+		p.tracer.trace(true, []byte{status}, false)
+		return nil
+	case statusWarning, statusFatal:
+		// Whatever ends the message, a newline, a carriage return and newline
+		// or the end of the stream, it is the whole message
+		message, err := p.readLine()
+		p.tracer.trace(true, append([]byte{status}, message+"\n"...), false)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		return newRemoteSCPError(status, []byte(message))
+	}
+	p.tracer.trace(true, []byte{status}, false)
+	return protocolError("unexpected status byte %#x", status)
+}
@@ -0,0 +1,191 @@
+package goScp
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		line string
+		want scpRecord
+	}{
+		{"C0644 1234 report.pdf", scpRecord{kind: recordFile, mode: 0644, size: 1234, name: "report.pdf"}},
+		{"C0600 0 empty", scpRecord{kind: recordFile, mode: 0600, size: 0, name: "empty"}},
+		{"C0644 12 my report.pdf", scpRecord{kind: recordFile, mode: 0644, size: 12, name: "my report.pdf"}},
+		{"C0644 12  leading space", scpRecord{kind: recordFile, mode: 0644, size: 12, name: " leading space"}},
+		{"C0644 12 trailing space ", scpRecord{kind: recordFile, mode: 0644, size: 12, name: "trailing space "}},
+		{"C0644 7 résumé 日本.txt", scpRecord{kind: recordFile, mode: 0644, size: 7, name: "résumé 日本.txt"}},
+		{"C4755 9223372036854775807 big", scpRecord{kind: recordFile, mode: 04755, size: 9223372036854775807, name: "big"}},
+		{"D0755 0 dir", scpRecord{kind: recordDir, mode: 0755, size: 0, name: "dir"}},
+		{"D0700 0 dir with spaces", scpRecord{kind: recordDir, mode: 0700, size: 0, name: "dir with spaces"}},
+		{"E", scpRecord{kind: recordEndDir}},
+		{"T1700000000 0 1700000001 0", scpRecord{kind: recordTimes, mtime: time.Unix(1700000000, 0), atime: time.Unix(1700000001, 0)}},
+		{"T1700000000 999999 0 1", scpRecord{kind: recordTimes, mtime: time.Unix(1700000000, 999999000), atime: time.Unix(0, 1000)}},
+	}
+	for _, test := range tests {
+		record, err := parseRecord(test.line)
+		if err != nil {
+			t.Errorf("parseRecord(%q): %v", test.line, err)
+			continue
+		}
+		if record.kind != test.want.kind || record.mode != test.want.mode || record.size != test.want.size || record.name != test.want.name ||
+			!record.mtime.Equal(test.want.mtime) || !record.atime.Equal(test.want.atime) {
+			t.Errorf("parseRecord(%q) = %+v, want %+v", test.line, record, test.want)
+		}
+	}
+}
+
+func TestParseRecordRejects(t *testing.T) {
+	tests := []struct {
+		line   string
+		reason string
+	}{
+		{"", "empty"},
+		{"X0644 1 name", "unknown"},
+		{"C0644 1", "malformed record"},
+		{"C0644", "malformed record"},
+		{"C", "malformed record"},
+		{"C644 1 name", "malformed mode"},
+		{"C00644 1 name", "malformed mode"},
+		{"C0648 1 name", "malformed mode"},
+		{"C06a4 1 name", "malformed mode"},
+		{"C+644 1 name", "malformed mode"},
+		{"C 0644 1 name", "malformed mode"},
+		{"C0644 -1 name", "malformed size"},
+		{"C0644 +1 name", "malformed size"},
+		{"C0644 1x name", "malformed size"},
+		{"C0644  name", "malformed size"},
+		{"C0644 99999999999999999999 name", "malformed size"},
+		{"C0644 1 ", "invalid file name"},
+		{"C0644 1 .", "invalid file name"},
+		{"C0644 1 ..", "invalid file name"},
+		{"C0644 1 ../etc/passwd", "invalid file name"},
+		{"C0644 1 dir/name", "invalid file name"},
+		{"C0644 1 nul\x00byte", "invalid file name"},
+		{"D0755 0 ..", "invalid file name"},
+		{"D0755 0 a/b", "invalid file name"},
+		{"E ", "malformed record"},
+		{"Extra", "malformed record"},
+		{"T1 0 1", "malformed record"},
+		{"T1 0 1 0 0", "malformed record"},
+		{"T1 0 x 0", "malformed time"},
+		{"T-1 0 1 0", "malformed time"},
+		{"T1 1000000 1 0", "malformed time"},
+		{"T1 0 1 1000000", "malformed time"},
+		{"T99999999999999999999 0 1 0", "malformed time"},
+	}
+	for _, test := range tests {
+		_, err := parseRecord(test.line)
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("parseRecord(%q): got %v, want ErrProtocol", test.line, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("parseRecord(%q): got %v, want %s", test.line, err, test.reason)
+		}
+	}
+}
+
+func TestParseRecordLenientModes(t *testing.T) {
+	tests := []struct {
+		line string
+		mode os.FileMode
+	}{
+		{"C644 3 busybox", 0644},
+		{"C0644 3 busybox", 0644},
+		{"C7 3 busybox", 07},
+		{"C55 3 busybox", 055},
+		{"D755 0 dir", 0755},
+	}
+	for _, test := range tests {
+		record, err := parseRecordMode(test.line, true)
+		if err != nil {
+			t.Errorf("lenient parseRecordMode(%q): %v", test.line, err)
+			continue
+		}
+		if record.mode != test.mode {
+			t.Errorf("lenient parseRecordMode(%q) mode = %04o, want %04o", test.line, record.mode, test.mode)
+		}
+	}
+
+	// Lenient mode only relaxes the length of the mode
+	for _, line := range []string{"C 3 name", "C00644 3 name", "C648 3 name", "C644 -3 name", "C644 3 a/b"} {
+		if _, err := parseRecordMode(line, true); !errors.Is(err, ErrProtocol) {
+			t.Errorf("lenient parseRecordMode(%q): got %v, want ErrProtocol", line, err)
+		}
+	}
+}
+
+func TestReadRecordRemoteMessages(t *testing.T) {
+	protocol := newProtocolReader(strings.NewReader("\x01scp: warning: odd\n\x02scp: fatal: gone\r\n"))
+	_, err := protocol.readRecord()
+	var remote *RemoteSCPError
+	if !errors.As(err, &remote) || remote.Fatal || remote.Message != "warning: odd" {
+		t.Errorf("first readRecord: got %#v, want a warning", err)
+	}
+	_, err = protocol.readRecord()
+	if !errors.As(err, &remote) || !remote.Fatal || remote.Message != "fatal: gone" {
+		t.Errorf("second readRecord: got %#v, want a fatal error", err)
+	}
+}
+
+func TestReadRecordTooLong(t *testing.T) {
+	protocol := newProtocolReader(strings.NewReader("C0644 1 " + strings.Repeat("a", maxRecordLength) + "\n"))
+	if _, err := protocol.readRecord(); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, want ErrProtocol", err)
+	}
+}
+
+func FuzzParseRecordMode(f *testing.F) {
+	for _, seed := range []string{
+		"C0644 1234 report.pdf",
+		"C644 12 my report.pdf",
+		"D0755 0 dir",
+		"E",
+		"T1700000000 0 1700000001 0",
+		"C0644 1 ../x",
+		"T1 1000000 1 0",
+	} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+	f.Fuzz(func(t *testing.T, line string, lenient bool) {
+		record, err := parseRecordMode(line, lenient)
+		if err != nil {
+			if !errors.Is(err, ErrProtocol) {
+				t.Fatalf("parseRecordMode(%q): error %v does not wrap ErrProtocol", line, err)
+			}
+			return
+		}
+		// Whatever is accepted is safe to use as a local name
+		switch record.kind {
+		case recordFile, recordDir:
+			if record.name == "" || record.name == "." || record.name == ".." || strings.ContainsAny(record.name, "/\x00") {
+				t.Fatalf("parseRecordMode(%q) accepted the name %q", line, record.name)
+			}
+			if record.size < 0 {
+				t.Fatalf("parseRecordMode(%q) accepted the size %d", line, record.size)
+			}
+			if record.mode > 07777 {
+				t.Fatalf("parseRecordMode(%q) accepted the mode %o", line, record.mode)
+			}
+		case recordEndDir:
+			if line != "E" {
+				t.Fatalf("parseRecordMode(%q) accepted an E record with arguments", line)
+			}
+		case recordTimes:
+		default:
+			t.Fatalf("parseRecordMode(%q) accepted the kind %q", line, record.kind)
+		}
+		// A strictly valid record is valid leniently as well
+		if !lenient {
+			if _, err := parseRecordMode(line, true); err != nil {
+				t.Fatalf("parseRecordMode(%q) is strictly but not leniently valid: %v", line, err)
+			}
+		}
+	})
+}
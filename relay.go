@@ -0,0 +1,87 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+	"path"
+	"strings"
+)
+
+// CopyRemoteToRemote copies sourcePath on source to targetDir on target,
+// streaming it through the local host like scp -3 does, so the two hosts do
+// not need to reach each other. The copy is named targetName, or keeps its
+// name when targetName is empty. Progress, bandwidth limits, events, file
+// modes and contexts of opts apply to the relayed stream; transformers do not,
+// the contents are copied as they are.
+func CopyRemoteToRemote(source *ssh.Client, sourcePath string, target *ssh.Client, targetDir string, targetName string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Relay, sourcePath, path.Join(targetDir, targetName), 0)
+	defer func() { options.finish(err) }()
+
+	session, err := openSession(source)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd := options.scpCommand("-f", sourcePath)
+	options.tracer.session(cmd)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	err = relayFile(options.traceWriter(writer, false), options.protocolReader(reader), target, targetDir, targetName, options)
+	writer.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if err := session.Wait(); err != nil {
+		return err
+	}
+	if options.securityContext {
+		if targetName == "" {
+			targetName = path.Base(sourcePath)
+		}
+		context, err := captureRemoteSecurityContext(source, sourcePath)
+		if err != nil {
+			return err
+		}
+		return restoreRemoteSecurityContext(target, path.Join(targetDir, targetName), context)
+	}
+	return nil
+}
+
+// relayFile receives a single file from the scp -f on the other end of writer
+// and protocol and sends it on to target.
+func relayFile(writer io.Writer, protocol *protocolReader, target *ssh.Client, targetDir string, targetName string, options *transferOptions) error {
+	record, err := readFileRecord(writer, protocol)
+	if err != nil {
+		return err
+	}
+	writer.Write([]byte{0})
+
+	if targetName == "" {
+		targetName = record.name
+	}
+	if options.events != nil {
+		options.events.event.RemotePath = path.Join(targetDir, targetName)
+	}
+	// Only the announced bytes belong to the file, the status byte follows
+	content := io.LimitReader(protocol, record.size)
+	if err := copyContentToRemote(target, content, record.size, targetName, options.fileMode(record.mode), strings.TrimSuffix(targetDir, "/")+"/", options); err != nil {
+		return err
+	}
+	return finishSingleFile(writer, protocol)
+}
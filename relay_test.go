@@ -0,0 +1,26 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyRemoteToRemote(t *testing.T) {
+	_, source, sourceRoot := startServer(t)
+	_, target, targetRoot := startServer(t)
+	if err := ioutil.WriteFile(filepath.Join(sourceRoot, "dump.sql"), []byte("dump"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := goScp.CopyRemoteToRemote(source, "dump.sql", target, ".", "copy.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(targetRoot, "copy.sql")); err != nil || string(contents) != "dump" {
+		t.Errorf("relayed file is %q, %v", contents, err)
+	}
+	if err := goScp.CopyRemoteToRemote(source, "missing", target, ".", ""); err == nil {
+		t.Error("relaying a missing file succeeded")
+	}
+}
@@ -0,0 +1,81 @@
+package goScp
+
+import (
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"os"
+)
+
+// RemoteFile is a remote file opened for reading with OpenRemoteFile. Unlike
+// a download, it reads only the parts asked for, so e.g. archive/zip can list
+// a remote archive by its central directory:
+//
+//	file, err := OpenRemoteFile(client, "/srv/releases/app.zip")
+//	if err != nil {
+//		return err
+//	}
+//	defer file.Close()
+//	archive, err := zip.NewReader(file, file.Size())
+//
+// It implements io.ReaderAt, which is safe for concurrent use, as well as
+// io.Reader and io.Seeker, which share a single offset.
+type RemoteFile struct {
+	sftp *sftp.Client
+	file *sftp.File
+	info os.FileInfo
+}
+
+// OpenRemoteFile opens remotePath for reading over the SFTP subsystem of the
+// remote host.
+func OpenRemoteFile(client *ssh.Client, remotePath string) (*RemoteFile, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, err
+	}
+	file, err := sftpClient.Open(remotePath)
+	if err != nil {
+		sftpClient.Close()
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		sftpClient.Close()
+		return nil, err
+	}
+	return &RemoteFile{sftp: sftpClient, file: file, info: info}, nil
+}
+
+// ReadAt reads len(b) bytes of the file starting at off.
+func (f *RemoteFile) ReadAt(b []byte, off int64) (int, error) {
+	return f.file.ReadAt(b, off)
+}
+
+// Read reads from the current offset.
+func (f *RemoteFile) Read(b []byte) (int, error) {
+	return f.file.Read(b)
+}
+
+// Seek sets the offset for the next Read, like os.File.Seek.
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+// Size returns the size of the file when it was opened.
+func (f *RemoteFile) Size() int64 {
+	return f.info.Size()
+}
+
+// Stat returns the file info from when the file was opened.
+func (f *RemoteFile) Stat() os.FileInfo {
+	return f.info
+}
+
+// Close closes the file and its SFTP session.
+func (f *RemoteFile) Close() error {
+	err := f.file.Close()
+	if closeErr := f.sftp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package goScp
+
+import (
+	"context"
+	"encoding/json"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SeenStore remembers which remote files a PollRemoteDir has downloaded
+// already, so restarts do not fetch them again.
+type SeenStore interface {
+	Seen(name string) (bool, error)
+	MarkSeen(name string) error
+}
+
+// NewMemorySeenStore returns a SeenStore that forgets everything on restart.
+func NewMemorySeenStore() SeenStore {
+	return &memorySeenStore{seen: map[string]bool{}}
+}
+
+type memorySeenStore struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (s *memorySeenStore) Seen(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[name], nil
+}
+
+func (s *memorySeenStore) MarkSeen(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[name] = true
+	return nil
+}
+
+// NewFileSeenStore returns a SeenStore kept as a JSON list of names in
+// filename, which is created when it does not exist yet.
+func NewFileSeenStore(filename string) (SeenStore, error) {
+	store := &fileSeenStore{filename: filename, memorySeenStore: memorySeenStore{seen: map[string]bool{}}}
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(contents, &names); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		store.seen[name] = true
+	}
+	return store, nil
+}
+
+type fileSeenStore struct {
+	memorySeenStore
+	filename string
+}
+
+func (s *fileSeenStore) MarkSeen(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[name] = true
+
+	names := make([]string, 0, len(s.seen))
+	for seen := range s.seen {
+		names = append(names, seen)
+	}
+	sort.Strings(names)
+	contents, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	// Replace the file in one step so a crash cannot leave half of it
+	tmp := s.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
+
+// PollOptions configures PollRemoteDir.
+type PollOptions struct {
+	// Interval is the time between two listings. Zero or less means 30s.
+	Interval time.Duration
+	// Pattern selects the files to download with path.Match, e.g. "*.csv".
+	// Empty means every file.
+	Pattern string
+	// Store remembers the downloaded files, nil means NewMemorySeenStore.
+	Store SeenStore
+	// TransferOptions are applied to every download.
+	TransferOptions []TransferOption
+	// OnDownload is called for every file downloaded or failed to download.
+	// Failed files are tried again on the next poll.
+	OnDownload func(name string, err error)
+}
+
+// PollRemoteDir lists remoteDir every interval and downloads the new files
+// matching the pattern to localDir, until ctx is done, for ingesting drop
+// folder style feeds. A file is only downloaded once it has kept its size and
+// modification time for a whole interval, so files still being written are
+// not picked up half way. localDir is created if missing.
+func PollRemoteDir(ctx context.Context, client *ssh.Client, remoteDir string, localDir string, opts PollOptions) error {
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return err
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	store := opts.Store
+	if store == nil {
+		store = NewMemorySeenStore()
+	}
+
+	lister := shellStat{client: client}
+	previous := map[string]RemoteFileInfo{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		infos, err := lister.List(remoteDir)
+		if err != nil {
+			return err
+		}
+
+		current := map[string]RemoteFileInfo{}
+		for _, info := range infos {
+			if !info.Mode.IsRegular() {
+				continue
+			}
+			if opts.Pattern != "" {
+				matched, err := path.Match(opts.Pattern, info.Name)
+				if err != nil {
+					return err
+				}
+				if !matched {
+					continue
+				}
+			}
+			current[info.Name] = info
+
+			if last, ok := previous[info.Name]; !ok || last.Size != info.Size || !last.ModTime.Equal(info.ModTime) {
+				continue
+			}
+			seen, err := store.Seen(info.Name)
+			if err != nil {
+				return err
+			}
+			if seen {
+				continue
+			}
+			err = CopyRemoteFileToLocal(client, remoteDir, info.Name, localDir, "", opts.TransferOptions...)
+			if err == nil {
+				err = store.MarkSeen(info.Name)
+			} else {
+				os.Remove(filepath.Join(localDir, info.Name))
+			}
+			if opts.OnDownload != nil {
+				opts.OnDownload(info.Name, err)
+			}
+		}
+		previous = current
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
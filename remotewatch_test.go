@@ -0,0 +1,67 @@
+package goScp_test
+
+import (
+	"context"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPollRemoteDirCreatesLocalDir(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := os.MkdirAll(filepath.Join(root, "drop"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "drop", "feed.csv"), []byte("a,b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localDir := filepath.Join(t.TempDir(), "incoming", "feeds")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var downloadErr error
+	err := goScp.PollRemoteDir(ctx, client, "drop", localDir, goScp.PollOptions{
+		Interval: 20 * time.Millisecond,
+		OnDownload: func(name string, err error) {
+			downloadErr = err
+			cancel()
+		},
+	})
+	if err != context.Canceled {
+		t.Fatalf("PollRemoteDir = %v, want it canceled after the download", err)
+	}
+	if downloadErr != nil {
+		t.Fatal(downloadErr)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(localDir, "feed.csv")); err != nil || string(contents) != "a,b\n" {
+		t.Errorf("downloaded %q, %v", contents, err)
+	}
+}
+
+func TestPollRemoteDirUnusableLocalDir(t *testing.T) {
+	_, client, _ := startServer(t)
+	localDir := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(localDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := goScp.PollRemoteDir(context.Background(), client, ".", localDir, goScp.PollOptions{})
+	if err == nil {
+		t.Fatal("PollRemoteDir into a file succeeded")
+	}
+}
+
+func TestDownloadIntoMissingDirFails(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := ioutil.WriteFile(filepath.Join(root, "report.txt"), []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := goScp.CopyRemoteFileToLocal(client, ".", "report.txt", filepath.Join(t.TempDir(), "missing"), "")
+	if !os.IsNotExist(err) {
+		t.Errorf("download into a missing directory = %v, want a not exist error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package goScp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the addresses of host names. *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WithResolver makes Connect look up the remote host with resolver instead of
+// net.DefaultResolver. It does not apply with WithDialer.
+func WithResolver(resolver Resolver) ConnectOption {
+	return func(o *connectOptions) {
+		o.resolver = resolver
+	}
+}
+
+// withDNSCache makes Connect look up the remote host through cache.
+func withDNSCache(cache *dnsCache) ConnectOption {
+	return func(o *connectOptions) {
+		o.dnsCache = cache
+	}
+}
+
+// NewCachingResolver returns a Resolver that keeps the addresses resolver
+// returned for a host for ttl, and asks it only once when the same host is
+// looked up concurrently. Failed lookups are not kept. A nil resolver means
+// net.DefaultResolver.
+func NewCachingResolver(resolver Resolver, ttl time.Duration) Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return cachingResolver{resolver: resolver, cache: newDNSCache(ttl)}
+}
+
+type cachingResolver struct {
+	resolver Resolver
+	cache    *dnsCache
+}
+
+func (r cachingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.cache.lookup(ctx, r.resolver, host)
+}
+
+// dnsCache keeps the addresses of hosts for ttl.
+type dnsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry is a lookup, which is done once ready is closed.
+type dnsEntry struct {
+	ready   chan struct{}
+	ips     []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, entries: map[string]*dnsEntry{}}
+}
+
+// lookup returns the cached addresses of host, looking them up with resolver
+// when they are not cached or expired.
+func (c *dnsCache) lookup(ctx context.Context, resolver Resolver, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	if ok {
+		select {
+		case <-entry.ready:
+			if entry.err != nil || time.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+			// Looked up right now, wait for it below
+		}
+	}
+	if !ok {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		c.entries[host] = entry
+		c.mu.Unlock()
+
+		entry.ips, entry.err = resolver.LookupIPAddr(ctx, host)
+		entry.expires = time.Now().Add(c.ttl)
+		close(entry.ready)
+		if entry.err != nil {
+			c.mu.Lock()
+			if c.entries[host] == entry {
+				delete(c.entries, host)
+			}
+			c.mu.Unlock()
+		}
+		return entry.ips, entry.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.ips, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lookupHost returns the addresses of host, which may be an IP address, with
+// the resolver and cache of the options.
+func (o *connectOptions) lookupHost(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	resolver := o.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if o.dnsCache != nil {
+		return o.dnsCache.lookup(ctx, resolver, host)
+	}
+	return resolver.LookupIPAddr(ctx, host)
+}
@@ -0,0 +1,302 @@
+package goScp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3MinPartSize is the smallest part S3 accepts, except for the last one.
+	s3MinPartSize = 5 << 20
+	// s3MaxParts is the most parts a multipart upload may have.
+	s3MaxParts = 10000
+)
+
+// S3Sink is a Sink storing files as objects of an S3 bucket, or of a service
+// speaking the S3 API such as MinIO or Ceph. Files are uploaded in parts
+// while they are downloaded, so only a part is held in memory at a time;
+// files smaller than a part are stored with a single request. Requests are
+// signed with AWS Signature Version 4.
+type S3Sink struct {
+	// Endpoint is the URL of the service, https://s3.<Region>.amazonaws.com
+	// when empty. Buckets are addressed in the path, not the host name.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is put in front of the file names to form the object keys,
+	// e.g. "backups/2026-10-15/".
+	Prefix string
+	// AccessKeyID and SecretAccessKey are the credentials, SessionToken is
+	// only needed for temporary ones.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PartSize is the size of the parts of multipart uploads. Zero means 8MB,
+	// smaller sizes than the 5MB minimum of S3 are raised to it. It grows for
+	// files too large for 10000 parts of it.
+	PartSize int64
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// Create starts uploading the object Prefix plus name.
+func (s *S3Sink) Create(name string, size int64) (SinkWriter, error) {
+	partSize := s.PartSize
+	if partSize == 0 {
+		partSize = 8 << 20
+	}
+	if partSize < s3MinPartSize {
+		partSize = s3MinPartSize
+	}
+	if size > partSize*s3MaxParts {
+		partSize = (size + s3MaxParts - 1) / s3MaxParts
+	}
+	return &s3Upload{sink: s, key: s.Prefix + name, partSize: int(partSize)}, nil
+}
+
+// s3Upload is a SinkWriter uploading an object of an S3Sink. It starts a
+// multipart upload once more than a part was written.
+type s3Upload struct {
+	sink     *S3Sink
+	key      string
+	partSize int
+	buffer   []byte
+	uploadID string
+	etags    []string
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := u.partSize - len(u.buffer)
+		if n > len(p) {
+			n = len(p)
+		}
+		u.buffer = append(u.buffer, p[:n]...)
+		p = p[n:]
+		// A full part is only sent once more follows, so the last one is
+		// never empty
+		if len(u.buffer) == u.partSize && len(p) > 0 {
+			if err := u.flushPart(); err != nil {
+				return written - len(p), err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushPart uploads the buffer as the next part, starting the multipart
+// upload first.
+func (u *s3Upload) flushPart() error {
+	if u.uploadID == "" {
+		body, err := u.sink.do(http.MethodPost, u.key, url.Values{"uploads": {""}}, nil)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return err
+		}
+		u.uploadID = result.UploadID
+	}
+
+	query := url.Values{"partNumber": {strconv.Itoa(len(u.etags) + 1)}, "uploadId": {u.uploadID}}
+	response, err := u.sink.request(http.MethodPut, u.key, query, u.buffer)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	u.etags = append(u.etags, response.Header.Get("ETag"))
+	u.buffer = u.buffer[:0]
+	return nil
+}
+
+func (u *s3Upload) Close() error {
+	if u.uploadID == "" {
+		_, err := u.sink.do(http.MethodPut, u.key, nil, u.buffer)
+		return err
+	}
+	if len(u.buffer) > 0 {
+		if err := u.flushPart(); err != nil {
+			u.Abort()
+			return err
+		}
+	}
+
+	var complete bytes.Buffer
+	complete.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range u.etags {
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>", i+1)
+		xml.EscapeText(&complete, []byte(etag))
+		complete.WriteString("</ETag></Part>")
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+	body, err := u.sink.do(http.MethodPost, u.key, url.Values{"uploadId": {u.uploadID}}, complete.Bytes())
+	// Completing can fail after the status was sent already
+	if err == nil && bytes.Contains(body, []byte("<Error>")) {
+		err = fmt.Errorf("goScp: completing the upload of %s failed: %s", u.key, body)
+	}
+	if err != nil {
+		u.Abort()
+	}
+	return err
+}
+
+func (u *s3Upload) Abort() error {
+	u.buffer = nil
+	if u.uploadID == "" {
+		return nil
+	}
+	_, err := u.sink.do(http.MethodDelete, u.key, url.Values{"uploadId": {u.uploadID}}, nil)
+	return err
+}
+
+// do sends a request for the object key and returns the response body.
+func (s *S3Sink) do(method string, key string, query url.Values, body []byte) ([]byte, error) {
+	response, err := s.request(method, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
+
+// request sends a signed request for the object key and fails unless the
+// response has a success status.
+func (s *S3Sink) request(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	objectPath := "/" + awsURIEncode(s.Bucket, true) + "/" + awsURIEncode(key, false)
+	target := base.String() + objectPath
+	if len(query) > 0 {
+		target += "?" + awsCanonicalQuery(query)
+	}
+	request, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	s.sign(request, base.EscapedPath()+objectPath, body, time.Now())
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		return nil, fmt.Errorf("goScp: S3 %s %s: %s: %s", method, key, response.Status, message)
+	}
+	return response, nil
+}
+
+// sign adds the AWS Signature Version 4 of request, which carries body, to
+// its headers. canonicalPath is the encoded path of its URL. Every header set
+// so far is signed.
+func (s *S3Sink) sign(request *http.Request, canonicalPath string, body []byte, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalPath,
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalQuery encodes query sorted by name, as AWS signatures expect.
+func awsCanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything but the unreserved characters of
+// RFC 3986, and slashes unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package goScp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule tells when a ScheduledJob runs next.
+type Schedule interface {
+	// Next returns the first run time after after.
+	Next(after time.Time) time.Time
+}
+
+// Every returns a Schedule running every interval.
+func Every(interval time.Duration) Schedule {
+	return everySchedule(interval)
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cronSchedule is a parsed cron expression, every field a set of the values
+// it matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday are set for a * day of month or day of week, as
+	// cron only requires one of the two to match when both are restricted
+	anyDay, anyWeekday bool
+}
+
+// ParseCron parses a standard five field cron expression: minute, hour, day
+// of month, month and day of week, e.g. "30 2 * * 1-5". Fields take *, single
+// values, ranges, lists and steps such as */15. Times are matched in the
+// location of the time passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("goScp: cron expression %q does not have 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]map[int]bool
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("goScp: cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// Both 0 and 7 are Sunday
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			n, err := strconv.Atoi(part[slash+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:slash]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = n, n
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every combination of fields recurs within a few years, give up on the
+	// ones that never match such as February 30
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduledJob is a Job run repeatedly by RunScheduled. Every run is delayed
+// by a random duration of up to Jitter, so many hosts on the same schedule do
+// not all start at once.
+type ScheduledJob struct {
+	Job      Job
+	Schedule Schedule
+	Jitter   time.Duration
+}
+
+// ScheduleOptions configures RunScheduled.
+type ScheduleOptions struct {
+	// Logger logs every run, nil means the standard logger.
+	Logger *log.Logger
+	// OnFailure is called with the result of every failed run.
+	OnFailure func(JobResult)
+}
+
+// RunScheduled runs every job on its schedule until ctx is done, and then
+// returns the error of ctx once all running jobs have finished. A job never
+// runs twice at once; a run taking longer than the schedule allows delays the
+// next one. The DependsOn of the jobs is ignored.
+func RunScheduled(ctx context.Context, jobs []ScheduledJob, opts ScheduleOptions) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job ScheduledJob) {
+			defer wg.Done()
+			runScheduledJob(ctx, job, logger, opts.OnFailure)
+		}(job)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func runScheduledJob(ctx context.Context, job ScheduledJob, logger *log.Logger, onFailure func(JobResult)) {
+	for {
+		next := job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			logger.Printf("Scheduled job %s will never run again", job.Job.Name)
+			return
+		}
+		if job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		logger.Printf("Running scheduled job %s", job.Job.Name)
+		start := time.Now()
+		if err := job.Job.Run(); err != nil {
+			logger.Printf("Scheduled job %s failed after %s: %v", job.Job.Name, time.Since(start), err)
+			if onFailure != nil {
+				onFailure(JobResult{Name: job.Job.Name, Err: err})
+			}
+			continue
+		}
+		logger.Printf("Scheduled job %s finished in %s", job.Job.Name, time.Since(start))
+	}
+}
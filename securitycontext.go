@@ -0,0 +1,99 @@
+package goScp
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"os/exec"
+	"strings"
+)
+
+// securityMarker separates the ACL from the SELinux context in the output of
+// securityCaptureScript.
+const securityMarker = "#goScp-selinux"
+
+// securityContext is what WithSecurityContext carries over from the source of
+// a transfer to its copy. Empty fields were not set on the source.
+type securityContext struct {
+	// acl is the extended POSIX ACL in the text form of getfacl, empty when
+	// the file only has the entries its mode bits stand for.
+	acl string
+	// selinux is the SELinux security context, e.g.
+	// system_u:object_r:httpd_sys_content_t:s0.
+	selinux string
+}
+
+// securityCaptureScript prints the security context of file for
+// parseSecurityContext. Hosts lacking the ACL tools or SELinux print nothing
+// for them.
+func securityCaptureScript(file string) string {
+	quoted := shellQuote(file)
+	return "getfacl --absolute-names --skip-base -- " + quoted + " 2>/dev/null; echo; echo '" + securityMarker + "'; stat -c %C -- " + quoted + " 2>/dev/null; true"
+}
+
+func parseSecurityContext(output string) securityContext {
+	var context securityContext
+	parts := strings.SplitN(output, "\n"+securityMarker+"\n", 2)
+	context.acl = strings.TrimSpace(parts[0])
+	if len(parts) == 2 {
+		context.selinux = strings.TrimSpace(parts[1])
+	}
+	// stat prints a question mark for files without a context
+	if context.selinux == "?" {
+		context.selinux = ""
+	}
+	return context
+}
+
+// restoreScript sets context on file, or returns "" when there is nothing to
+// set. It fails when the host cannot take what the source had.
+func (c securityContext) restoreScript(file string) string {
+	quoted := shellQuote(file)
+	var steps []string
+	if c.acl != "" {
+		steps = append(steps, "printf '%s\\n' "+shellQuote(c.acl)+" | setfacl --set-file=- -- "+quoted)
+	}
+	if c.selinux != "" {
+		steps = append(steps, "chcon -- "+shellQuote(c.selinux)+" "+quoted)
+	}
+	return strings.Join(steps, " && ")
+}
+
+func captureRemoteSecurityContext(client *ssh.Client, remotePath string) (securityContext, error) {
+	output, err := ExecuteCommand(client, securityCaptureScript(remotePath))
+	if err != nil {
+		return securityContext{}, err
+	}
+	return parseSecurityContext(output), nil
+}
+
+func restoreRemoteSecurityContext(client *ssh.Client, remotePath string, context securityContext) error {
+	script := context.restoreScript(remotePath)
+	if script == "" {
+		return nil
+	}
+	if _, err := ExecuteCommand(client, script); err != nil {
+		return fmt.Errorf("goScp: cannot restore the security context of %s: %v", remotePath, err)
+	}
+	return nil
+}
+
+// captureLocalSecurityContext is captureRemoteSecurityContext for a local
+// file. Hosts without a POSIX shell have nothing to capture.
+func captureLocalSecurityContext(localPath string) securityContext {
+	output, err := exec.Command("sh", "-c", securityCaptureScript(localPath)).Output()
+	if err != nil {
+		return securityContext{}
+	}
+	return parseSecurityContext(string(output))
+}
+
+func restoreLocalSecurityContext(localPath string, context securityContext) error {
+	script := context.restoreScript(localPath)
+	if script == "" {
+		return nil
+	}
+	if output, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("goScp: cannot restore the security context of %s: %v: %s", localPath, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
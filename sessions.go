@@ -0,0 +1,153 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"sync"
+	"time"
+)
+
+// SessionEventType tells whether a session was opened or closed.
+type SessionEventType string
+
+const (
+	SessionOpened SessionEventType = "opened"
+	SessionClosed SessionEventType = "closed"
+)
+
+// SessionEvent reports a session goScp opened or closed on a client, with the
+// number of sessions open on it afterwards.
+type SessionEvent struct {
+	Type SessionEventType
+	Open int
+	Time time.Time
+}
+
+// SessionStats counts the sessions goScp opened on a client. Every transfer
+// and command takes a session, and servers limit how many a connection may
+// have open at once (MaxSessions, 10 by default for OpenSSH), so Peak
+// reaching that limit explains "open failed" errors of parallel transfers.
+type SessionStats struct {
+	// Open is the number of sessions open right now.
+	Open int
+	// Peak is the highest number of sessions open at once.
+	Peak int
+	// Opened is the number of sessions opened so far.
+	Opened int
+}
+
+type sessionTracker struct {
+	stats       SessionStats
+	subscribers map[int]func(SessionEvent)
+	next        int
+}
+
+// sessionTrackers holds the session counts of every client goScp opened
+// sessions on. They are dropped when the client is closed through Client or
+// ClientPool, or else once its connection ends.
+var sessionTrackers = struct {
+	sync.Mutex
+	clients map[*ssh.Client]*sessionTracker
+}{clients: map[*ssh.Client]*sessionTracker{}}
+
+// GetSessionStats returns the session counts of client.
+func GetSessionStats(client *ssh.Client) SessionStats {
+	sessionTrackers.Lock()
+	defer sessionTrackers.Unlock()
+	if tracker, ok := sessionTrackers.clients[client]; ok {
+		return tracker.stats
+	}
+	return SessionStats{}
+}
+
+// SubscribeSessions calls fn for every session goScp opens or closes on
+// client, from the goroutine doing so, until the returned function is called.
+func SubscribeSessions(client *ssh.Client, fn func(SessionEvent)) (unsubscribe func()) {
+	sessionTrackers.Lock()
+	defer sessionTrackers.Unlock()
+	tracker := trackerFor(client)
+	id := tracker.next
+	tracker.next++
+	tracker.subscribers[id] = fn
+	return func() {
+		sessionTrackers.Lock()
+		defer sessionTrackers.Unlock()
+		delete(tracker.subscribers, id)
+	}
+}
+
+// trackerFor returns the tracker of client, sessionTrackers must be locked.
+func trackerFor(client *ssh.Client) *sessionTracker {
+	tracker, ok := sessionTrackers.clients[client]
+	if !ok {
+		tracker = &sessionTracker{subscribers: map[int]func(SessionEvent){}}
+		sessionTrackers.clients[client] = tracker
+		go func() {
+			client.Wait()
+			forgetSessions(client)
+		}()
+	}
+	return tracker
+}
+
+// forgetSessions drops the session counts and subscribers of client.
+func forgetSessions(client *ssh.Client) {
+	sessionTrackers.Lock()
+	defer sessionTrackers.Unlock()
+	delete(sessionTrackers.clients, client)
+}
+
+func countSession(client *ssh.Client, eventType SessionEventType) {
+	sessionTrackers.Lock()
+	tracker, ok := sessionTrackers.clients[client]
+	if !ok {
+		if eventType == SessionClosed {
+			// The client was forgotten while the session was open
+			sessionTrackers.Unlock()
+			return
+		}
+		tracker = trackerFor(client)
+	}
+	if eventType == SessionOpened {
+		tracker.stats.Open++
+		tracker.stats.Opened++
+		if tracker.stats.Open > tracker.stats.Peak {
+			tracker.stats.Peak = tracker.stats.Open
+		}
+	} else {
+		tracker.stats.Open--
+	}
+	event := SessionEvent{Type: eventType, Open: tracker.stats.Open, Time: time.Now()}
+	subscribers := make([]func(SessionEvent), 0, len(tracker.subscribers))
+	for _, fn := range tracker.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	sessionTrackers.Unlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// trackedSession is a session counted in the SessionStats of its client until
+// it is closed.
+type trackedSession struct {
+	*ssh.Session
+	client *ssh.Client
+	once   sync.Once
+}
+
+// openSession opens a new session on client, every session goScp uses is
+// opened through it.
+func openSession(client *ssh.Client) (*trackedSession, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	countSession(client, SessionOpened)
+	return &trackedSession{Session: session, client: client}, nil
+}
+
+func (s *trackedSession) Close() error {
+	s.once.Do(func() { countSession(s.client, SessionClosed) })
+	return s.Session.Close()
+}
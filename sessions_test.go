@@ -0,0 +1,105 @@
+package goScp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeClient returns a client connected over loopback to a server that
+// accepts sessions but runs nothing, and a function cutting the connection.
+func loopbackClient(t *testing.T) (*ssh.Client, func()) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- serverConn
+		_, channels, requests, err := ssh.NewServerConn(serverConn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for channel := range channels {
+			if _, requests, err := channel.Accept(); err == nil {
+				go ssh.DiscardRequests(requests)
+			}
+		}
+	}()
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	serverConn := <-accepted
+	return client, func() { serverConn.Close() }
+}
+
+func tracked(client *ssh.Client) bool {
+	sessionTrackers.Lock()
+	defer sessionTrackers.Unlock()
+	_, ok := sessionTrackers.clients[client]
+	return ok
+}
+
+func TestSessionClosedAfterForget(t *testing.T) {
+	client, _ := loopbackClient(t)
+	session, err := openSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgetClient(client)
+
+	// Closing a session left open must not bring the client back
+	session.Close()
+	if tracked(client) {
+		t.Fatal("closing a session tracked its forgotten client again")
+	}
+}
+
+func TestClientForgottenWhenConnectionEnds(t *testing.T) {
+	client, cut := loopbackClient(t)
+	session, err := openSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	connectInfos.Store(client, ClientInfo{Name: "loopback"})
+	legacyClients.Store(client, true)
+	forgetOnClose(client)
+
+	cut()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, info := connectInfos.Load(client)
+		_, legacy := legacyClients.Load(client)
+		if !info && !legacy && !tracked(client) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client still known after its connection ended: info %v, legacy %v, sessions %v", info, legacy, tracked(client))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,201 @@
+package goScp
+
+import (
+	"crypto/sha256"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+	"path"
+)
+
+// NewSFTPTransferrer returns a Transferrer using the SFTP subsystem of the
+// remote host.
+func NewSFTPTransferrer(client *ssh.Client) (Transferrer, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpTransferrer{client: client, sftp: sftpClient}, nil
+}
+
+type sftpTransferrer struct {
+	client *ssh.Client
+	sftp   *sftp.Client
+}
+
+func (t *sftpTransferrer) Name() string {
+	return "sftp"
+}
+
+func (t *sftpTransferrer) Upload(localFile string, remotePath string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Upload, localFile, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	source, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	if options.skipIdentical {
+		identical, err := identicalOnRemote(t.client, source, remotePath, path.Base(remotePath))
+		if err != nil {
+			return err
+		}
+		if identical {
+			options.skipped()
+			return nil
+		}
+	}
+	if options.spaceCheck {
+		if err := t.checkSpace(remotePath, info.Size()); err != nil {
+			return err
+		}
+	}
+
+	destination, err := t.sftp.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	var written io.Writer = destination
+	sparse := &sparseWriter{file: destination}
+	if options.sparse {
+		written = sparse
+	}
+	hash := sha256.New()
+	reader := contextReader{ctx: options.transferContext(), r: io.TeeReader(source, hash)}
+	if _, err := options.buffers.copy(options.instrument(written, info.Size()), reader); err != nil {
+		return err
+	}
+	if options.sparse {
+		if err := sparse.Close(); err != nil {
+			return err
+		}
+	}
+	if err := destination.Chmod(options.fileMode(info.Mode())); err != nil {
+		return err
+	}
+
+	if options.manifest != nil {
+		options.manifest.record(Upload, localFile, remotePath, info.Size(), hash.Sum(nil))
+	}
+	return nil
+}
+
+// checkSpace uses the statvfs extension of the server, falling back to df for
+// servers that do not support it.
+func (t *sftpTransferrer) checkSpace(remotePath string, size int64) error {
+	stat, err := t.sftp.StatVFS(path.Dir(remotePath))
+	if err != nil {
+		return checkRemoteSpace(t.client, remotePath, size)
+	}
+	return checkSpace(remotePath, size, int64(stat.Bavail*stat.Frsize))
+}
+
+func (t *sftpTransferrer) Download(remotePath string, localFile string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Download, localFile, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	servedPath := remotePath
+	if options.remoteSnapshot {
+		snapshotPath, err := createRemoteSnapshot(t.client, remotePath)
+		if err != nil {
+			return err
+		}
+		defer removeRemoteFile(t.client, snapshotPath)
+		servedPath = snapshotPath
+	}
+
+	source, err := t.sftp.Open(servedPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	if err := options.checkLocalSpace(localFile, info.Size()); err != nil {
+		return err
+	}
+
+	destination, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	// Like scp, only the size seen when the download starts is copied
+	reader := contextReader{ctx: options.transferContext(), r: source}
+	written, flush := fileWriter(destination)
+	_, err = options.buffers.copyN(options.instrument(written, info.Size()), reader, info.Size())
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := applyGrowthPolicy(t.client, servedPath, info.Size(), destination, options); err != nil {
+		return err
+	}
+	if err := destination.Sync(); err != nil {
+		return err
+	}
+
+	if options.manifest != nil {
+		sum, err := sha256File(localFile)
+		if err != nil {
+			return err
+		}
+		options.manifest.record(Download, localFile, remotePath, info.Size(), sum)
+	}
+	return nil
+}
+
+func (t *sftpTransferrer) List(remoteDir string) ([]RemoteFileInfo, error) {
+	entries, err := t.sftp.ReadDir(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]RemoteFileInfo, len(entries))
+	for i, entry := range entries {
+		infos[i] = remoteFileInfo(entry)
+	}
+	return infos, nil
+}
+
+func (t *sftpTransferrer) Stat(remotePath string) (RemoteFileInfo, error) {
+	info, err := t.sftp.Stat(remotePath)
+	if err != nil {
+		return RemoteFileInfo{}, err
+	}
+	return remoteFileInfo(info), nil
+}
+
+func (t *sftpTransferrer) Link(target string, remotePath string) error {
+	if err := t.sftp.Remove(remotePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return t.sftp.Link(target, remotePath)
+}
+
+func (t *sftpTransferrer) Close() error {
+	return t.sftp.Close()
+}
+
+func remoteFileInfo(info os.FileInfo) RemoteFileInfo {
+	return RemoteFileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
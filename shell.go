@@ -0,0 +1,12 @@
+package goScp
+
+import "strings"
+
+// shellQuote quotes s so a POSIX shell on the remote host treats it as a
+// single literal word.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
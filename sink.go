@@ -0,0 +1,94 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"io"
+)
+
+// Sink stores downloaded files somewhere other than the local disk, such as
+// object storage, see CopyRemoteFileToSink and S3Sink.
+type Sink interface {
+	// Create starts storing a file called name of size bytes, or of unknown
+	// size when size is negative.
+	Create(name string, size int64) (SinkWriter, error)
+}
+
+// SinkWriter receives the contents of a file for a Sink.
+type SinkWriter interface {
+	io.Writer
+	// Close stores the file once all of it was written.
+	Close() error
+	// Abort discards what was written, once the download failed.
+	Abort() error
+}
+
+// CopyRemoteFileToSink downloads remotePath and streams it into a file of
+// sink called name, or named like the remote file when name is empty, so a
+// remote backup goes from the host through this process to e.g. object
+// storage in one pass, without a local copy. A failed download aborts the
+// file of the sink. Progress, bandwidth limits, events, transformers and
+// contexts of opts apply; the growth policy, snapshots and manifests do not.
+func CopyRemoteFileToSink(client *ssh.Client, remotePath string, sink Sink, name string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Download, name, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	session, err := openSession(client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd := options.scpCommand("-f", remotePath)
+	options.tracer.session(cmd)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	err = receiveToSink(options.traceWriter(writer, false), options.protocolReader(reader), sink, name, options)
+	writer.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return session.Wait()
+}
+
+// receiveToSink receives a single file from the scp -f on the other end of
+// writer and protocol into a file of sink.
+func receiveToSink(writer io.Writer, protocol *protocolReader, sink Sink, name string, options *transferOptions) error {
+	var file SinkWriter
+	_, err := receiveFile(writer, protocol, options, func(record scpRecord) (io.Writer, func() error, error) {
+		if name == "" {
+			name = record.name
+		}
+		size := record.size
+		if len(options.transformers) > 0 {
+			// The announced size is the one of the encoded contents
+			size = -1
+		}
+		var err error
+		if file, err = sink.Create(name, size); err != nil {
+			return nil, nil, err
+		}
+		return file, func() error { return nil }, nil
+	})
+	if err != nil {
+		if file != nil {
+			file.Abort()
+		}
+		return err
+	}
+	return file.Close()
+}
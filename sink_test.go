@@ -0,0 +1,82 @@
+package goScp_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memorySink keeps the files of a Sink in memory.
+type memorySink struct {
+	files   map[string][]byte
+	aborted []string
+}
+
+func (s *memorySink) Create(name string, size int64) (goScp.SinkWriter, error) {
+	return &memorySinkWriter{sink: s, name: name}, nil
+}
+
+type memorySinkWriter struct {
+	bytes.Buffer
+	sink *memorySink
+	name string
+}
+
+func (w *memorySinkWriter) Close() error {
+	w.sink.files[w.name] = w.Bytes()
+	return nil
+}
+
+func (w *memorySinkWriter) Abort() error {
+	w.sink.aborted = append(w.sink.aborted, w.name)
+	return nil
+}
+
+func TestCopyRemoteFileToSink(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := ioutil.WriteFile(filepath.Join(root, "backup.tar"), []byte("backup"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{files: map[string][]byte{}}
+
+	if err := goScp.CopyRemoteFileToSink(client, "backup.tar", sink, ""); err != nil {
+		t.Fatal(err)
+	}
+	if contents := sink.files["backup.tar"]; string(contents) != "backup" {
+		t.Errorf("sink holds %q", contents)
+	}
+
+	// Contents that fail to decode abort the file of the sink
+	err := goScp.CopyRemoteFileToSink(client, "backup.tar", sink, "decrypted.tar", goScp.WithEncryption(make([]byte, 32)))
+	if !errors.Is(err, goScp.ErrDecrypt) {
+		t.Errorf("got %v, want ErrDecrypt", err)
+	}
+	if len(sink.aborted) != 1 || sink.aborted[0] != "decrypted.tar" {
+		t.Errorf("aborted %v, want decrypted.tar", sink.aborted)
+	}
+}
+
+func TestReceivesDoNotLog(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := ioutil.WriteFile(filepath.Join(root, "backup.tar"), []byte("backup"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	if err := goScp.CopyRemoteFileToSink(client, "backup.tar", &memorySink{files: map[string][]byte{}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := goScp.CopyRemoteFileToLocal(client, ".", "backup.tar", t.TempDir(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("receiving logged %q", logged.String())
+	}
+}
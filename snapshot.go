@@ -0,0 +1,29 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"path"
+	"strings"
+)
+
+// createRemoteSnapshot copies remotePath to a temporary file next to it and
+// returns the path of the copy. Copy-on-write filesystems make the copy
+// instant through cp --reflink=auto, other filesystems get a regular copy.
+func createRemoteSnapshot(client *ssh.Client, remotePath string) (string, error) {
+	template := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".goscp.XXXXXX")
+	cmd := "tmp=$(mktemp " + shellQuote(template) + ") || exit 1; " +
+		"{ cp --reflink=auto -p -- " + shellQuote(remotePath) + " \"$tmp\" 2>/dev/null || " +
+		"cp -p " + shellQuote(remotePath) + " \"$tmp\"; } || { rm -f \"$tmp\"; exit 1; }; " +
+		"echo \"$tmp\""
+	output, err := ExecuteCommand(client, cmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(output, "\n"), nil
+}
+
+// removeRemoteFile deletes remotePath, ignoring files that are already gone.
+func removeRemoteFile(client *ssh.Client, remotePath string) error {
+	_, err := ExecuteCommand(client, "rm -f -- "+shellQuote(remotePath))
+	return err
+}
@@ -0,0 +1,73 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrInsufficientSpace is matched by errors.Is for every
+// *InsufficientSpaceError.
+var ErrInsufficientSpace = errors.New("goScp: not enough space on the remote filesystem")
+
+// InsufficientSpaceError reports an upload that was not started because the
+// remote filesystem holding Path has less than Required bytes available.
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("goScp: uploading to %s needs %d bytes, only %d are available", e.Path, e.Required, e.Available)
+}
+
+// Is lets errors.Is match an *InsufficientSpaceError against
+// ErrInsufficientSpace.
+func (e *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+// checkSpace fails with an *InsufficientSpaceError when available is below
+// required.
+func checkSpace(remotePath string, required int64, available int64) error {
+	if available < required {
+		return &InsufficientSpaceError{Path: remotePath, Required: required, Available: available}
+	}
+	return nil
+}
+
+// checkRemoteSpace checks that the filesystem remotePath is uploaded to has
+// room for size bytes, using df on the remote host.
+func checkRemoteSpace(client *ssh.Client, remotePath string, size int64) error {
+	available, err := remoteAvailableSpace(client, remotePath)
+	if err != nil {
+		return err
+	}
+	return checkSpace(remotePath, size, available)
+}
+
+// remoteAvailableSpace returns the bytes available to unprivileged users on
+// the filesystem of remotePath, or of its parent while it does not exist yet.
+func remoteAvailableSpace(client *ssh.Client, remotePath string) (int64, error) {
+	cmd := "df -P -k -- " + shellQuote(remotePath) + " 2>/dev/null || df -P -k -- " + shellQuote(path.Dir(remotePath))
+	output, err := ExecuteCommand(client, cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	// The second line holds: filesystem, blocks, used, available, capacity, mount
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return 0, fmt.Errorf("goScp: unexpected remote df output %q", output)
+	}
+	kilobytes, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("goScp: unexpected remote df output %q", output)
+	}
+	return kilobytes * 1024, nil
+}
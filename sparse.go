@@ -0,0 +1,87 @@
+package goScp
+
+import (
+	"io"
+)
+
+// sparseBlockSize is the granularity holes are detected with, the block size
+// of most file systems.
+const sparseBlockSize = 4096
+
+// WithSparse skips the blocks of zeros of the file when uploading with the
+// SFTP backend, e.g. the unused space of VM images, instead of sending them.
+// The remote file gets its full size nonetheless, and file systems that
+// support sparse files leave the skipped blocks as holes. Other backends
+// ignore it.
+func WithSparse() TransferOption {
+	return func(o *transferOptions) {
+		o.sparse = true
+	}
+}
+
+// sparseFile is a remote file that can be written at any offset.
+type sparseFile interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// sparseWriter writes to a sparseFile sequentially, skipping blocks of zeros.
+// Close sets the size of the file, which has to be done explicitly when it
+// ends with skipped blocks.
+type sparseWriter struct {
+	file   sparseFile
+	offset int64
+}
+
+func (w *sparseWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		// Gather the blocks up to the next block of zeros into one write
+		end := written
+		for end < len(b) {
+			blockEnd := end + sparseBlockSize
+			if blockEnd > len(b) {
+				blockEnd = len(b)
+			}
+			if isZero(b[end:blockEnd]) {
+				break
+			}
+			end = blockEnd
+		}
+		if end > written {
+			if _, err := w.file.WriteAt(b[written:end], w.offset); err != nil {
+				return written, err
+			}
+			w.offset += int64(end - written)
+			written = end
+		}
+
+		// Skip the blocks of zeros that follow
+		for written < len(b) {
+			blockEnd := written + sparseBlockSize
+			if blockEnd > len(b) {
+				blockEnd = len(b)
+			}
+			if !isZero(b[written:blockEnd]) {
+				break
+			}
+			w.offset += int64(blockEnd - written)
+			written = blockEnd
+		}
+	}
+	return written, nil
+}
+
+// Close sets the size of the file to everything written or skipped.
+func (w *sparseWriter) Close() error {
+	return w.file.Truncate(w.offset)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,16 +2,20 @@ package goScp
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"hash"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
-	"sync"
+	"time"
 )
 
 const (
@@ -19,23 +23,39 @@ const (
 	VERSION = "0.0.2"
 )
 
-func getAgent() (agent.Agent, error) {
-	agentConn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
-	return agent.NewClient(agentConn), err
-}
+// ErrNoAgent is returned when the SSH agent is requested but SSH_AUTH_SOCK is
+// not set.
+var ErrNoAgent = errors.New("goScp: no SSH agent, SSH_AUTH_SOCK is not set")
 
-func withAgentSSHConfig(username string) (*ssh.ClientConfig, error) {
-	agent, err := getAgent()
+// getAgent connects to the local SSH agent. The returned connection must be
+// closed once the agent is no longer used.
+func getAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, ErrNoAgent
+	}
+	agentConn, err := net.Dial("unix", socket)
 	if err != nil {
-		return &ssh.ClientConfig{}, err
+		return nil, nil, fmt.Errorf("goScp: connecting to the SSH agent: %w", err)
 	}
-	config := &ssh.ClientConfig{
+	return agent.NewClient(agentConn), agentConn, nil
+}
+
+// closeWithClient closes conn once client is closed.
+func closeWithClient(client *ssh.Client, conn io.Closer) {
+	go func() {
+		client.Wait()
+		conn.Close()
+	}()
+}
+
+func withAgentSSHConfig(username string, agent agent.Agent) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
 		User: username,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeysCallback(agent.Signers),
 		},
 	}
-	return config, nil
 }
 
 func withoutAgentSSHConfig(username string, sshKeyFile SSHKeyfile) (*ssh.ClientConfig, error) {
@@ -59,8 +79,53 @@ func withoutAgentSSHConfig(username string, sshKeyFile SSHKeyfile) (*ssh.ClientC
 	return config, nil
 }
 
-// Connect creates an SSH Client connection to the remote host
-func Connect(sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool) (*ssh.Client, error) {
+// withDefaultKeysSSHConfig offers every unencrypted key out of ~/.ssh/id_ed25519,
+// id_ecdsa and id_rsa, in that order, like OpenSSH does without -i.
+func withDefaultKeysSSHConfig(username string) (*ssh.ClientConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return &ssh.ClientConfig{}, err
+	}
+
+	var signers []ssh.Signer
+	for _, filename := range defaultKeyFilenames {
+		keyFileContents, err := ioutil.ReadFile(filepath.Join(home, ".ssh", filename))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(keyFileContents)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return &ssh.ClientConfig{}, errors.New("goScp: no key file given and no usable default key found in ~/.ssh")
+	}
+
+	config := &ssh.ClientConfig{
+		User: username,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signers...),
+		},
+	}
+
+	return config, nil
+}
+
+// Connect creates an SSH Client connection to the remote host. Without the SSH
+// agent and without a key file name, the default keys in ~/.ssh are tried.
+// The host key is checked with WithKnownHosts or WithHostKeyCallback; without
+// either, connecting fails with ErrNoHostKeyCheck.
+func Connect(sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine RemoteHost, usingSSHAgent bool, opts ...ConnectOption) (*ssh.Client, error) {
+	sshCredentials.SetDefaults()
+	remoteMachine.SetDefaults()
+	if err := sshCredentials.Validate(); err != nil {
+		return nil, err
+	}
+	if err := remoteMachine.Validate(); err != nil {
+		return nil, err
+	}
 	// An SSH client is represented with a ClientConn.
 	//
 	// To authenticate with the remote server you must pass at least one
@@ -68,44 +133,112 @@ func Connect(sshKeyFile SSHKeyfile, sshCredentials SSHCredentials, remoteMachine
 	var config *ssh.ClientConfig
 	var err error
 	if usingSSHAgent {
-		config, err = withAgentSSHConfig(sshCredentials.Username)
+		localAgent, agentConn, err := getAgent()
+		if err != nil {
+			return nil, err
+		}
+		// The agent is only needed to authenticate
+		defer agentConn.Close()
+		config = withAgentSSHConfig(sshCredentials.Username, localAgent)
+	} else if sshKeyFile.Filename == "" {
+		config, err = withDefaultKeysSSHConfig(sshCredentials.Username)
 	} else {
+		sshKeyFile.SetDefaults()
+		if err := sshKeyFile.Validate(); err != nil {
+			return nil, err
+		}
 		config, err = withoutAgentSSHConfig(sshCredentials.Username, sshKeyFile)
 	}
+	if err != nil {
+		return nil, err
+	}
+	options := newConnectOptions(opts)
+	var hostKey HostKeyInfo
+	WithHostKeyInspector(func(info HostKeyInfo) error {
+		hostKey = info
+		return nil
+	})(options)
+	options.configure(config, remoteMachine)
 
-	client, err := ssh.Dial("tcp", remoteMachine.Host+":"+remoteMachine.Port, config)
+	options.dialLimiter.Wait()
+	start := time.Now()
+	addr := remoteMachine.Host + ":" + remoteMachine.Port
+	client, err := options.dial(addr, config)
+	if err != nil {
+		return nil, err
+	}
+	connectInfos.Store(client, ClientInfo{Name: remoteMachine.DisplayName(), Address: addr, BandwidthClass: remoteMachine.BandwidthClass, AuthMethod: options.auth.method, HostKey: hostKey, HandshakeDuration: time.Since(start)})
+	if options.legacyAlgorithms {
+		legacyClients.Store(client, true)
+	}
+	forgetOnClose(client)
 
-	return client, err
+	return client, nil
 }
 
-func ExecuteCommand(client *ssh.Client, cmd string) (string, error) {
+func ExecuteCommand(client *ssh.Client, cmd string, opts ...CommandOption) (string, error) {
+	options := newCommandOptions(opts)
+	if options.timeout > 0 {
+		return ExecuteCommandWithTimeout(client, cmd, options.timeout, opts...)
+	}
 	// Each ClientConn can support multiple interactive sessions,
 	// represented by a Session.
-	session, err := client.NewSession()
+	session, err := openSession(client)
 	if err != nil {
-		log.Fatal("Failed to create session: " + err.Error())
+		return "", err
 	}
 	defer session.Close()
 
+	cmd, err = prepareCommand(client, session.Session, cmd, options)
+	if err != nil {
+		return "", err
+	}
+
 	// Once a Session is created, you can execute a single command on
 	// the remote side using the Run method.
 	var b bytes.Buffer
-	session.Stdout = &b
-	if err := session.Run(cmd); err != nil {
+	flush := options.attachOutput(session.Session, &b)
+	err = session.Run(cmd)
+	flush()
+	if err != nil {
 		return "", err
 	}
 
 	return b.String(), nil
 }
 
-func CopyRemoteFileToLocal(client *ssh.Client, remoteFilePath string, remoteFilename string, localFilePath string, localFileName string) error {
+func CopyRemoteFileToLocal(client *ssh.Client, remoteFilePath string, remoteFilename string, localFilePath string, localFileName string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+
+	remotePath := remoteFilePath + "/" + remoteFilename
+	if localFileName == "" {
+		options.begin(Download, localFilePath+"/"+remoteFilename, remotePath, 0)
+	} else {
+		options.begin(Download, localFilePath+"/"+localFileName, remotePath, 0)
+	}
+	defer func() { options.finish(err) }()
+	if options.remoteSnapshot {
+		snapshotPath, err := createRemoteSnapshot(client, remotePath)
+		if err != nil {
+			return err
+		}
+		defer removeRemoteFile(client, snapshotPath)
+		remotePath = snapshotPath
+		// The snapshot announces its own temporary name
+		if localFileName == "" {
+			localFileName = remoteFilename
+		}
+	}
+
 	// Each ClientConn can support multiple interactive sessions,
 	// represented by a Session.
-	session, err := client.NewSession()
+	session, err := openSession(client)
 	if err != nil {
-		log.Fatal("Failed to create session: " + err.Error())
+		return err
 	}
 	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
 
 	writer, err := session.StdinPipe()
 	if err != nil {
@@ -117,94 +250,382 @@ func CopyRemoteFileToLocal(client *ssh.Client, remoteFilePath string, remoteFile
 		return err
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	cmd := options.scpCommand("-f", remotePath)
+	options.tracer.session(cmd)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	file, fileSize, err := receiveSingleFile(options.traceWriter(writer, false), options.protocolReader(reader), localFilePath, localFileName, options)
+	writer.Close()
+	if file != nil {
+		defer file.Close()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if err := session.Wait(); err != nil {
+		return err
+	}
 
-	go func(writer io.WriteCloser, reader io.Reader, wg *sync.WaitGroup) {
-		successfulByte := []byte{0}
+	// Appended bytes cannot be decoded on their own
+	if len(options.transformers) == 0 {
+		if err := applyGrowthPolicy(client, remotePath, fileSize, file, options); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if options.securityContext {
+		// The snapshot is a new file without the ACL of the original
+		context, err := captureRemoteSecurityContext(client, remoteFilePath+"/"+remoteFilename)
+		if err != nil {
+			return err
+		}
+		if err := restoreLocalSecurityContext(file.Name(), context); err != nil {
+			return err
+		}
+	}
 
-		// Send a null byte saying that we are ready to receive the data
-		writer.Write(successfulByte)
-		// We want to first receive the command input from remote machine
-		// e.g. C0644 113828 test.csv
-		scpCommandArray := make([]byte, 100)
-		bytesRead, err := reader.Read(scpCommandArray)
+	if options.manifest != nil {
+		sum, err := sha256File(file.Name())
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		options.manifest.record(Download, file.Name(), remoteFilePath+"/"+remoteFilename, info.Size(), sum)
+	}
+	return nil
+}
+
+// receiveSingleFile runs the receiving side of the scp protocol for a single
+// file. It returns the local file, which is also returned on errors once it
+// has been created, and the size the remote announced for it.
+func receiveSingleFile(writer io.Writer, protocol *protocolReader, localFilePath string, localFileName string, options *transferOptions) (*os.File, int64, error) {
+	var file *os.File
+	record, err := receiveFile(writer, protocol, options, func(record scpRecord) (io.Writer, func() error, error) {
+		localFile := localFilePath + "/" + localFileName
+		if localFileName == "" {
+			localFile = localFilePath + "/" + record.name
+		}
+		if err := options.checkLocalSpace(localFile, record.size); err != nil {
+			return nil, nil, err
+		}
+		created, err := createNewFile(localFile)
 		if err != nil {
-			if err == io.EOF {
-				//no problem.
-			} else {
-				log.Fatalf("Error reading standard input: %s", err.Error())
-			}
+			return nil, nil, err
 		}
+		file = created
+		// Only the announced number of bytes belong to this copy, anything
+		// appended to the remote file since is left to the growth policy.
+		written, flush := fileWriter(file)
+		return written, flush, nil
+	})
+	return file, record.size, err
+}
 
-		scpStartLine := string(scpCommandArray[:bytesRead])
-		scpStartLineArray := strings.Split(scpStartLine, " ")
+// receiveFile runs the receiving side of the scp protocol for a single file,
+// whose contents go to the writer create returns for its record. The record
+// is only confirmed once create succeeded, and the function create returns
+// along with the writer is called once the contents are written. The record
+// is returned on errors as well once it was read.
+func receiveFile(writer io.Writer, protocol *protocolReader, options *transferOptions, create func(record scpRecord) (io.Writer, func() error, error)) (scpRecord, error) {
+	record, err := readFileRecord(writer, protocol)
+	if err != nil {
+		return record, err
+	}
+	written, finish, err := create(record)
+	if err != nil {
+		return record, err
+	}
+	// Confirm to the remote host that we have received the command line
+	writer.Write([]byte{0})
 
-		filePermission := scpStartLineArray[0][1:]
-		fileSize := scpStartLineArray[1]
-		fileName := scpStartLineArray[2]
+	destination, finishDecoding, err := options.decode(written)
+	if err != nil {
+		finish()
+		return record, err
+	}
+	_, err = options.buffers.copyN(options.instrument(destination, record.size), protocol, record.size)
+	if decodeErr := finishDecoding(); err == nil {
+		err = decodeErr
+	}
+	if finishErr := finish(); err == nil {
+		err = finishErr
+	}
+	if err != nil {
+		return record, err
+	}
+	return record, finishSingleFile(writer, protocol)
+}
 
-		log.Printf("File with permissions: %s, File Size: %s, File Name: %s", filePermission, fileSize, fileName)
+// readFileRecord tells the scp -f on the other end of writer and protocol to
+// start and returns the record of the file it sends, which the caller still
+// has to confirm.
+func readFileRecord(writer io.Writer, protocol *protocolReader) (scpRecord, error) {
+	successfulByte := []byte{0}
 
-		// Confirm to the remote host that we have received the command line
+	// Send a null byte saying that we are ready to receive the data
+	writer.Write(successfulByte)
+	// We want to first receive the command input from remote machine
+	// e.g. C0644 113828 test.csv
+	record, err := protocol.readRecord()
+	if err != nil {
+		return scpRecord{}, err
+	}
+	// Some scp implementations send the times of the file unasked
+	for record.kind == recordTimes {
 		writer.Write(successfulByte)
-		// Now we want to start receiving the file itself from the remote machine
-		fileContents := make([]byte, 1)
-		var file *os.File
-		if localFileName == "" {
-			file = createNewFile(localFilePath + "/" + fileName)
-		} else {
-			file = createNewFile(localFilePath + "/" + localFileName)
-		}
-		more := true
-		for more {
-			bytesRead, err = reader.Read(fileContents)
-			if err != nil {
-				if err == io.EOF {
-					more = false
-				} else {
-					log.Fatalf("Error reading standard input: %s", err.Error())
-				}
-			}
-			writeParitalToFile(file, fileContents[:bytesRead])
-			writer.Write(successfulByte)
-		}
-		err = file.Sync()
+		if record, err = protocol.readRecord(); err != nil {
+			return scpRecord{}, err
+		}
+	}
+	if record.kind != recordFile {
+		return scpRecord{}, protocolError("expected a file record, got %q", record.kind)
+	}
+	return record, nil
+}
+
+// finishSingleFile reads the status byte following the contents of a file,
+// confirms it and checks that the remote sends no other file.
+func finishSingleFile(writer io.Writer, protocol *protocolReader) error {
+	// The contents are followed by a single status byte
+	if err := protocol.readAck(); err != nil {
+		return err
+	}
+	writer.Write([]byte{0})
+
+	// That was the only file, so the remote should hang up now
+	if _, err := protocol.readRecord(); err != io.EOF {
+		if err == nil {
+			err = protocolError("remote sent more than one file")
+		}
+		return err
+	}
+	return nil
+}
+
+func CopyLocalFileToRemote(client *ssh.Client, localFilePath string, filename string, opts ...TransferOption) error {
+	return CopyLocalFileToRemotePath(client, localFilePath, filename, ".", "", opts...)
+}
+
+// CopyLocalFileToRemotePath copies a local file into remoteFilePath on the
+// remote host, which is relative to the login directory unless absolute. The
+// remote file is called remoteFilename, or filename when that is empty, so
+// e.g. app-1.2.3.tar.gz can be uploaded as app.tar.gz.
+func CopyLocalFileToRemotePath(client *ssh.Client, localFilePath string, filename string, remoteFilePath string, remoteFilename string, opts ...TransferOption) error {
+	options := newTransferOptions(opts)
+
+	if remoteFilename == "" {
+		remoteFilename = filename
+	}
+	// The directory is the scp target and the record carries the new name,
+	// so the file is renamed whether or not it exists remotely already.
+	remoteDir := strings.TrimSuffix(remoteFilePath, "/") + "/"
+	if err := copyLocalFileToRemoteAs(client, localFilePath+"/"+filename, remoteDir, remoteFilename, opts...); err != nil {
+		return err
+	}
+	if options.remoteTTL > 0 {
+		return scheduleRemoteRemoval(client, path.Join(remoteFilePath, remoteFilename), options.remoteTTL)
+	}
+	return nil
+}
+
+// copyLocalFileToRemote sends localFile to remoteTarget, which can either be a
+// remote directory or the full remote path of the new file.
+func copyLocalFileToRemote(client *ssh.Client, localFile string, remoteTarget string, opts ...TransferOption) error {
+	return copyLocalFileToRemoteAs(client, localFile, remoteTarget, filepath.Base(localFile), opts...)
+}
+
+// copyLocalFileToRemoteAs is copyLocalFileToRemote announcing the file as
+// remoteName, which is the name it gets when remoteTarget is a directory.
+func copyLocalFileToRemoteAs(client *ssh.Client, localFile string, remoteTarget string, remoteName string, opts ...TransferOption) error {
+	options := newTransferOptions(opts)
+
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := copyOpenFileToRemote(client, file, info, localFile, remoteTarget, remoteName, options); err != nil {
+		return err
+	}
+	if options.securityContext {
+		remotePath := remoteTarget
+		if strings.HasSuffix(remoteTarget, "/") {
+			remotePath = path.Join(remoteTarget, remoteName)
+		}
+		return restoreRemoteSecurityContext(client, remotePath, captureLocalSecurityContext(localFile))
+	}
+	return nil
+}
+
+// copyOpenFileToRemote sends the open file described by info, which was opened
+// from localFile, as remoteName to remoteTarget.
+func copyOpenFileToRemote(client *ssh.Client, file io.Reader, info os.FileInfo, localFile string, remoteTarget string, remoteName string, options *transferOptions) (err error) {
+	remotePath := remoteTarget
+	if strings.HasSuffix(remoteTarget, "/") {
+		remotePath = path.Join(remoteTarget, remoteName)
+	}
+	options.begin(Upload, localFile, remotePath, info.Size())
+	defer func() { options.finish(err) }()
+
+	// Fail before the remote creates anything for a source it cannot receive
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("goScp: cannot upload %s, it is not a regular file", localFile)
+	}
+
+	if options.skipIdentical {
+		identical, err := identicalOnRemote(client, file, remoteTarget, remoteName)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		if identical {
+			options.skipped()
+			return nil
 		}
-		wg.Done()
-	}(writer, reader, &wg)
+	}
 
-	session.Run("/usr/bin/scp -f " + remoteFilePath + "/" + remoteFilename)
-	wg.Wait()
-	writer.Close()
+	if options.spaceCheck {
+		if err := checkRemoteSpace(client, remoteTarget, info.Size()); err != nil {
+			return err
+		}
+	}
+
+	var contentHash hash.Hash
+	for attempt := 1; ; attempt++ {
+		var sent []byte
+		if contentHash, sent, err = sendFileToRemote(client, file, info, remoteTarget, remoteName, options); err != nil {
+			return err
+		}
+		if options.verifyRetries < 0 {
+			break
+		}
+		err = verifyUpload(client, sent, remotePath, remoteTarget, remoteName, attempt)
+		if err == nil {
+			break
+		}
+		seeker, ok := file.(io.Seeker)
+		if attempt > options.verifyRetries || !ok {
+			return err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if options.manifest != nil {
+		options.manifest.record(Upload, localFile, remotePath, info.Size(), contentHash.Sum(nil))
+	}
 	return nil
 }
 
-func CopyLocalFileToRemote(client *ssh.Client, localFilePath string, filename string) error {
+// sendFileToRemote sends the contents of file once. It returns the SHA-256 of
+// the contents and, when the upload is verified, of what was sent.
+func sendFileToRemote(client *ssh.Client, file io.Reader, info os.FileInfo, remoteTarget string, remoteName string, options *transferOptions) (hash.Hash, []byte, error) {
+	// The file is streamed, so the hashes are computed along the way
+	var content io.Reader = file
+	hash := sha256.New()
+	if options.manifest != nil {
+		content = io.TeeReader(file, hash)
+	}
+	content, size, cleanup, err := options.encode(content, info.Size())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+	// Transformers change what ends up on the remote host, so that is what
+	// is compared
+	sentHash := sha256.New()
+	if options.verifyRetries >= 0 || options.onSent != nil {
+		content = io.TeeReader(content, sentHash)
+	}
+	if err := copyContentToRemote(client, content, size, remoteName, options.fileMode(info.Mode()), remoteTarget, options); err != nil {
+		return nil, nil, err
+	}
+	if options.onSent != nil {
+		options.onSent(size, sentHash.Sum(nil))
+	}
+	return hash, sentHash.Sum(nil), nil
+}
+
+// copyContentToRemote sends size bytes read from content as a file called
+// filename with the permissions of mode to remoteTarget.
+func copyContentToRemote(client *ssh.Client, content io.Reader, size int64, filename string, mode os.FileMode, remoteTarget string, options *transferOptions) error {
+	// The name ends the C record, so it cannot contain a newline itself
+	if strings.ContainsAny(filename, "\n\x00") {
+		return fmt.Errorf("goScp: cannot send %q, the file name contains a newline or NUL byte", filename)
+	}
+
 	// Each ClientConn can support multiple interactive sessions,
 	// represented by a Session.
-	session, err := client.NewSession()
+	session, err := openSession(client)
 	if err != nil {
-		log.Fatal("Failed to create session: " + err.Error())
+		return err
 	}
 	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
 
 	writer, err := session.StdinPipe()
 	if err != nil {
 		return err
 	}
-	defer writer.Close()
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		fileContents, _ := ioutil.ReadFile(localFilePath + "/" + filename)
-		content := string(fileContents)
-		fmt.Fprintln(writer, "C0644", len(content), filename)
-		fmt.Fprint(writer, content)
-		fmt.Fprintln(writer, "\x00") // transfer end with \x00\
-	}()
+	cmd := options.scpCommand("-t", remoteTarget)
+	options.tracer.session(cmd)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	err = sendContent(writer, options.protocolReader(reader), content, size, filename, mode, options)
+	writer.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return session.Wait()
+}
 
-	session.Run("/usr/bin/scp -t ./")
-	return nil
+// sendContent runs the sending side of the scp protocol for a single file,
+// waiting for the remote to acknowledge every step.
+func sendContent(writer io.Writer, protocol *protocolReader, content io.Reader, size int64, filename string, mode os.FileMode, options *transferOptions) error {
+	// The remote sends a null byte once it is ready to receive
+	if err := protocol.readAck(); err != nil {
+		return err
+	}
+	control := options.traceWriter(writer, false)
+	if _, err := fmt.Fprintf(control, "C%04o %d %s\n", mode.Perm(), size, filename); err != nil {
+		return err
+	}
+	if err := protocol.readAck(); err != nil {
+		return err
+	}
+	// The copy streams through a pooled fixed size buffer, whatever the file
+	// size
+	if _, err := options.buffers.copyN(options.instrument(options.traceWriter(writer, true), size), content, size); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("goScp: %s ended before the announced %d bytes were sent", filename, size)
+		}
+		return err
+	}
+	if _, err := fmt.Fprint(control, "\x00"); err != nil { // transfer end with \x00
+		return err
+	}
+	return protocol.readAck()
 }
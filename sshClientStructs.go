@@ -1,5 +1,14 @@
 package goScp
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
 // SSHCredentials are the SSH credentials that should be used to connect to the
 // remote host. This is for use with the SSH Agent.
 type SSHCredentials struct {
@@ -12,6 +21,12 @@ type SSHCredentials struct {
 type RemoteHost struct {
 	Host string
 	Port string
+	// Name is an optional nickname shown in results, events and logs instead
+	// of the address, e.g. web-03.
+	Name string
+	// BandwidthClass tags the host for the limits of a TransferManager, see
+	// TransferManagerOptions.Classes.
+	BandwidthClass BandwidthClass
 }
 
 // SSHKeyfile represents where an SSH Key should be read from. This is used when
@@ -20,3 +35,91 @@ type SSHKeyfile struct {
 	Path     string
 	Filename string
 }
+
+// defaultKeyFilenames are the private keys looked for in ~/.ssh, in the order
+// OpenSSH tries them.
+var defaultKeyFilenames = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// SetDefaults fills in the name of the current OS user when Username is empty.
+func (c *SSHCredentials) SetDefaults() {
+	if c.Username != "" {
+		return
+	}
+	if current, err := user.Current(); err == nil {
+		c.Username = current.Username
+	} else {
+		c.Username = os.Getenv("USER")
+	}
+}
+
+// Validate reports missing or invalid fields.
+func (c SSHCredentials) Validate() error {
+	if c.Username == "" {
+		return errors.New("goScp: SSHCredentials: Username is empty")
+	}
+	return nil
+}
+
+// SetDefaults fills in port 22 when Port is empty.
+func (h *RemoteHost) SetDefaults() {
+	if h.Port == "" {
+		h.Port = "22"
+	}
+}
+
+// DisplayName returns Name, or Host when the host has no name.
+func (h RemoteHost) DisplayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Host
+}
+
+// Validate reports missing or invalid fields.
+func (h RemoteHost) Validate() error {
+	if h.Host == "" {
+		return errors.New("goScp: RemoteHost: Host is empty")
+	}
+	port, err := strconv.Atoi(h.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("goScp: RemoteHost: Port %q is not a port number", h.Port)
+	}
+	return nil
+}
+
+// SetDefaults fills in the first of ~/.ssh/id_ed25519, id_ecdsa and id_rsa that
+// exists when Filename is empty. Path defaults to ~/.ssh when only Filename is
+// set.
+func (k *SSHKeyfile) SetDefaults() {
+	if k.Path != "" && k.Filename != "" {
+		return
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	if k.Filename != "" {
+		k.Path = sshDir
+		return
+	}
+	for _, filename := range defaultKeyFilenames {
+		if _, err := os.Stat(filepath.Join(sshDir, filename)); err == nil {
+			k.Path = sshDir
+			k.Filename = filename
+			return
+		}
+	}
+}
+
+// Validate reports missing fields and key files that cannot be found.
+func (k SSHKeyfile) Validate() error {
+	if k.Filename == "" {
+		return errors.New("goScp: SSHKeyfile: Filename is empty and no default key was found in ~/.ssh")
+	}
+	keyFilePath := filepath.Join(k.Path, k.Filename)
+	if _, err := os.Stat(keyFilePath); err != nil {
+		return fmt.Errorf("goScp: SSHKeyfile: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package goScp
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// Comparison decides which files count as changed, see Verify.
+	Comparison Comparison
+	// Delete removes remote files that do not exist locally, making the remote
+	// directory a mirror of the local one. It is refused for the remote login
+	// and root directories, see ErrUnsafeRemoteDir.
+	Delete bool
+	// DryRun only reports what would be uploaded and deleted.
+	DryRun bool
+	// Delta updates files that exist on both sides rsync style, sending only
+	// the blocks that changed instead of the whole file. It pays off for large
+	// files that change in small parts, such as VM images or databases. Remote
+	// hosts without GNU coreutils get whole files.
+	Delta bool
+	// HardLinks uploads files that are hard links to each other locally only
+	// once, and recreates the other links on the remote host with ln, instead
+	// of uploading the same content several times. Only files uploaded
+	// together are linked, on platforms that report hard links.
+	HardLinks bool
+	// StateFile is a local file Sync keeps the sizes and modification times
+	// of the synced files in. Later syncs of the same remote directory treat
+	// files that did not change locally since as unchanged without looking
+	// at the remote host at all, which makes frequent syncs much faster but
+	// misses changes made on the remote host by others. Changed and new local
+	// files are uploaded, and with Delete the files of the last sync that are
+	// gone locally are deleted. The file is created by the first sync, empty
+	// means no state is kept.
+	StateFile string
+	// Journal is a local file Sync records its progress in while it runs,
+	// down to how much of the file being uploaded was sent. When a sync is
+	// interrupted, the next one with the same Journal and remote directory
+	// resumes where it stopped, without comparing the trees again, and sends
+	// only the rest of the file it was uploading when that did not change
+	// locally. The file is removed once a sync is done, empty means no
+	// journal is kept.
+	Journal string
+	// DetectMoves, along with Delete, moves a remote file that is going to be
+	// deleted to where a new local file with the same size and sum goes,
+	// instead of uploading that file, so renaming or reorganizing files
+	// locally does not send them again.
+	DetectMoves bool
+	// MoveHash is the hash DetectMoves compares files with. The zero value
+	// means SHA256MoveHash.
+	MoveHash MoveHash
+	// PreSync and PostSync are remote commands run before and after the
+	// sync, see SyncHook.
+	PreSync  []SyncHook
+	PostSync []SyncHook
+	// TransferOptions are applied to every upload.
+	TransferOptions []TransferOption
+}
+
+// SyncResult lists the files Sync uploaded, deleted, moved or left alone, by
+// their slash separated path relative to the synced directories. After a dry
+// run it lists what would have been done.
+type SyncResult struct {
+	Uploaded  []string
+	Deleted   []string
+	Moved     []SyncMove
+	Unchanged []string
+	// HookErrors are the *HookError of the hooks that failed with
+	// IgnoreHookFailure.
+	HookErrors []error
+}
+
+// ErrUnsafeRemoteDir is returned when a sync that deletes remote files is
+// pointed at the remote home or root directory, where a wrong local directory
+// would remove everything.
+var ErrUnsafeRemoteDir = errors.New("goScp: refusing to delete remote files below an empty, . or / directory")
+
+// Sync uploads every file below localDir that is missing or differs below
+// remoteDir. Remote files that do not exist locally are only removed when
+// opts.Delete is set; use opts.DryRun to list those deletions first. When
+// only a post-sync hook failed, the result is returned along with its error.
+func Sync(client *ssh.Client, localDir string, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	if opts.Delete {
+		if err := checkDeleteDir(remoteDir); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun {
+		return syncTree(client, localDir, remoteDir, opts)
+	}
+	return syncWithHooks(client, opts, func() (*SyncResult, error) {
+		return syncTree(client, localDir, remoteDir, opts)
+	})
+}
+
+// syncTree is Sync without the hooks.
+func syncTree(client *ssh.Client, localDir string, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	ignore := newIgnoreMatcher(localDir)
+	journal, err := loadSyncJournal(opts.Journal, client, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var local map[string]treeFile
+	var result *SyncResult
+	var remoteSizes map[string]int64
+	if journal != nil && !opts.DryRun {
+		// Resuming, the trees were compared by the interrupted run
+		result, remoteSizes = journal.result(), journal.RemoteSizes
+		if opts.StateFile != "" {
+			if local, err = listLocalTree(localDir, ignore); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if local, err = listLocalTree(localDir, ignore); err != nil {
+			return nil, err
+		}
+		if result, remoteSizes, err = planSync(client, localDir, remoteDir, local, ignore, opts); err != nil {
+			return nil, err
+		}
+		if opts.DryRun {
+			return result, nil
+		}
+		if journal, err = newSyncJournal(opts.Journal, client, remoteDir, result, remoteSizes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := createRemoteDirs(client, remoteDir, append(moveTargets(result.Moved), result.Uploaded...)); err != nil {
+		return nil, err
+	}
+	if err := moveRemoteFiles(client, remoteDir, result.Moved); err != nil {
+		return nil, err
+	}
+	links := map[string]string{}
+	if opts.HardLinks {
+		if links, err = hardLinks(localDir, result.Uploaded); err != nil {
+			return nil, err
+		}
+	}
+	for i, name := range result.Uploaded {
+		if i < journal.completed() {
+			continue
+		}
+		if _, linked := links[name]; !linked {
+			localFile := filepath.Join(localDir, filepath.FromSlash(name))
+			remotePath := path.Join(remoteDir, name)
+			err := journal.upload(client, localFile, remotePath, opts.TransferOptions, func(transferOptions []TransferOption) error {
+				return uploadSyncFile(client, localFile, remotePath, remoteSizes[name], opts.Delta, transferOptions)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := journal.complete(i + 1); err != nil {
+			return nil, err
+		}
+	}
+	if err := linkRemoteFiles(client, remoteDir, links); err != nil {
+		return nil, err
+	}
+	if err := removeRemoteFiles(client, remoteDir, result.Deleted); err != nil {
+		return nil, err
+	}
+	if opts.StateFile != "" {
+		if err := saveSyncState(opts.StateFile, client, remoteDir, local); err != nil {
+			return nil, err
+		}
+	}
+	if err := journal.remove(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// planSync compares local, the listing of localDir, with remoteDir or the
+// state of the last sync and returns what Sync has to do, along with the sizes
+// of the remote files that are going to be replaced.
+func planSync(client *ssh.Client, localDir string, remoteDir string, local map[string]treeFile, ignore *ignoreMatcher, opts SyncOptions) (*SyncResult, map[string]int64, error) {
+	state, err := loadSyncState(opts.StateFile, client, remoteDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var comparison *CompareResult
+	if state != nil {
+		comparison = state.compare(local)
+	} else if comparison, err = compareWithRemote(client, localDir, remoteDir, local, ignore, opts.Comparison); err != nil {
+		return nil, nil, err
+	}
+
+	result := &SyncResult{Unchanged: comparison.Identical}
+	remoteSizes := map[string]int64{}
+	for _, diff := range comparison.Diffs {
+		if diff.Kind == OnlyRemote {
+			if opts.Delete {
+				result.Deleted = append(result.Deleted, diff.Path)
+			}
+			continue
+		}
+		if diff.Kind != OnlyLocal {
+			remoteSizes[diff.Path] = diff.RemoteSize
+		}
+		result.Uploaded = append(result.Uploaded, diff.Path)
+	}
+	if opts.DetectMoves {
+		if err := detectMoves(client, localDir, remoteDir, opts.MoveHash.or(SHA256MoveHash), comparison.Diffs, result); err != nil {
+			return nil, nil, err
+		}
+	}
+	return result, remoteSizes, nil
+}
+
+// uploadSyncFile uploads localFile to remotePath, which is remoteSize bytes
+// large when it exists, sending only what changed when delta asks for it.
+func uploadSyncFile(client *ssh.Client, localFile string, remotePath string, remoteSize int64, delta bool, opts []TransferOption) error {
+	if delta && remoteSize >= minDeltaBlockSize {
+		err := uploadDelta(client, localFile, remotePath, remoteSize, opts...)
+		if err != errDeltaUnavailable {
+			return err
+		}
+	}
+	return copyLocalFileToRemote(client, localFile, remotePath, opts...)
+}
+
+// checkDeleteDir refuses remoteDir as the directory a sync deletes below when
+// it is the login or root directory.
+func checkDeleteDir(remoteDir string) error {
+	if clean := path.Clean(remoteDir); clean == "." || clean == "/" {
+		return ErrUnsafeRemoteDir
+	}
+	return nil
+}
+
+// createRemoteDirs creates the parent directories of names below remoteDir.
+func createRemoteDirs(client *ssh.Client, remoteDir string, names []string) error {
+	dirs := map[string]bool{remoteDir: true}
+	for _, name := range names {
+		dirs[path.Join(remoteDir, path.Dir(name))] = true
+	}
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, shellQuote(dir))
+	}
+	sort.Strings(sorted)
+
+	_, err := ExecuteCommand(client, "mkdir -p -- "+strings.Join(sorted, " "))
+	return err
+}
+
+// removeRemoteFiles deletes names below remoteDir.
+func removeRemoteFiles(client *ssh.Client, remoteDir string, names []string) error {
+	return removeRemote(client, remoteDir, names, "rm -f --")
+}
+
+// removeRemoteTrees deletes names below remoteDir, along with everything
+// below the ones that are directories.
+func removeRemoteTrees(client *ssh.Client, remoteDir string, names []string) error {
+	return removeRemote(client, remoteDir, names, "rm -rf --")
+}
+
+// removeRemote runs rm, a rm command line, on names below remoteDir.
+func removeRemote(client *ssh.Client, remoteDir string, names []string, rm string) error {
+	const filesPerCommand = 200
+	for start := 0; start < len(names); start += filesPerCommand {
+		end := start + filesPerCommand
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var cmd strings.Builder
+		cmd.WriteString("cd " + shellQuote(remoteDir) + " && " + rm)
+		for _, name := range names[start:end] {
+			cmd.WriteString(" " + shellQuote(name))
+		}
+		if _, err := ExecuteCommand(client, cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package goScp_test
+
+import (
+	"errors"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncDeleteRefusesUnsafeRemoteDir(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := ioutil.WriteFile(filepath.Join(root, "keep"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+
+	for _, remoteDir := range []string{"", ".", "./", "/", "//", "dir/.."} {
+		_, err := goScp.Sync(client, localDir, remoteDir, goScp.SyncOptions{Delete: true})
+		if !errors.Is(err, goScp.ErrUnsafeRemoteDir) {
+			t.Errorf("Sync to %q with Delete: got %v, want ErrUnsafeRemoteDir", remoteDir, err)
+		}
+	}
+	if _, err := goScp.TwoWaySync(client, localDir, ".", goScp.TwoWaySyncOptions{StateFile: filepath.Join(t.TempDir(), "state")}); !errors.Is(err, goScp.ErrUnsafeRemoteDir) {
+		t.Errorf("TwoWaySync to .: got %v, want ErrUnsafeRemoteDir", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "keep")); err != nil {
+		t.Fatalf("a refused sync removed a remote file: %v", err)
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	_, client, root := startServer(t)
+	if err := os.MkdirAll(filepath.Join(root, "site"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "site", "stale.html"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "index.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := goScp.Sync(client, localDir, "site", goScp.SyncOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "site", "stale.html")); !os.IsNotExist(err) {
+		t.Errorf("stale.html was not deleted: %v", err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(root, "site", "index.html")); err != nil || string(contents) != "index" {
+		t.Errorf("index.html arrived as %q, %v", contents, err)
+	}
+}
@@ -0,0 +1,119 @@
+package goScp
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrHookFailed is matched by errors.Is for every *HookError.
+var ErrHookFailed = errors.New("goScp: sync hook failed")
+
+// HookStage tells when a SyncHook runs.
+type HookStage string
+
+const (
+	PreSync  HookStage = "pre-sync"
+	PostSync HookStage = "post-sync"
+)
+
+// HookError reports a sync hook whose command failed.
+type HookError struct {
+	Stage   HookStage
+	Command string
+	// Output is what the command wrote to stdout and stderr, see
+	// CombinedOutput.
+	Output string
+	Err    error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("goScp: %s hook %q failed: %v", e.Stage, e.Command, e.Err)
+}
+
+// Is lets errors.Is match a *HookError against ErrHookFailed.
+func (e *HookError) Is(target error) bool {
+	return target == ErrHookFailed
+}
+
+// HookFailurePolicy decides what a failing SyncHook does to its sync.
+type HookFailurePolicy int
+
+const (
+	// AbortOnHookFailure fails the sync. A failing pre-sync hook keeps the
+	// files and the hooks after it from being touched, a failing post-sync
+	// hook keeps the post-sync hooks after it from running, except for those
+	// set to run Always.
+	AbortOnHookFailure HookFailurePolicy = iota
+	// IgnoreHookFailure goes on as if the hook succeeded, its error is listed
+	// in SyncResult.HookErrors.
+	IgnoreHookFailure
+)
+
+// SyncHook is a command Sync runs on the remote host before or after it
+// touches the files, e.g. to stop a service during the sync and reload it
+// afterwards:
+//
+//	opts := SyncOptions{
+//		PreSync:  []SyncHook{{Command: "sudo systemctl stop app"}},
+//		PostSync: []SyncHook{{Command: "sudo systemctl start app", Always: true}},
+//	}
+//
+// Hooks run in the login directory, one after the other, and not at all for
+// dry runs.
+type SyncHook struct {
+	Command   string
+	OnFailure HookFailurePolicy
+	// Always runs a post-sync hook even when the sync or an earlier hook
+	// failed, e.g. to start a service a pre-sync hook stopped again. It has
+	// no effect on pre-sync hooks.
+	Always bool
+	// CommandOptions are passed to ExecuteCommand, e.g. WithCommandTimeout.
+	CommandOptions []CommandOption
+}
+
+// run runs the hook, returning a *HookError when it fails.
+func (h SyncHook) run(client *ssh.Client, stage HookStage) error {
+	output := &CombinedOutput{}
+	opts := append([]CommandOption{WithCombinedOutput(output)}, h.CommandOptions...)
+	if _, err := ExecuteCommand(client, h.Command, opts...); err != nil {
+		return &HookError{Stage: stage, Command: h.Command, Output: output.String(), Err: err}
+	}
+	return nil
+}
+
+// syncWithHooks runs sync between the pre-sync and post-sync hooks of opts.
+// The result of a sync is returned even when a post-sync hook failed after
+// it.
+func syncWithHooks(client *ssh.Client, opts SyncOptions, sync func() (*SyncResult, error)) (*SyncResult, error) {
+	var ignored []error
+	for _, hook := range opts.PreSync {
+		if err := hook.run(client, PreSync); err != nil {
+			if hook.OnFailure != IgnoreHookFailure {
+				return nil, err
+			}
+			ignored = append(ignored, err)
+		}
+	}
+
+	result, err := sync()
+	for _, hook := range opts.PostSync {
+		if err != nil && !hook.Always {
+			continue
+		}
+		hookErr := hook.run(client, PostSync)
+		switch {
+		case hookErr == nil:
+		case hook.OnFailure == IgnoreHookFailure:
+			ignored = append(ignored, hookErr)
+		case err == nil:
+			err = hookErr
+		default:
+			err = fmt.Errorf("%w, and then %v", err, hookErr)
+		}
+	}
+	if result != nil {
+		result.HookErrors = ignored
+	}
+	return result, err
+}
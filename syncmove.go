@@ -0,0 +1,157 @@
+package goScp
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"path/filepath"
+	"strings"
+)
+
+// MoveHash is the hash SyncOptions.DetectMoves compares files with, computed
+// by Command on the remote host and by New locally.
+type MoveHash struct {
+	// Command is a remote program printing sums in the format of the
+	// coreutils sha256sum, e.g. "md5sum" or "b3sum".
+	Command string
+	New     func() hash.Hash
+}
+
+// The hashes of coreutils. SHA256MoveHash is the default, MD5MoveHash and
+// SHA1MoveHash are faster on slow remote hosts, at the risk of moving a
+// file of the same size and a colliding sum.
+var (
+	SHA256MoveHash = MoveHash{Command: "sha256sum", New: sha256.New}
+	SHA1MoveHash   = MoveHash{Command: "sha1sum", New: sha1.New}
+	MD5MoveHash    = MoveHash{Command: "md5sum", New: md5.New}
+)
+
+// or returns h, or fallback when h is the zero MoveHash.
+func (h MoveHash) or(fallback MoveHash) MoveHash {
+	if h.Command == "" || h.New == nil {
+		return fallback
+	}
+	return h
+}
+
+// SyncMove is a remote file Sync moved to where a new local file with the
+// same contents is, instead of deleting it and uploading that file.
+type SyncMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// detectMoves turns every file result uploads that has the same sum under
+// moveHash as a file it deletes into a move of that file, so renamed and moved
+// files are not sent again. Only files of equal size are hashed; empty files
+// are cheaper to upload than to look for.
+func detectMoves(client *ssh.Client, localDir string, remoteDir string, moveHash MoveHash, diffs []FileDiff, result *SyncResult) error {
+	deleted := map[string]bool{}
+	for _, name := range result.Deleted {
+		deleted[name] = true
+	}
+	goneBySize := map[int64][]string{}
+	var added []FileDiff
+	for _, diff := range diffs {
+		switch {
+		case diff.Kind == OnlyRemote && deleted[diff.Path] && diff.RemoteSize > 0:
+			goneBySize[diff.RemoteSize] = append(goneBySize[diff.RemoteSize], diff.Path)
+		case diff.Kind == OnlyLocal && diff.LocalSize > 0:
+			added = append(added, diff)
+		}
+	}
+	var candidates []FileDiff
+	var gone []string
+	hashed := map[int64]bool{}
+	for _, diff := range added {
+		if names, ok := goneBySize[diff.LocalSize]; ok {
+			candidates = append(candidates, diff)
+			// Hashed once, however many new files have the size
+			if !hashed[diff.LocalSize] {
+				gone = append(gone, names...)
+				hashed[diff.LocalSize] = true
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sums, err := remoteSums(client, remoteDir, moveHash.Command, gone)
+	if err != nil {
+		// Some were removed by others since they were listed, they are
+		// uploaded as usual then
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+		return err
+	}
+	goneBySum := map[string][]string{}
+	for _, name := range gone {
+		goneBySum[sums[name]] = append(goneBySum[sums[name]], name)
+	}
+	moved := map[string]bool{}
+	for _, diff := range candidates {
+		sum, err := hashFile(filepath.Join(localDir, filepath.FromSlash(diff.Path)), moveHash.New)
+		if err != nil {
+			return err
+		}
+		from := goneBySum[hex.EncodeToString(sum)]
+		if len(from) == 0 {
+			continue
+		}
+		goneBySum[hex.EncodeToString(sum)] = from[1:]
+		result.Moved = append(result.Moved, SyncMove{From: from[0], To: diff.Path})
+		moved[from[0]], moved[diff.Path] = true, true
+	}
+	result.Uploaded = withoutNames(result.Uploaded, moved)
+	result.Deleted = withoutNames(result.Deleted, moved)
+	return nil
+}
+
+func withoutNames(names []string, exclude map[string]bool) []string {
+	var kept []string
+	for _, name := range names {
+		if !exclude[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// moveTargets returns the destinations of moves.
+func moveTargets(moves []SyncMove) []string {
+	targets := make([]string, len(moves))
+	for i, move := range moves {
+		targets[i] = move.To
+	}
+	return targets
+}
+
+// moveRemoteFiles carries out moves below remoteDir. Moves whose source is
+// gone are skipped, they were done by a sync that was interrupted later.
+func moveRemoteFiles(client *ssh.Client, remoteDir string, moves []SyncMove) error {
+	const movesPerCommand = 100
+	for start := 0; start < len(moves); start += movesPerCommand {
+		end := start + movesPerCommand
+		if end > len(moves) {
+			end = len(moves)
+		}
+
+		var cmd strings.Builder
+		cmd.WriteString("cd " + shellQuote(remoteDir) + " || exit 1")
+		for _, move := range moves[start:end] {
+			from := shellQuote(move.From)
+			cmd.WriteString(" && { [ ! -f " + from + " ] || mv -f -- " + from + " " + shellQuote(move.To) + "; }")
+		}
+		if _, err := ExecuteCommand(client, cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package goScp_test
+
+import (
+	"crypto/sha256"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSyncDetectMovesHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		moveHash goScp.MoveHash
+		moved    bool
+	}{
+		{"default", goScp.MoveHash{}, true},
+		{"sha256", goScp.SHA256MoveHash, true},
+		{"sha1", goScp.SHA1MoveHash, true},
+		{"md5", goScp.MD5MoveHash, true},
+		// The sums of the remote command and the local hash never match
+		{"mismatched", goScp.MoveHash{Command: "md5sum", New: sha256.New}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, root := startServer(t)
+			if err := os.MkdirAll(filepath.Join(root, "docs", "old"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(root, "docs", "old", "report.pdf"), []byte("report"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			localDir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(localDir, "new"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(localDir, "new", "report.pdf"), []byte("report"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := goScp.Sync(client, localDir, "docs", goScp.SyncOptions{Delete: true, DetectMoves: true, MoveHash: test.moveHash})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []goScp.SyncMove
+			if test.moved {
+				want = []goScp.SyncMove{{From: "old/report.pdf", To: "new/report.pdf"}}
+			}
+			if !reflect.DeepEqual(result.Moved, want) {
+				t.Errorf("Moved = %v, want %v", result.Moved, want)
+			}
+			if contents, err := ioutil.ReadFile(filepath.Join(root, "docs", "new", "report.pdf")); err != nil || string(contents) != "report" {
+				t.Errorf("new/report.pdf is %q, %v", contents, err)
+			}
+			if _, err := os.Stat(filepath.Join(root, "docs", "old", "report.pdf")); !os.IsNotExist(err) {
+				t.Errorf("old/report.pdf is still there: %v", err)
+			}
+		})
+	}
+}
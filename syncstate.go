@@ -0,0 +1,115 @@
+package goScp
+
+import (
+	"encoding/json"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// syncState is what SyncOptions.StateFile keeps: the local files as they
+// were when they were last synced to RemoteDir on Remote, see remoteKey.
+type syncState struct {
+	Remote    string                    `json:"remote"`
+	RemoteDir string                    `json:"remote_dir"`
+	Files     map[string]syncStateEntry `json:"files"`
+}
+
+type syncStateEntry struct {
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+}
+
+// loadSyncState reads the state of the last sync to remoteDir on the host of
+// client from filename. It returns nil when there is none, including when
+// the state is of another remote directory.
+func loadSyncState(filename string, client *ssh.Client, remoteDir string) (*syncState, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &syncState{}
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, err
+	}
+	if state.Remote != remoteKey(client) || state.RemoteDir != remoteDir {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// saveSyncState replaces filename with the state of local, the files just
+// synced to remoteDir on the host of client.
+func saveSyncState(filename string, client *ssh.Client, remoteDir string, local map[string]treeFile) error {
+	contents, err := json.Marshal(syncState{
+		Remote:    remoteKey(client),
+		RemoteDir: remoteDir,
+		Files:     stateOf(local),
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, contents)
+}
+
+// writeFileAtomic replaces filename with contents in one step, so a crash
+// cannot leave half of it.
+func writeFileAtomic(filename string, contents []byte) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func treeOf(entries map[string]syncStateEntry) map[string]treeFile {
+	files := make(map[string]treeFile, len(entries))
+	for name, entry := range entries {
+		files[name] = treeFile{size: entry.Size, mtime: entry.Mtime}
+	}
+	return files
+}
+
+func stateOf(files map[string]treeFile) map[string]syncStateEntry {
+	entries := make(map[string]syncStateEntry, len(files))
+	for name, file := range files {
+		entries[name] = syncStateEntry{Size: file.size, Mtime: file.mtime}
+	}
+	return entries
+}
+
+// compare compares local with the files of the last sync, which stand in for
+// the remote files.
+func (s *syncState) compare(local map[string]treeFile) *CompareResult {
+	result := &CompareResult{}
+	for name, file := range local {
+		synced, ok := s.Files[name]
+		switch {
+		case !ok:
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: OnlyLocal, LocalSize: file.size, LocalMtime: file.mtime})
+		case synced.Size != file.size:
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: SizeDiffers, LocalSize: file.size, RemoteSize: synced.Size, LocalMtime: file.mtime, RemoteMtime: synced.Mtime})
+		case !synced.Mtime.Equal(file.mtime):
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: MtimeDiffers, LocalSize: file.size, RemoteSize: synced.Size, LocalMtime: file.mtime, RemoteMtime: synced.Mtime})
+		default:
+			result.Identical = append(result.Identical, name)
+		}
+	}
+	for name, synced := range s.Files {
+		if _, ok := local[name]; !ok {
+			result.Diffs = append(result.Diffs, FileDiff{Path: name, Kind: OnlyRemote, RemoteSize: synced.Size, RemoteMtime: synced.Mtime})
+		}
+	}
+
+	sort.Slice(result.Diffs, func(i, j int) bool { return result.Diffs[i].Path < result.Diffs[j].Path })
+	sort.Strings(result.Identical)
+	return result
+}
@@ -0,0 +1,42 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncStateKeyedByHost(t *testing.T) {
+	server, _, root := startServer(t)
+	if err := os.Mkdir(filepath.Join(root, "site"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "index.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	// The name differs from the address connected to
+	if _, err := goScp.Sync(connectByName(t, server, "localhost"), localDir, "site", goScp.SyncOptions{StateFile: stateFile}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stateRemote(t, stateFile), "localhost:"+server.RemoteHost().Port; got != want {
+		t.Errorf("state of %q, want %q", got, want)
+	}
+
+	// A new connection to the same host trusts the state, so the file the
+	// state lists is not looked for on the remote host
+	if err := os.Remove(filepath.Join(root, "site", "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := goScp.Sync(connectByName(t, server, "localhost"), localDir, "site", goScp.SyncOptions{StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Uploaded) != 0 {
+		t.Errorf("the second sync ignored the state and uploaded %v", result.Uploaded)
+	}
+}
@@ -0,0 +1,223 @@
+package goScp
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// NewTarTransferrer returns a Transferrer that pipes tar archives through a
+// remote tar process, for hosts without scp or SFTP. Modification times are
+// kept in both directions.
+func NewTarTransferrer(client *ssh.Client) Transferrer {
+	return &tarTransferrer{shellStat{client: client}}
+}
+
+type tarTransferrer struct {
+	shellStat
+}
+
+func (t *tarTransferrer) Name() string {
+	return "tar"
+}
+
+func (t *tarTransferrer) Upload(localFile string, remotePath string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Upload, localFile, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	source, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	if options.skipIdentical {
+		identical, err := identicalOnRemote(t.client, source, remotePath, path.Base(remotePath))
+		if err != nil {
+			return err
+		}
+		if identical {
+			options.skipped()
+			return nil
+		}
+	}
+	if options.spaceCheck {
+		if err := checkRemoteSpace(t.client, remotePath, info.Size()); err != nil {
+			return err
+		}
+	}
+
+	session, err := openSession(t.client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	archiveErr := make(chan error, 1)
+	go func() {
+		defer writer.Close()
+		archive := tar.NewWriter(writer)
+		header := &tar.Header{
+			Name:    path.Base(remotePath),
+			Mode:    int64(options.fileMode(info.Mode())),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			archiveErr <- err
+			return
+		}
+		if _, err := options.buffers.copy(options.instrument(archive, info.Size()), io.TeeReader(source, hash)); err != nil {
+			archiveErr <- err
+			return
+		}
+		archiveErr <- archive.Close()
+	}()
+
+	err = session.Run("tar -x -f - -C " + shellQuote(path.Dir(remotePath)))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-archiveErr; err != nil {
+		return err
+	}
+
+	if options.manifest != nil {
+		options.manifest.record(Upload, localFile, remotePath, info.Size(), hash.Sum(nil))
+	}
+	return nil
+}
+
+func (t *tarTransferrer) Download(remotePath string, localFile string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	options.begin(Download, localFile, remotePath, 0)
+	defer func() { options.finish(err) }()
+
+	session, err := openSession(t.client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd := "tar -c -f - -C " + shellQuote(path.Dir(remotePath)) + " " + shellQuote("./"+path.Base(remotePath))
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	archive := tar.NewReader(reader)
+	header, err := archive.Next()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if waitErr := session.Wait(); waitErr != nil {
+			return waitErr
+		}
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return errors.New("goScp: " + remotePath + " is not a regular file")
+	}
+	if err := options.checkLocalSpace(localFile, header.Size); err != nil {
+		return err
+	}
+
+	destination, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	hash := sha256.New()
+	written, flush := fileWriter(destination)
+	_, err = options.buffers.copy(options.instrument(io.MultiWriter(written, hash), header.Size), archive)
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	io.Copy(ioutil.Discard, reader)
+	if err := session.Wait(); err != nil {
+		return err
+	}
+	if err := destination.Sync(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(localFile, header.ModTime, header.ModTime); err != nil {
+		return err
+	}
+
+	if options.manifest != nil {
+		options.manifest.record(Download, localFile, remotePath, header.Size, hash.Sum(nil))
+	}
+	return nil
+}
+
+// Link extracts an archive holding remotePath as a hard link to target. tar
+// resolves link targets against the directory it extracts to, so both paths
+// have to be either absolute or relative to the login directory.
+func (t *tarTransferrer) Link(target string, remotePath string) error {
+	dir := "."
+	if path.IsAbs(target) && path.IsAbs(remotePath) {
+		dir = "/"
+	} else if path.IsAbs(target) || path.IsAbs(remotePath) {
+		return errors.New("goScp: tar cannot link an absolute and a relative path")
+	}
+	name, linkname := strings.TrimPrefix(path.Clean(remotePath), "/"), strings.TrimPrefix(path.Clean(target), "/")
+	if name == ".." || strings.HasPrefix(name, "../") || linkname == ".." || strings.HasPrefix(linkname, "../") {
+		return errors.New("goScp: tar cannot link paths outside the login directory")
+	}
+
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	if err := writer.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: name, Linkname: linkname}); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	session, err := openSession(t.client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = &archive
+	return session.Run("tar -x -f - -C " + shellQuote(dir))
+}
+
+func (t *tarTransferrer) Close() error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package goScp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunkSize is the largest write let through a throttle at once, so
+// large writes are spread out instead of sent in a single burst.
+const throttleChunkSize = 32 * 1024
+
+// throttle holds back writes to stay under a bandwidth limit shared by every
+// transfer using it, and blocks them completely while paused.
+type throttle struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	paused    bool
+	rate      int64
+	allowance float64
+	last      time.Time
+}
+
+// newThrottle returns a throttle allowing bytesPerSecond, or any rate when it
+// is zero or less.
+func newThrottle(bytesPerSecond int64) *throttle {
+	t := &throttle{rate: bytesPerSecond}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *throttle) setPaused(paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.paused = paused
+	t.last = time.Time{}
+	t.cond.Broadcast()
+}
+
+// wait blocks until n more bytes may be written, or until ctx is done and
+// returns its error.
+func (t *throttle) wait(ctx context.Context, n int) error {
+	t.mu.Lock()
+	if t.paused {
+		stop := t.wakeOnCancel(ctx)
+		for t.paused && ctx.Err() == nil {
+			t.cond.Wait()
+		}
+		stop()
+	}
+	if err := ctx.Err(); err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	if t.rate <= 0 {
+		t.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if !t.last.IsZero() {
+		t.allowance += now.Sub(t.last).Seconds() * float64(t.rate)
+	}
+	// Allow bursts of at most one second worth of data
+	if t.allowance > float64(t.rate) {
+		t.allowance = float64(t.rate)
+	}
+	t.last = now
+	t.allowance -= float64(n)
+	var delay time.Duration
+	if t.allowance < 0 {
+		delay = time.Duration(-t.allowance / float64(t.rate) * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wakeOnCancel wakes the waiters of t once ctx is done, so a paused wait can
+// give up. The returned function stops watching ctx.
+func (t *throttle) wakeOnCancel(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.cond.Broadcast()
+			t.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// throttledWriter passes writes to w in chunks, each of them let through by
+// every throttle, until ctx is done.
+type throttledWriter struct {
+	ctx       context.Context
+	w         io.Writer
+	throttles []*throttle
+}
+
+func (t *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+		for _, throttle := range t.throttles {
+			if err := throttle.wait(t.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,46 @@
+package goScp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleWaitCanceledWhilePaused(t *testing.T) {
+	throttle := newThrottle(0)
+	throttle.setPaused(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- throttle.wait(ctx, 1) }()
+	select {
+	case err := <-done:
+		t.Fatalf("wait returned %v while paused", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("wait: got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after its context was canceled")
+	}
+}
+
+func TestThrottleWaitCanceledWhileLimited(t *testing.T) {
+	throttle := newThrottle(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// A megabyte at one byte per second would sleep for days
+	start := time.Now()
+	if err := throttle.wait(ctx, 1<<20); err != context.DeadlineExceeded {
+		t.Errorf("wait: got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("wait took %v after its context was done", elapsed)
+	}
+}
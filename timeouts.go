@@ -0,0 +1,62 @@
+package goScp
+
+import (
+	"golang.org/x/crypto/ssh"
+	"net"
+	"time"
+)
+
+// WithConnectTimeout limits how long Connect may take to dial the remote host,
+// negotiate and authenticate. It does not limit anything done over the
+// connection afterwards, see WithCommandTimeout and WithTimeout for that.
+func WithConnectTimeout(timeout time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		o.connectTimeout = timeout
+	}
+}
+
+// WithCommandTimeout makes ExecuteCommand behave like
+// ExecuteCommandWithTimeout with timeout.
+func WithCommandTimeout(timeout time.Duration) CommandOption {
+	return func(o *commandOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTimeout aborts the transfer once it has taken longer than timeout, it
+// then fails with context.DeadlineExceeded. It is applied on top of the
+// context of WithContext.
+func WithTimeout(timeout time.Duration) TransferOption {
+	return func(o *transferOptions) {
+		o.timeout = timeout
+	}
+}
+
+// newClientConn runs the SSH handshake with addr over conn like ssh.Dial, but
+// fails once it has not finished within timeout, when that is above zero.
+// ssh.ClientConfig.Timeout only covers the TCP connection, not the handshake
+// that follows.
+func newClientConn(conn net.Conn, addr string, config *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	if timeout <= 0 {
+		clientConn, channels, requests, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return ssh.NewClient(clientConn, channels, requests), nil
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		clientConn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
@@ -0,0 +1,24 @@
+package goScp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimeoutRunsFromBeginToFinish(t *testing.T) {
+	options := newTransferOptions([]TransferOption{WithTimeout(time.Hour)})
+	if _, ok := options.transferContext().Deadline(); ok {
+		t.Fatal("the timer started before the transfer")
+	}
+
+	options.begin(Upload, "local", "remote", 0)
+	ctx := options.transferContext()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Hour {
+		t.Fatalf("deadline %v, %v after begin, want within the hour", deadline, ok)
+	}
+	options.finish(nil)
+	if ctx.Err() != context.Canceled {
+		t.Errorf("finish left the timer running: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,145 @@
+package goScp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// traceDataBytes is how many bytes of file contents a trace shows in hex,
+// the rest of every chunk is only counted.
+const traceDataBytes = 32
+
+// WithProtocolTrace writes every scp protocol message exchanged by the
+// transfer to w, one line per message with the direction, the bytes in hex
+// and what they mean, e.g.
+//
+//	<- 43 30 36 34 34 20 31 32 20 61 0a  file record: mode 0644, 12 bytes, name "a"
+//	-> 00                                status OK
+//
+// Chunks of file contents are shown with their first bytes only. It is meant
+// for debugging servers that do not speak the protocol as expected, and
+// applies to the scp backend. w is written from the transferring goroutine.
+func WithProtocolTrace(w io.Writer) TransferOption {
+	return func(o *transferOptions) {
+		o.tracer = &protocolTracer{w: w}
+	}
+}
+
+// protocolTracer writes scp protocol traces. A nil tracer traces nothing.
+type protocolTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// session marks the start of the scp session running cmd in the trace.
+func (t *protocolTracer) session(cmd string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "== %s\n", cmd)
+}
+
+// trace writes a single message, received tells its direction and data
+// whether it is file contents.
+func (t *protocolTracer) trace(received bool, b []byte, data bool) {
+	if t == nil || len(b) == 0 {
+		return
+	}
+	direction := "->"
+	if received {
+		direction = "<-"
+	}
+
+	shown := b
+	if data && len(shown) > traceDataBytes {
+		shown = shown[:traceDataBytes]
+	}
+	var hex strings.Builder
+	for i, c := range shown {
+		if i > 0 {
+			hex.WriteByte(' ')
+		}
+		fmt.Fprintf(&hex, "%02x", c)
+	}
+	if len(shown) < len(b) {
+		fmt.Fprintf(&hex, " ...")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %-32s %s\n", direction, hex.String(), interpretMessage(b, data))
+}
+
+// interpretMessage describes a protocol message for the trace.
+func interpretMessage(b []byte, data bool) string {
+	if data {
+		return fmt.Sprintf("file contents, %d bytes", len(b))
+	}
+	switch b[0] {
+	case statusOK:
+		if len(b) == 1 {
+			return "status OK"
+		}
+	case statusWarning, statusFatal:
+		kind := "warning"
+		if b[0] == statusFatal {
+			kind = "error"
+		}
+		return fmt.Sprintf("status %s: %q", kind, strings.TrimSuffix(string(b[1:]), "\n"))
+	}
+
+	line := string(b)
+	if !strings.HasSuffix(line, "\n") {
+		return fmt.Sprintf("unexpected bytes %q", line)
+	}
+	record, err := parseRecord(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		return err.Error()
+	}
+	switch record.kind {
+	case recordFile:
+		return fmt.Sprintf("file record: mode %04o, %d bytes, name %q", record.mode, record.size, record.name)
+	case recordDir:
+		return fmt.Sprintf("directory record: mode %04o, name %q", record.mode, record.name)
+	case recordEndDir:
+		return "end of directory record"
+	case recordTimes:
+		return fmt.Sprintf("times record: modified %s, accessed %s", record.mtime.UTC().Format("2006-01-02T15:04:05.000000Z"), record.atime.UTC().Format("2006-01-02T15:04:05.000000Z"))
+	}
+	return fmt.Sprintf("record %q", line)
+}
+
+// tracingWriter traces everything sent to the remote scp. Every control write
+// of the package is a single message, so writes are traced as they are.
+type tracingWriter struct {
+	w      io.Writer
+	tracer *protocolTracer
+	data   bool
+}
+
+func (t tracingWriter) Write(b []byte) (int, error) {
+	t.tracer.trace(false, b, t.data)
+	return t.w.Write(b)
+}
+
+// traceWriter returns w tracing what is written to it when the transfer is
+// traced, data tells whether file contents are written to it.
+func (o *transferOptions) traceWriter(w io.Writer, data bool) io.Writer {
+	if o.tracer == nil {
+		return w
+	}
+	return tracingWriter{w: w, tracer: o.tracer, data: data}
+}
+
+// protocolReader returns a protocolReader of r for the transfer, tracing what
+// is read when the transfer is traced.
+func (o *transferOptions) protocolReader(r io.Reader) *protocolReader {
+	protocol := newProtocolReader(r)
+	protocol.tracer = o.tracer
+	protocol.lenient = o.scpCompat
+	return protocol
+}
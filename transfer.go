@@ -0,0 +1,101 @@
+package goScp
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"sync/atomic"
+)
+
+// Transfer is an upload or download running in the background, started by
+// StartUpload or StartDownload.
+type Transfer struct {
+	done        chan struct{}
+	err         error
+	ctx         context.Context
+	cancel      context.CancelFunc
+	transferred int64
+	total       int64
+}
+
+// newTransfer returns a Transfer that has not started yet, along with opts
+// extended to report to it.
+func newTransfer(opts []TransferOption) (*Transfer, []TransferOption) {
+	// The caller's own context and progress callback keep working
+	options := newTransferOptions(opts)
+	ctx, cancel := context.WithCancel(options.transferContext())
+	t := &Transfer{done: make(chan struct{}), ctx: ctx, cancel: cancel}
+	callerProgress := options.progress
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), WithProgress(func(transferred int64, total int64) {
+		atomic.StoreInt64(&t.transferred, transferred)
+		atomic.StoreInt64(&t.total, total)
+		if callerProgress != nil {
+			callerProgress(transferred, total)
+		}
+	}))
+	return t, opts
+}
+
+// run runs the transfer unless it has already been canceled.
+func (t *Transfer) run(run func(opts []TransferOption) error, opts []TransferOption) {
+	defer close(t.done)
+	defer t.cancel()
+	if err := t.ctx.Err(); err != nil {
+		t.err = err
+		return
+	}
+	t.err = run(opts)
+}
+
+func startTransfer(opts []TransferOption, run func(opts []TransferOption) error) *Transfer {
+	t, opts := newTransfer(opts)
+	go t.run(run, opts)
+	return t
+}
+
+// StartUpload runs CopyLocalFileToRemote in the background.
+func StartUpload(client *ssh.Client, localFilePath string, filename string, opts ...TransferOption) *Transfer {
+	return startTransfer(opts, func(opts []TransferOption) error {
+		return CopyLocalFileToRemote(client, localFilePath, filename, opts...)
+	})
+}
+
+// StartDownload runs CopyRemoteFileToLocal in the background.
+func StartDownload(client *ssh.Client, remoteFilePath string, remoteFilename string, localFilePath string, localFileName string, opts ...TransferOption) *Transfer {
+	return startTransfer(opts, func(opts []TransferOption) error {
+		return CopyRemoteFileToLocal(client, remoteFilePath, remoteFilename, localFilePath, localFileName, opts...)
+	})
+}
+
+// Done is closed once the transfer has finished, failed or been canceled.
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the error the transfer finished with. It is nil until Done is
+// closed.
+func (t *Transfer) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the transfer has finished and returns its error.
+func (t *Transfer) Wait() error {
+	<-t.done
+	return t.err
+}
+
+// Progress returns the bytes transferred so far and the size of the file. The
+// size is zero until it is known.
+func (t *Transfer) Progress() (transferred int64, total int64) {
+	return atomic.LoadInt64(&t.transferred), atomic.LoadInt64(&t.total)
+}
+
+// Cancel aborts the transfer. The transfer then finishes with
+// context.Canceled.
+func (t *Transfer) Cancel() {
+	t.cancel()
+}
@@ -0,0 +1,101 @@
+package goScp_test
+
+import (
+	"bytes"
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// awkwardNames are file names the scp record has to carry as they are.
+var awkwardNames = []string{
+	"plain.txt",
+	"my report.pdf",
+	"  two leading spaces",
+	"trailing space ",
+	"résumé ünïcødé.txt",
+	"日本語 ファイル.txt",
+	"emoji 🚀.bin",
+	"quote's \"and\" $dollar `tick`.txt",
+}
+
+func TestRoundTripFileNames(t *testing.T) {
+	_, client, root := startServer(t)
+	localDir := t.TempDir()
+	downloadDir := t.TempDir()
+
+	for _, name := range awkwardNames {
+		contents := []byte("contents of " + name + "\n")
+		if err := ioutil.WriteFile(filepath.Join(localDir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := goScp.CopyLocalFileToRemote(client, localDir, name); err != nil {
+			t.Errorf("upload of %q: %v", name, err)
+			continue
+		}
+		uploaded, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil || !bytes.Equal(uploaded, contents) {
+			t.Errorf("upload of %q arrived as %q, %v", name, uploaded, err)
+			continue
+		}
+
+		if err := goScp.CopyRemoteFileToLocal(client, ".", name, downloadDir, ""); err != nil {
+			t.Errorf("download of %q: %v", name, err)
+			continue
+		}
+		downloaded, err := ioutil.ReadFile(filepath.Join(downloadDir, name))
+		if err != nil || !bytes.Equal(downloaded, contents) {
+			t.Errorf("download of %q arrived as %q, %v", name, downloaded, err)
+		}
+	}
+}
+
+func TestRoundTripRenamed(t *testing.T) {
+	_, client, root := startServer(t)
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "app-1.2.3.tar.gz"), []byte("release"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "my releases"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := goScp.CopyLocalFileToRemotePath(client, localDir, "app-1.2.3.tar.gz", "my releases", "app ü.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "my releases", "app ü.tar.gz")); err != nil {
+		t.Fatal(err)
+	}
+
+	downloadDir := t.TempDir()
+	if err := goScp.CopyRemoteFileToLocal(client, "my releases", "app ü.tar.gz", downloadDir, "local copy.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "local copy.tar.gz")); err != nil || string(contents) != "release" {
+		t.Fatalf("download arrived as %q, %v", contents, err)
+	}
+}
+
+func TestUploadRefusesNewlineInName(t *testing.T) {
+	_, client, root := startServer(t)
+	localDir := t.TempDir()
+	name := "trailing newline\n"
+	if err := ioutil.WriteFile(filepath.Join(localDir, name), []byte("x"), 0644); err != nil {
+		t.Skipf("the local file system cannot hold the name: %v", err)
+	}
+
+	// The newline would end the C record early, so the name cannot be sent
+	if err := goScp.CopyLocalFileToRemote(client, localDir, name); err == nil {
+		t.Fatal("upload of a name with a newline succeeded")
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("upload left %q behind", entry.Name())
+	}
+}
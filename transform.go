@@ -0,0 +1,200 @@
+package goScp
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Transformer changes file contents on their way to and from the remote host,
+// e.g. to compress or encrypt them. Uploads are encoded by every transformer
+// of a transfer in order, downloads decoded in the reverse order.
+type Transformer interface {
+	// Encode returns a reader of the encoded contents of r. When the reader
+	// is an io.Closer, it is closed once the upload is done with it, read to
+	// the end or not.
+	Encode(r io.Reader) (io.Reader, error)
+	// Decode returns a writer decoding into w. It is closed once everything
+	// is written, and must not close w.
+	Decode(w io.Writer) (io.WriteCloser, error)
+}
+
+// SizedTransformer is a Transformer that knows the encoded size up front.
+// scp announces the size of a file before sending it, so uploads through
+// transformers that are not sized are encoded into a temporary file first.
+type SizedTransformer interface {
+	Transformer
+	EncodedSize(size int64) int64
+}
+
+// NewEncryptionTransformer returns a SizedTransformer encrypting with AES-GCM
+// under key, see WithEncryption.
+func NewEncryptionTransformer(key []byte) Transformer {
+	return encryptionTransformer{key: key}
+}
+
+type encryptionTransformer struct {
+	key []byte
+}
+
+func (t encryptionTransformer) Encode(r io.Reader) (io.Reader, error) {
+	aead, err := newAEAD(t.key)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptingReader(r, aead)
+}
+
+func (t encryptionTransformer) Decode(w io.Writer) (io.WriteCloser, error) {
+	aead, err := newAEAD(t.key)
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptingWriter(w, aead), nil
+}
+
+func (t encryptionTransformer) EncodedSize(size int64) int64 {
+	// The tag size of the standard AES-GCM
+	return encryptedSize(size, 16)
+}
+
+// NewGzipTransformer returns a Transformer compressing with gzip at level, see
+// compress/gzip.
+func NewGzipTransformer(level int) Transformer {
+	return gzipTransformer{level: level}
+}
+
+type gzipTransformer struct {
+	level int
+}
+
+// Encode compresses in a goroutine, which ends once the returned reader is
+// read to the end or closed.
+func (t gzipTransformer) Encode(r io.Reader) (io.Reader, error) {
+	reader, writer := io.Pipe()
+	compressor, err := gzip.NewWriterLevel(writer, t.level)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_, err := io.Copy(compressor, r)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+func (t gzipTransformer) Decode(w io.Writer) (io.WriteCloser, error) {
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		decompressor, err := gzip.NewReader(reader)
+		if err == nil {
+			_, err = io.Copy(w, decompressor)
+		}
+		// Unblock the writer when decompressing failed half way
+		reader.CloseWithError(err)
+		done <- err
+	}()
+	return &pipeDecoder{PipeWriter: writer, done: done}, nil
+}
+
+// pipeDecoder is the writing end of a pipe read by a decoding goroutine.
+// Close waits for the goroutine to finish and returns its error.
+type pipeDecoder struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (p *pipeDecoder) Close() error {
+	p.PipeWriter.Close()
+	return <-p.done
+}
+
+// encode runs content of size bytes through the transformers of the transfer
+// and returns the encoded content and its size. Unless every transformer is
+// sized, the encoded content is spooled to a temporary file. The returned
+// cleanup closes the encoded readers, unblocking transformers the upload
+// stopped reading from, and removes the temporary file.
+func (o *transferOptions) encode(content io.Reader, size int64) (io.Reader, int64, func(), error) {
+	var closers []io.Closer
+	cleanup := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+	if len(o.transformers) == 0 {
+		return content, size, cleanup, nil
+	}
+
+	sized := true
+	for _, transformer := range o.transformers {
+		encoded, err := transformer.Encode(content)
+		if err != nil {
+			cleanup()
+			return nil, 0, func() {}, err
+		}
+		if closer, ok := encoded.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+		content = encoded
+		if sizedTransformer, ok := transformer.(SizedTransformer); ok && sized {
+			size = sizedTransformer.EncodedSize(size)
+		} else {
+			sized = false
+		}
+	}
+	if sized {
+		return content, size, cleanup, nil
+	}
+
+	spool, err := ioutil.TempFile("", "goscp-encoded-")
+	if err != nil {
+		cleanup()
+		return nil, 0, func() {}, err
+	}
+	closeEncoded := cleanup
+	cleanup = func() {
+		closeEncoded()
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	size, err = io.Copy(spool, content)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, func() {}, err
+	}
+	return spool, size, cleanup, nil
+}
+
+// decode returns a writer decoding through the transformers of the transfer
+// into w, and the function finishing the decoding once everything has been
+// written.
+func (o *transferOptions) decode(w io.Writer) (io.Writer, func() error, error) {
+	var decoders []io.WriteCloser
+	finish := func() error {
+		var firstErr error
+		for i := len(decoders) - 1; i >= 0; i-- {
+			if err := decoders[i].Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	for _, transformer := range o.transformers {
+		decoder, err := transformer.Decode(w)
+		if err != nil {
+			finish()
+			return nil, nil, err
+		}
+		decoders = append(decoders, decoder)
+		w = decoder
+	}
+	return w, finish, nil
+}
@@ -0,0 +1,86 @@
+package goScp_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"github.com/kalfke/go-scp"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// streamingGzip is gzip claiming to know its encoded size, so uploads stream
+// through its pipe instead of spooling it to a temporary file.
+type streamingGzip struct {
+	goScp.Transformer
+}
+
+func (streamingGzip) EncodedSize(size int64) int64 {
+	return size
+}
+
+// failingTransformer cannot encode anything.
+type failingTransformer struct{}
+
+func (failingTransformer) Encode(r io.Reader) (io.Reader, error) {
+	return nil, errors.New("cannot encode")
+}
+
+func (failingTransformer) Decode(w io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("cannot decode")
+}
+
+// checkGzipEnded fails when a gzip encoding goroutine keeps running.
+func checkGzipEnded(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stacks := make([]byte, 1<<20)
+		stacks = stacks[:runtime.Stack(stacks, true)]
+		if !bytes.Contains(stacks, []byte("gzipTransformer.Encode")) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the gzip encoding goroutine is left running:\n%s", stacks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeRandomFile writes size incompressible bytes to a new local file.
+func writeRandomFile(t *testing.T, name string, size int) string {
+	t.Helper()
+	contents := make([]byte, size)
+	rand.Read(contents)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFailedTransformedUploadDoesNotLeak(t *testing.T) {
+	_, client, _ := startServer(t)
+	localDir := writeRandomFile(t, "data.bin", 1<<20)
+
+	err := goScp.CopyLocalFileToRemotePath(client, localDir, "data.bin", "missing/dir", "", goScp.WithTransformers(streamingGzip{goScp.NewGzipTransformer(1)}))
+	if err == nil {
+		t.Fatal("upload into a missing directory succeeded")
+	}
+	checkGzipEnded(t)
+}
+
+func TestFailedEncodingDoesNotLeak(t *testing.T) {
+	_, client, _ := startServer(t)
+	localDir := writeRandomFile(t, "data.bin", 1<<20)
+
+	err := goScp.CopyLocalFileToRemote(client, localDir, "data.bin", goScp.WithTransformers(goScp.NewGzipTransformer(1), failingTransformer{}))
+	if err == nil {
+		t.Fatal("upload through a failing transformer succeeded")
+	}
+	checkGzipEnded(t)
+}
@@ -0,0 +1,345 @@
+package goScp
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Resolution tells TwoWaySync what to do with a conflict.
+type Resolution string
+
+const (
+	// SkipConflict leaves both files alone, the conflict is reported again by
+	// the next sync.
+	SkipConflict Resolution = ""
+	// KeepLocal overwrites the remote file with the local one, or deletes it
+	// when the local one was deleted.
+	KeepLocal Resolution = "keep-local"
+	// KeepRemote overwrites the local file with the remote one, or deletes it
+	// when the remote one was deleted.
+	KeepRemote Resolution = "keep-remote"
+	// RenameBoth renames the local file to Path plus ".local" and the remote
+	// one to Path plus ".remote", and copies both to the other side, so
+	// nothing is lost and they can be merged by hand.
+	RenameBoth Resolution = "rename-both"
+)
+
+// Conflict is a file that changed on both sides since the last sync. A file
+// deleted on one side has LocalDeleted or RemoteDeleted set and zero size and
+// modification time for that side.
+type Conflict struct {
+	Path          string
+	LocalSize     int64
+	RemoteSize    int64
+	LocalMtime    time.Time
+	RemoteMtime   time.Time
+	LocalDeleted  bool
+	RemoteDeleted bool
+	// Resolution is what was done about the conflict.
+	Resolution Resolution
+}
+
+// TwoWaySyncOptions configures TwoWaySync.
+type TwoWaySyncOptions struct {
+	// StateFile is the local file keeping both trees as they were after the
+	// last sync, which tells on which side a file changed. It is required and
+	// created by the first sync, which reports every file that exists on both
+	// sides with a different size or modification time as a conflict.
+	StateFile string
+	// Resolve decides what to do with a conflict. Nil skips every conflict,
+	// so they are only reported.
+	Resolve func(Conflict) Resolution
+	// DryRun only reports what would be transferred, deleted and in conflict,
+	// without calling Resolve.
+	DryRun bool
+	// TransferOptions are applied to every upload and download.
+	TransferOptions []TransferOption
+}
+
+// TwoWaySyncResult lists what TwoWaySync did by slash separated paths
+// relative to the synced directories.
+type TwoWaySyncResult struct {
+	Uploaded      []string
+	Downloaded    []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	Conflicts     []Conflict
+}
+
+// twoWayState is what TwoWaySyncOptions.StateFile keeps.
+type twoWayState struct {
+	Remote      string                    `json:"remote"`
+	RemoteDir   string                    `json:"remote_dir"`
+	Local       map[string]syncStateEntry `json:"local"`
+	RemoteFiles map[string]syncStateEntry `json:"remote_files"`
+}
+
+// TwoWaySync syncs localDir and remoteDir in both directions: files created
+// or changed on one side since the last sync are copied to the other, and
+// files deleted on one side are deleted on the other. Files changed on both
+// sides are conflicts, which are passed to opts.Resolve instead of one side
+// silently overwriting the other. Modification times are compared at one
+// second precision. Files excluded by the IgnoreFileName files below localDir
+// are left out on both sides.
+func TwoWaySync(client *ssh.Client, localDir string, remoteDir string, opts TwoWaySyncOptions) (*TwoWaySyncResult, error) {
+	if opts.StateFile == "" {
+		return nil, errors.New("goScp: two way sync needs a state file")
+	}
+	if err := checkDeleteDir(remoteDir); err != nil {
+		return nil, err
+	}
+	state, err := loadTwoWayState(opts.StateFile, client, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	local, remote, err := listBothTrees(client, localDir, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, files := range []map[string]treeFile{local, remote, treeOf(state.Local), treeOf(state.RemoteFiles)} {
+		for name := range files {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	result := &TwoWaySyncResult{}
+	for _, name := range sorted {
+		localFile, localExists := local[name]
+		remoteFile, remoteExists := remote[name]
+		localChanged := changedSince(state.Local, name, localFile, localExists)
+		remoteChanged := changedSince(state.RemoteFiles, name, remoteFile, remoteExists)
+
+		switch {
+		case !localChanged && !remoteChanged:
+		case localChanged && !remoteChanged:
+			if localExists {
+				result.Uploaded = append(result.Uploaded, name)
+			} else {
+				result.DeletedRemote = append(result.DeletedRemote, name)
+			}
+		case remoteChanged && !localChanged:
+			if remoteExists {
+				result.Downloaded = append(result.Downloaded, name)
+			} else {
+				result.DeletedLocal = append(result.DeletedLocal, name)
+			}
+		case localExists == remoteExists && (!localExists || sameFile(localFile, remoteFile)):
+			// Both sides made the same change
+		default:
+			result.Conflicts = append(result.Conflicts, Conflict{
+				Path:          name,
+				LocalSize:     localFile.size,
+				RemoteSize:    remoteFile.size,
+				LocalMtime:    localFile.mtime,
+				RemoteMtime:   remoteFile.mtime,
+				LocalDeleted:  !localExists,
+				RemoteDeleted: !remoteExists,
+			})
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for i, conflict := range result.Conflicts {
+		if opts.Resolve != nil {
+			result.Conflicts[i].Resolution = opts.Resolve(conflict)
+		}
+		if err := resolveConflict(client, localDir, remoteDir, result.Conflicts[i], opts.TransferOptions); err != nil {
+			return result, err
+		}
+	}
+	if err := createRemoteDirs(client, remoteDir, result.Uploaded); err != nil {
+		return result, err
+	}
+	for _, name := range result.Uploaded {
+		if err := copyLocalFileToRemote(client, filepath.Join(localDir, filepath.FromSlash(name)), path.Join(remoteDir, name), opts.TransferOptions...); err != nil {
+			return result, err
+		}
+	}
+	for _, name := range result.Downloaded {
+		if err := downloadTreeFile(client, localDir, remoteDir, name, name, opts.TransferOptions); err != nil {
+			return result, err
+		}
+	}
+	if err := removeRemoteFiles(client, remoteDir, result.DeletedRemote); err != nil {
+		return result, err
+	}
+	for _, name := range result.DeletedLocal {
+		if err := os.Remove(filepath.Join(localDir, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+	}
+
+	// Downloads get new modification times, so the trees are listed again
+	if local, remote, err = listBothTrees(client, localDir, remoteDir); err != nil {
+		return result, err
+	}
+	synced := &twoWayState{Local: stateOf(local), RemoteFiles: stateOf(remote)}
+	for _, conflict := range result.Conflicts {
+		if conflict.Resolution == SkipConflict {
+			// Keep the state of the last sync so it is a conflict again
+			synced.keep(state, conflict.Path)
+		}
+	}
+	return result, saveTwoWayState(opts.StateFile, client, remoteDir, synced)
+}
+
+// keep replaces the entries of name in s with the ones in previous.
+func (s *twoWayState) keep(previous *twoWayState, name string) {
+	for _, files := range []struct{ current, previous map[string]syncStateEntry }{
+		{s.Local, previous.Local},
+		{s.RemoteFiles, previous.RemoteFiles},
+	} {
+		if entry, ok := files.previous[name]; ok {
+			files.current[name] = entry
+		} else {
+			delete(files.current, name)
+		}
+	}
+}
+
+// resolveConflict carries out the resolution of conflict.
+func resolveConflict(client *ssh.Client, localDir string, remoteDir string, conflict Conflict, opts []TransferOption) error {
+	localFile := filepath.Join(localDir, filepath.FromSlash(conflict.Path))
+	remoteFile := path.Join(remoteDir, conflict.Path)
+
+	switch conflict.Resolution {
+	case KeepLocal:
+		if conflict.LocalDeleted {
+			return removeRemoteFiles(client, remoteDir, []string{conflict.Path})
+		}
+		if err := createRemoteDirs(client, remoteDir, []string{conflict.Path}); err != nil {
+			return err
+		}
+		return copyLocalFileToRemote(client, localFile, remoteFile, opts...)
+	case KeepRemote:
+		if conflict.RemoteDeleted {
+			if err := os.Remove(localFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		return downloadTreeFile(client, localDir, remoteDir, conflict.Path, conflict.Path, opts)
+	case RenameBoth:
+		localName := conflict.Path + ".local"
+		remoteName := conflict.Path + ".remote"
+		if !conflict.LocalDeleted {
+			if err := os.Rename(localFile, filepath.Join(localDir, filepath.FromSlash(localName))); err != nil {
+				return err
+			}
+			if err := createRemoteDirs(client, remoteDir, []string{localName}); err != nil {
+				return err
+			}
+			if err := copyLocalFileToRemote(client, filepath.Join(localDir, filepath.FromSlash(localName)), path.Join(remoteDir, localName), opts...); err != nil {
+				return err
+			}
+		}
+		if !conflict.RemoteDeleted {
+			if _, err := ExecuteCommand(client, "mv -f -- "+shellQuote(remoteFile)+" "+shellQuote(path.Join(remoteDir, remoteName))); err != nil {
+				return err
+			}
+			if err := downloadTreeFile(client, localDir, remoteDir, remoteName, remoteName, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// downloadTreeFile downloads remoteName below remoteDir to localName below
+// localDir, creating the local directories it is in.
+func downloadTreeFile(client *ssh.Client, localDir string, remoteDir string, remoteName string, localName string, opts []TransferOption) error {
+	localFile := filepath.Join(localDir, filepath.FromSlash(localName))
+	if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+		return err
+	}
+	remoteFile := path.Join(remoteDir, remoteName)
+	return CopyRemoteFileToLocal(client, path.Dir(remoteFile), path.Base(remoteFile), filepath.Dir(localFile), filepath.Base(localFile), opts...)
+}
+
+// listBothTrees lists localDir and remoteDir, leaving out what the ignore
+// files below localDir exclude.
+func listBothTrees(client *ssh.Client, localDir string, remoteDir string) (map[string]treeFile, map[string]treeFile, error) {
+	ignore := newIgnoreMatcher(localDir)
+	local, err := listLocalTree(localDir, ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := listRemoteTree(client, remoteDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name := range remote {
+		ignored, err := ignore.ignored(name, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ignored {
+			delete(remote, name)
+		}
+	}
+	return local, remote, nil
+}
+
+// changedSince reports whether name was created, changed or deleted since
+// the last sync, when it was as in synced.
+func changedSince(synced map[string]syncStateEntry, name string, file treeFile, exists bool) bool {
+	before, existed := synced[name]
+	if exists != existed {
+		return true
+	}
+	return exists && !sameFile(file, treeFile{size: before.Size, mtime: before.Mtime})
+}
+
+// sameFile compares sizes and modification times, the remote ones only have
+// whole seconds.
+func sameFile(a treeFile, b treeFile) bool {
+	return a.size == b.size && a.mtime.Unix() == b.mtime.Unix()
+}
+
+// loadTwoWayState reads the state of the last two way sync with remoteDir on
+// the host of client from filename. Without one, the state is empty.
+func loadTwoWayState(filename string, client *ssh.Client, remoteDir string) (*twoWayState, error) {
+	state := &twoWayState{}
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, err
+	}
+	if state.Remote != remoteKey(client) || state.RemoteDir != remoteDir {
+		return &twoWayState{}, nil
+	}
+	return state, nil
+}
+
+// saveTwoWayState replaces filename with state, the trees after a sync with
+// remoteDir on the host of client.
+func saveTwoWayState(filename string, client *ssh.Client, remoteDir string, state *twoWayState) error {
+	state.Remote = remoteKey(client)
+	state.RemoteDir = remoteDir
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, contents)
+}
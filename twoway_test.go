@@ -0,0 +1,47 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTwoWaySyncStateKeyedByHost(t *testing.T) {
+	server, _, root := startServer(t)
+	if err := os.Mkdir(filepath.Join(root, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "notes", "remote.txt"), []byte("remote"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "local.txt"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := goScp.TwoWaySyncOptions{StateFile: filepath.Join(t.TempDir(), "state.json")}
+
+	if _, err := goScp.TwoWaySync(connectByName(t, server, "localhost"), localDir, "notes", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stateRemote(t, opts.StateFile), "localhost:"+server.RemoteHost().Port; got != want {
+		t.Errorf("state of %q, want %q", got, want)
+	}
+
+	// With the state of the first sync, a file removed locally is one deleted
+	// on purpose, not one missing locally
+	if err := os.Remove(filepath.Join(localDir, "remote.txt")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := goScp.TwoWaySync(connectByName(t, server, "localhost"), localDir, "notes", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.DeletedRemote) != 1 || result.DeletedRemote[0] != "remote.txt" {
+		t.Errorf("DeletedRemote = %v, want remote.txt", result.DeletedRemote)
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes", "remote.txt")); !os.IsNotExist(err) {
+		t.Errorf("remote.txt was not deleted remotely: %v", err)
+	}
+}
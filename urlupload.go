@@ -0,0 +1,100 @@
+package goScp
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WithHTTPClient makes CopyURLToRemote download with client instead of
+// http.DefaultClient, e.g. to go through a proxy or add authentication.
+func WithHTTPClient(client *http.Client) TransferOption {
+	return func(o *transferOptions) {
+		o.httpClient = client
+	}
+}
+
+// CopyURLToRemote downloads rawURL over HTTP or HTTPS and streams the body
+// straight into an upload to remotePath, without storing it locally, e.g. to
+// install a release artifact on a server that cannot reach the internet
+// itself. A remotePath ending in a slash is a directory, the file is named
+// after the last element of the URL path then. The file gets mode 0644,
+// subject to WithFileMode and WithPermissionMask.
+//
+// Responses announcing their length are sent with scp. Others are written by
+// cat on the remote host, as scp has to know the size beforehand. The body
+// can only be read once, so options that read the contents twice, such as
+// WithSkipIfIdentical and WithVerifyAfterUpload, do not apply.
+func CopyURLToRemote(client *ssh.Client, rawURL string, remotePath string, opts ...TransferOption) (err error) {
+	options := newTransferOptions(opts)
+	defer func() { options.finish(err) }()
+	if strings.HasSuffix(remotePath, "/") {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		name := path.Base(parsed.Path)
+		if name == "/" || name == "." {
+			return fmt.Errorf("goScp: %s does not name a file, pass the remote file name", rawURL)
+		}
+		remotePath += name
+	}
+
+	// The size is only known from the response, the upload reports it
+	options.begin(Upload, rawURL, remotePath, -1)
+	request, err := http.NewRequestWithContext(options.transferContext(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	httpClient := options.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("goScp: downloading %s: %s", rawURL, response.Status)
+	}
+
+	mode := options.fileMode(0644)
+	if response.ContentLength >= 0 {
+		return copyContentToRemote(client, response.Body, response.ContentLength, path.Base(remotePath), mode, remotePath, options)
+	}
+	cmd := fmt.Sprintf("cat > %s && chmod %04o %s", shellQuote(remotePath), mode, shellQuote(remotePath))
+	return pipeToRemote(client, response.Body, cmd, options)
+}
+
+// pipeToRemote runs cmd on the remote host with content as its input.
+func pipeToRemote(client *ssh.Client, content io.Reader, cmd string, options *transferOptions) error {
+	session, err := openSession(client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx := options.transferContext()
+	defer closeOnCancel(ctx, session.Session)()
+
+	writer, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	_, err = options.buffers.copy(options.instrument(writer, -1), content)
+	writer.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return session.Wait()
+}
@@ -0,0 +1,52 @@
+package goScp_test
+
+import (
+	"github.com/kalfke/go-scp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyURLToRemote(t *testing.T) {
+	_, client, root := startServer(t)
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("release"))
+	}))
+	defer web.Close()
+
+	var events []goScp.Event
+	err := goScp.CopyURLToRemote(client, web.URL+"/app-1.2.3.tar.gz", "./", goScp.WithEvents(func(event goScp.Event) {
+		events = append(events, event)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(root, "app-1.2.3.tar.gz")); err != nil || string(contents) != "release" {
+		t.Errorf("uploaded %q, %v", contents, err)
+	}
+	if len(events) < 2 || events[0].Type != goScp.EventStarted || events[len(events)-1].Type != goScp.EventCompleted {
+		t.Errorf("events = %v, want started to completed", events)
+	}
+}
+
+func TestCopyURLToRemoteNotFound(t *testing.T) {
+	_, client, root := startServer(t)
+	web := httptest.NewServer(http.NotFoundHandler())
+	defer web.Close()
+
+	var events []goScp.Event
+	err := goScp.CopyURLToRemote(client, web.URL+"/missing.tar.gz", "missing.tar.gz", goScp.WithEvents(func(event goScp.Event) {
+		events = append(events, event)
+	}))
+	if err == nil {
+		t.Fatal("CopyURLToRemote of a missing URL succeeded")
+	}
+	if len(events) != 2 || events[0].Type != goScp.EventStarted || events[1].Type != goScp.EventFailed || events[1].Error != err.Error() {
+		t.Errorf("events = %v, want started and failed with %v", events, err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(root, "missing.tar.gz")); err == nil {
+		t.Error("the missing URL was uploaded")
+	}
+}
@@ -0,0 +1,58 @@
+package goScp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUploadVerification is matched by errors.Is for every
+// *UploadVerificationError.
+var ErrUploadVerification = errors.New("goScp: uploaded file does not match the local file")
+
+// UploadVerificationError is returned by uploads with WithVerifyAfterUpload
+// when the remote copy still did not match after the last attempt.
+type UploadVerificationError struct {
+	Path         string
+	LocalSHA256  string
+	RemoteSHA256 string
+	Attempts     int
+}
+
+func (e *UploadVerificationError) Error() string {
+	return fmt.Sprintf("goScp: %s has SHA-256 %s on the remote host instead of %s after %d attempts", e.Path, e.RemoteSHA256, e.LocalSHA256, e.Attempts)
+}
+
+// Is lets errors.Is match an *UploadVerificationError against
+// ErrUploadVerification.
+func (e *UploadVerificationError) Is(target error) bool {
+	return target == ErrUploadVerification
+}
+
+// WithVerifyAfterUpload hashes the remote file with sha256sum after every scp
+// upload and compares it with the hash of what was sent. On a mismatch the
+// upload is repeated up to retries times, which needs a source that can be
+// rewound, such as a local file. Uploads that still do not match fail with an
+// *UploadVerificationError.
+func WithVerifyAfterUpload(retries int) TransferOption {
+	if retries < 0 {
+		retries = 0
+	}
+	return func(o *transferOptions) {
+		o.verifyRetries = retries
+	}
+}
+
+// verifyUpload compares the SHA-256 of the uploaded remote file with sent.
+func verifyUpload(client *ssh.Client, sent []byte, remotePath string, remoteTarget string, remoteName string, attempt int) error {
+	remoteSum, err := remoteFileSHA256(client, remoteTarget, remoteName)
+	if err != nil {
+		return err
+	}
+	localSum := hex.EncodeToString(sent)
+	if remoteSum != localSum {
+		return &UploadVerificationError{Path: remotePath, LocalSHA256: localSum, RemoteSHA256: remoteSum, Attempts: attempt}
+	}
+	return nil
+}
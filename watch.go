@@ -0,0 +1,185 @@
+package goScp
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WatchOptions configures WatchAndSync.
+type WatchOptions struct {
+	// Debounce is how long the local tree has to be quiet before the changes
+	// are uploaded, so editors saving several files upload them together.
+	// Zero or less means 500ms.
+	Debounce time.Duration
+	// Delete removes the remote copies of local files that are removed.
+	Delete bool
+	// TransferOptions are applied to every upload.
+	TransferOptions []TransferOption
+	// OnSync is called after the initial sync and after every batch of
+	// changes, with what was uploaded and deleted or the error that stopped
+	// the batch.
+	OnSync func(*SyncResult, error)
+}
+
+// WatchAndSync syncs localDir to remoteDir, then watches localDir and uploads
+// every file that changes, until ctx is done. Errors of single batches are
+// passed to opts.OnSync and watching goes on; only errors of the watch itself
+// are returned.
+func WatchAndSync(ctx context.Context, client *ssh.Client, localDir string, remoteDir string, opts WatchOptions) error {
+	if opts.Delete {
+		if err := checkDeleteDir(remoteDir); err != nil {
+			return err
+		}
+	}
+	debounce := opts.Debounce
+	if debounce <= 0 {
+		debounce = 500 * time.Millisecond
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watchTree(watcher, localDir); err != nil {
+		return err
+	}
+
+	result, err := Sync(client, localDir, remoteDir, SyncOptions{Delete: opts.Delete, TransferOptions: opts.TransferOptions})
+	if opts.OnSync != nil {
+		opts.OnSync(result, err)
+	}
+
+	changed := map[string]bool{}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			return err
+		case event := <-watcher.Events:
+			if event.Op&fsnotify.Create != 0 {
+				// New directories have to be watched as well
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						return err
+					}
+				}
+			}
+			changed[event.Name] = true
+			timer.Reset(debounce)
+		case <-timer.C:
+			result, err := syncChanges(client, localDir, remoteDir, changed, opts)
+			if opts.OnSync != nil {
+				opts.OnSync(result, err)
+			}
+			changed = map[string]bool{}
+		}
+	}
+}
+
+// watchTree adds dir and every directory below it to watcher.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(name)
+		}
+		return nil
+	})
+}
+
+// syncChanges uploads the changed local paths that are files and, when asked
+// for, deletes the remote copies of the ones that are gone. Directories that
+// appeared are uploaded with everything in them. Paths excluded by the
+// IgnoreFileName files are left alone.
+func syncChanges(client *ssh.Client, localDir string, remoteDir string, changed map[string]bool, opts WatchOptions) (*SyncResult, error) {
+	result := &SyncResult{}
+	// Read again for every batch, the ignore files may have changed as well
+	ignore := newIgnoreMatcher(localDir)
+	for name := range changed {
+		rel, err := filepath.Rel(localDir, name)
+		if err != nil {
+			return result, err
+		}
+		if rel == "." {
+			// Changes to the watched directory itself carry no file
+			continue
+		}
+		info, err := os.Stat(name)
+		ignored, ignoreErr := ignore.ignored(filepath.ToSlash(rel), err == nil && info.IsDir())
+		if ignoreErr != nil {
+			return result, ignoreErr
+		}
+		if ignored {
+			continue
+		}
+		switch {
+		case os.IsNotExist(err):
+			if opts.Delete {
+				result.Deleted = append(result.Deleted, filepath.ToSlash(rel))
+			}
+		case err != nil:
+			return result, err
+		case info.Mode().IsRegular():
+			result.Uploaded = append(result.Uploaded, filepath.ToSlash(rel))
+		case info.IsDir():
+			files, err := listLocalTree(name, nil)
+			if err != nil {
+				return result, err
+			}
+			for file := range files {
+				file = path.Join(filepath.ToSlash(rel), file)
+				ignored, err := ignore.ignored(file, false)
+				if err != nil {
+					return result, err
+				}
+				if !ignored {
+					result.Uploaded = append(result.Uploaded, file)
+				}
+			}
+		}
+	}
+	// A new directory and the files written into it are reported separately
+	result.Uploaded = uniqueSorted(result.Uploaded)
+	sort.Strings(result.Deleted)
+
+	if len(result.Uploaded) > 0 {
+		if err := createRemoteDirs(client, remoteDir, result.Uploaded); err != nil {
+			return result, err
+		}
+	}
+	for _, name := range result.Uploaded {
+		localFile := filepath.Join(localDir, filepath.FromSlash(name))
+		if err := copyLocalFileToRemote(client, localFile, path.Join(remoteDir, name), opts.TransferOptions...); err != nil {
+			return result, err
+		}
+	}
+	// Removing a directory removes the files below it as well
+	if err := removeRemoteTrees(client, remoteDir, result.Deleted); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// uniqueSorted sorts names and drops duplicates.
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}